@@ -0,0 +1,114 @@
+package blocklist
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lbryio/reflector.go/db"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	"github.com/spf13/viper"
+)
+
+// DBSource reads the list from a column of a MySQL table with one hash per row
+type DBSource struct {
+	name            string
+	dsn             string
+	table           string
+	column          string
+	refreshInterval time.Duration
+
+	db   *db.SQL
+	dbMu sync.Mutex
+}
+
+type DBParams struct {
+	Name            string        `mapstructure:"name"`
+	User            string        `mapstructure:"user"`
+	Password        string        `mapstructure:"password"`
+	Host            string        `mapstructure:"host"`
+	Port            int           `mapstructure:"port"`
+	Database        string        `mapstructure:"database"`
+	Table           string        `mapstructure:"table"`
+	Column          string        `mapstructure:"column"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+// NewDBSource returns an initialized DBSource pointer. It connects to the database on the first fetch.
+func NewDBSource(params DBParams) *DBSource {
+	if params.Column == "" {
+		params.Column = "hash"
+	}
+	if params.RefreshInterval <= 0 {
+		params.RefreshInterval = 5 * time.Minute
+	}
+	return &DBSource{
+		name:            params.Name,
+		dsn:             fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", params.User, params.Password, params.Host, params.Port, params.Database),
+		table:           params.Table,
+		column:          params.Column,
+		refreshInterval: params.RefreshInterval,
+	}
+}
+
+const nameDB = "db"
+
+// Name is the source type and name
+func (d *DBSource) Name() string { return nameDB + "-" + d.name }
+
+// Fetch reads every hash in the table
+func (d *DBSource) Fetch(stop.Chan) ([]string, error) {
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := conn.HashesFromTable(d.table, d.column)
+	if err != nil {
+		return nil, err
+	}
+	valid := hashes[:0]
+	for _, hash := range hashes {
+		if isValidHash(hash) {
+			valid = append(valid, hash)
+		}
+	}
+	return valid, nil
+}
+
+func (d *DBSource) connect() (*db.SQL, error) {
+	d.dbMu.Lock()
+	defer d.dbMu.Unlock()
+	if d.db != nil {
+		return d.db, nil
+	}
+	conn := &db.SQL{}
+	err := conn.Connect(d.dsn)
+	if err != nil {
+		return nil, err
+	}
+	d.db = conn
+	return conn, nil
+}
+
+// RefreshInterval is how often the table is read again
+func (d *DBSource) RefreshInterval() time.Duration { return d.refreshInterval }
+
+func DBSourceFactory(name string, config *viper.Viper) (Source, error) {
+	var params DBParams
+	err := config.Unmarshal(&params)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	if params.User == "" || params.Password == "" || params.Host == "" || params.Port == 0 || params.Database == "" || params.Table == "" {
+		return nil, errors.Err("db source requires user, password, host, port, database and table")
+	}
+	params.Name = name
+	return NewDBSource(params), nil
+}
+
+func init() {
+	RegisterSource(nameDB, DBSourceFactory)
+}
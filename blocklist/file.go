@@ -0,0 +1,70 @@
+package blocklist
+
+import (
+	"os"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	"github.com/spf13/viper"
+)
+
+// FileSource reads the blocklist from a local file with one sd hash per line, or a JSON array of sd hashes
+type FileSource struct {
+	name            string
+	path            string
+	refreshInterval time.Duration
+}
+
+type FileParams struct {
+	Name            string        `mapstructure:"name"`
+	Path            string        `mapstructure:"path"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+// NewFileSource returns an initialized FileSource pointer.
+func NewFileSource(params FileParams) *FileSource {
+	if params.RefreshInterval <= 0 {
+		params.RefreshInterval = time.Minute
+	}
+	return &FileSource{
+		name:            params.Name,
+		path:            params.Path,
+		refreshInterval: params.RefreshInterval,
+	}
+}
+
+const nameFile = "file"
+
+// Name is the source type and name
+func (f *FileSource) Name() string { return nameFile + "-" + f.name }
+
+// Fetch reads the file
+func (f *FileSource) Fetch(stop.Chan) ([]string, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	return parseHashes(data)
+}
+
+// RefreshInterval is how often the file is read again
+func (f *FileSource) RefreshInterval() time.Duration { return f.refreshInterval }
+
+func FileSourceFactory(name string, config *viper.Viper) (Source, error) {
+	var params FileParams
+	err := config.Unmarshal(&params)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	if params.Path == "" {
+		return nil, errors.Err("file source requires a path")
+	}
+	params.Name = name
+	return NewFileSource(params), nil
+}
+
+func init() {
+	RegisterSource(nameFile, FileSourceFactory)
+}
@@ -0,0 +1,179 @@
+package blocklist
+
+import (
+	"encoding/hex"
+	"sync"
+
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Filter is an in-memory blocklist for servers that don't have a Blocklister store (e.g. edges without MySQL).
+// It blocks the sd hashes listed by its sources along with the content blobs of those streams, and evicts
+// them from the local caches of the store tree.
+type Filter struct {
+	store    store.BlobStore
+	resolver *Resolver
+	watcher  *Watcher
+
+	// updateMu serializes updates from the sources. lists and streams are only used while holding it
+	updateMu sync.Mutex
+	lists    map[string][]string // hashes listed by each source
+	streams  map[string][]string // content blobs of each resolved sd hash
+
+	blocked map[string]bool
+	mu      sync.RWMutex
+}
+
+// contentBlobLister is implemented by sources whose lists already include the content blobs of blocked streams
+type contentBlobLister interface {
+	IncludesContentBlobs() bool
+}
+
+// NewFilter returns an initialized Filter pointer. The store is used to resolve sd blobs and to evict blocked blobs.
+func NewFilter(s store.BlobStore, sources []Source) *Filter {
+	f := &Filter{
+		store:    s,
+		resolver: NewResolver(s),
+		lists:    make(map[string][]string),
+		streams:  make(map[string][]string),
+		blocked:  make(map[string]bool),
+	}
+	f.watcher = NewWatcher(sources, f.update)
+	return f
+}
+
+// Start starts syncing the filter with its sources
+func (f *Filter) Start() {
+	f.watcher.Start()
+}
+
+// Reload fetches every source again without waiting for their next refresh
+func (f *Filter) Reload() {
+	f.watcher.Reload()
+}
+
+// Shutdown stops syncing the filter. It keeps blocking what it already blocks.
+func (f *Filter) Shutdown() {
+	f.watcher.Shutdown()
+}
+
+// IsBlocked returns true if the hash is a blocked sd hash or a content blob of a blocked stream.
+// A nil Filter blocks nothing.
+func (f *Filter) IsBlocked(hash string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.blocked[hash]
+}
+
+func (f *Filter) update(source Source, hashes []string) {
+	f.updateMu.Lock()
+	defer f.updateMu.Unlock()
+
+	f.lists[source.Name()] = hashes
+	if cbl, ok := source.(contentBlobLister); !ok || !cbl.IncludesContentBlobs() {
+		for _, sdHash := range hashes {
+			f.resolve(sdHash)
+		}
+	}
+
+	blocked := make(map[string]bool)
+	for _, list := range f.lists {
+		for _, hash := range list {
+			blocked[hash] = true
+			for _, blobHash := range f.streams[hash] {
+				blocked[blobHash] = true
+			}
+		}
+	}
+
+	f.resolver.Forget(func(sdHash string) bool { return blocked[sdHash] })
+
+	f.mu.Lock()
+	previous := f.blocked
+	f.blocked = blocked
+	f.mu.Unlock()
+
+	for hash := range blocked {
+		if !previous[hash] {
+			f.evict(hash)
+		}
+	}
+}
+
+// resolve finds the content blobs of a blocked stream. Streams whose sd blob can't be found are retried later.
+func (f *Filter) resolve(sdHash string) {
+	if _, ok := f.streams[sdHash]; ok {
+		return
+	}
+	blobHashes, err := f.resolver.ContentBlobs(sdHash)
+	if errors.Is(err, ErrNotSDBlob) {
+		log.Warnf("blocklist: %s", err)
+	} else if err != nil {
+		if !errors.Is(err, store.ErrBlobNotFound) {
+			log.Errorf("blocklist: resolving stream %s: %s", sdHash, errors.FullTrace(err))
+		}
+		return
+	}
+	f.streams[sdHash] = blobHashes
+}
+
+// ErrNotSDBlob is returned by ContentBlobs when the hash is not the hash of an sd blob
+var ErrNotSDBlob = errors.Base("not an sd blob")
+
+// ContentBlobs returns the content blobs of the stream with the given sd hash, by getting the sd blob from s
+func ContentBlobs(s store.BlobStore, sdHash string) ([]string, error) {
+	blob, _, err := s.Get(sdHash)
+	if err != nil {
+		return nil, err
+	}
+	return contentBlobs(sdHash, blob)
+}
+
+// PeekContentBlobs is ContentBlobs without side effects: the sd blob is not cached on its way from the origin
+func PeekContentBlobs(s store.BlobStore, sdHash string) ([]string, error) {
+	blob, _, err := store.Peek(s, sdHash)
+	if err != nil {
+		return nil, err
+	}
+	return contentBlobs(sdHash, blob)
+}
+
+func contentBlobs(sdHash string, blob stream.Blob) ([]string, error) {
+	var sd stream.SDBlob
+	err := sd.FromBlob(blob)
+	if err != nil {
+		log.Debugf("parsing %s as an sd blob: %s", sdHash, err)
+		return nil, errors.Prefix(sdHash, ErrNotSDBlob)
+	}
+	var blobHashes []string
+	for _, info := range sd.BlobInfos {
+		if info.Length > 0 {
+			blobHashes = append(blobHashes, hex.EncodeToString(info.BlobHash))
+		}
+	}
+	return blobHashes, nil
+}
+
+// evict removes a newly blocked blob from every local cache in the store tree
+func (f *Filter) evict(hash string) {
+	seen := make(map[store.BlobStore]bool)
+	store.Walk(f.store, func(s store.BlobStore, _ int) {
+		e, ok := s.(store.Evicter)
+		if !ok || seen[s] {
+			return
+		}
+		seen[s] = true
+		err := e.Evict(hash)
+		if err != nil {
+			log.Errorf("blocklist: evicting %s from %s: %s", hash, s.Name(), errors.FullTrace(err))
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package blocklist
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticSource []string
+
+func (s staticSource) Name() string                      { return "static" }
+func (s staticSource) Fetch(stop.Chan) ([]string, error) { return s, nil }
+func (s staticSource) RefreshInterval() time.Duration    { return time.Hour }
+
+func TestFilter_BlocksAndEvictsStream(t *testing.T) {
+	data := make([]byte, 3*stream.MaxBlobSize)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	s, err := stream.New(bytes.NewReader(data))
+	require.NoError(t, err)
+	sdHash, contentHash := s[0].HashHex(), s[1].HashHex()
+
+	origin := store.NewMemStore(store.MemParams{Name: "origin"})
+	cache := store.NewMemStore(store.MemParams{Name: "cache"})
+	for _, b := range s {
+		require.NoError(t, origin.Put(b.HashHex(), b))
+	}
+	require.NoError(t, cache.Put(contentHash, s[1]))
+
+	source := staticSource{sdHash}
+	f := NewFilter(store.NewCachingStore(store.CachingParams{Name: "test", Origin: origin, Cache: cache}), []Source{source})
+	f.update(source, source)
+
+	assert.True(t, f.IsBlocked(sdHash))
+	for _, b := range s[1:] {
+		assert.True(t, f.IsBlocked(b.HashHex()), "content blobs of a blocked stream must be blocked")
+	}
+	has, err := cache.Has(contentHash)
+	require.NoError(t, err)
+	assert.False(t, has, "blocked blobs must be evicted from the cache")
+	has, err = origin.Has(contentHash)
+	require.NoError(t, err)
+	assert.True(t, has, "evicting must not touch the origin")
+	has, err = cache.Has(sdHash)
+	require.NoError(t, err)
+	assert.False(t, has, "resolving a blocked stream must not cache its sd blob")
+
+	f.update(source, nil)
+	assert.False(t, f.IsBlocked(contentHash), "unlisted streams must be unblocked")
+
+	var nilFilter *Filter
+	assert.False(t, nilFilter.IsBlocked(sdHash))
+}
+
+func TestResolver_BacksOffOnMisses(t *testing.T) {
+	s, err := stream.New(bytes.NewReader([]byte("content")))
+	require.NoError(t, err)
+	sdHash := s[0].HashHex()
+	mem := store.NewMemStore(store.MemParams{Name: "mem"})
+	r := NewResolver(mem)
+
+	_, err = r.ContentBlobs(sdHash)
+	assert.ErrorIs(t, err, store.ErrBlobNotFound)
+
+	// the miss is remembered, the store is not asked again until the backoff is over
+	require.NoError(t, mem.Put(sdHash, s[0]))
+	_, err = r.ContentBlobs(sdHash)
+	assert.ErrorIs(t, err, store.ErrBlobNotFound)
+	assert.Equal(t, minResolveBackoff, r.misses[sdHash].backoff)
+
+	r.misses[sdHash] = miss{retryAt: time.Now(), backoff: minResolveBackoff}
+	blobHashes, err := r.ContentBlobs(sdHash)
+	require.NoError(t, err)
+	assert.Equal(t, []string{s[1].HashHex()}, blobHashes)
+	assert.Empty(t, r.misses)
+
+	_, err = r.ContentBlobs("missing")
+	assert.ErrorIs(t, err, store.ErrBlobNotFound)
+	r.Forget(func(string) bool { return false })
+	assert.Empty(t, r.misses)
+}
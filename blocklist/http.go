@@ -0,0 +1,128 @@
+package blocklist
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// HTTPSource fetches the blocklist from an HTTP endpoint that returns one sd hash per line, or a JSON array of sd hashes
+type HTTPSource struct {
+	name            string
+	url             string
+	token           string
+	client          *http.Client
+	refreshInterval time.Duration
+	contentBlobs    bool
+}
+
+type HTTPParams struct {
+	Name            string        `mapstructure:"name"`
+	URL             string        `mapstructure:"url"`
+	Token           string        `mapstructure:"token"` // sent as a bearer token if set
+	Timeout         time.Duration `mapstructure:"timeout"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	ContentBlobs    bool          `mapstructure:"content_blobs"` // the list already includes the content blobs of blocked streams, e.g. the /blocklist route of an origin
+}
+
+// NewHTTPSource returns an initialized HTTPSource pointer.
+func NewHTTPSource(params HTTPParams) *HTTPSource {
+	if params.Timeout <= 0 {
+		params.Timeout = defaultTimeout
+	}
+	if params.RefreshInterval <= 0 {
+		params.RefreshInterval = time.Hour
+	}
+	return &HTTPSource{
+		name:            params.Name,
+		url:             params.URL,
+		token:           params.Token,
+		client:          &http.Client{Timeout: params.Timeout},
+		refreshInterval: params.RefreshInterval,
+		contentBlobs:    params.ContentBlobs,
+	}
+}
+
+const nameHTTP = "http"
+
+// Name is the source type and name
+func (h *HTTPSource) Name() string { return nameHTTP + "-" + h.name }
+
+// Fetch downloads the list
+func (h *HTTPSource) Fetch(stopper stop.Chan) ([]string, error) {
+	data, err := download(stopper, h.client, h.url, h.token)
+	if err != nil {
+		return nil, err
+	}
+	return parseHashes(data)
+}
+
+// download returns the body of a GET request to url, sending token as a bearer token if it is set.
+// It gives up when stopper is closed.
+func download(stopper stop.Chan, client *http.Client, url, token string) ([]byte, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopper:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	defer func() {
+		closeErr := resp.Body.Close()
+		if closeErr != nil {
+			log.Errorln(errors.Err(closeErr))
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Err("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	return data, nil
+}
+
+// RefreshInterval is how often the list is downloaded again
+func (h *HTTPSource) RefreshInterval() time.Duration { return h.refreshInterval }
+
+// IncludesContentBlobs is true if the list already includes the content blobs of blocked streams
+func (h *HTTPSource) IncludesContentBlobs() bool { return h.contentBlobs }
+
+func HTTPSourceFactory(name string, config *viper.Viper) (Source, error) {
+	var params HTTPParams
+	err := config.Unmarshal(&params)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	if params.URL == "" {
+		return nil, errors.Err("http source requires a url")
+	}
+	params.Name = name
+	return NewHTTPSource(params), nil
+}
+
+func init() {
+	RegisterSource(nameHTTP, HTTPSourceFactory)
+}
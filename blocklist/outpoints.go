@@ -0,0 +1,225 @@
+package blocklist
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/wallet"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// DefaultOutpointsURL is the LBRY Inc. list of blocked claim outpoints
+const DefaultOutpointsURL = "https://api.lbry.com/file/list_blocked"
+
+// DefaultWalletServers are the hubs used to resolve outpoints when none are configured
+var DefaultWalletServers = []string{
+	"a-hub1.odysee.com:50001",
+	"b-hub1.odysee.com:50001",
+	"c-hub1.odysee.com:50001",
+	"s-hub1.odysee.com:50001",
+}
+
+// OutpointSource fetches a list of blocked claim outpoints from an endpoint that speaks the list_blocked API
+// and resolves them to sd hashes through wallet servers
+type OutpointSource struct {
+	name            string
+	url             string
+	walletServers   []string
+	client          *http.Client
+	refreshInterval time.Duration
+}
+
+type OutpointParams struct {
+	Name            string        `mapstructure:"name"`
+	URL             string        `mapstructure:"url"`
+	WalletServers   []string      `mapstructure:"wallet_servers"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+// NewOutpointSource returns an initialized OutpointSource pointer.
+func NewOutpointSource(params OutpointParams) *OutpointSource {
+	if params.URL == "" {
+		params.URL = DefaultOutpointsURL
+	}
+	if len(params.WalletServers) == 0 {
+		params.WalletServers = DefaultWalletServers
+	}
+	if params.Timeout <= 0 {
+		params.Timeout = defaultTimeout
+	}
+	if params.RefreshInterval <= 0 {
+		params.RefreshInterval = 12 * time.Hour
+	}
+	return &OutpointSource{
+		name:            params.Name,
+		url:             params.URL,
+		walletServers:   params.WalletServers,
+		client:          &http.Client{Timeout: params.Timeout},
+		refreshInterval: params.RefreshInterval,
+	}
+}
+
+const nameOutpoints = "outpoints"
+
+// Name is the source type and name
+func (o *OutpointSource) Name() string { return nameOutpoints + "-" + o.name }
+
+// RefreshInterval is how often the outpoints are fetched and resolved again
+func (o *OutpointSource) RefreshInterval() time.Duration { return o.refreshInterval }
+
+// Fetch gets the blocked outpoints and resolves them to sd hashes. Outpoints that fail to resolve are logged and skipped.
+func (o *OutpointSource) Fetch(stopper stop.Chan) ([]string, error) {
+	outpoints, err := o.blockedOutpoints(stopper)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := sdHashesForOutpoints(o.walletServers, outpoints, stopper)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(values))
+	for name, v := range values {
+		if v.Err != nil {
+			log.Error(errors.FullTrace(errors.Err("blocklist: %s: %s", name, v.Err)))
+			continue
+		}
+		hashes = append(hashes, v.Value)
+	}
+	return hashes, nil
+}
+
+func (o *OutpointSource) blockedOutpoints(stopper stop.Chan) ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopper:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.url, nil)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	defer func() {
+		closeErr := resp.Body.Close()
+		if closeErr != nil {
+			log.Errorln(errors.Err(closeErr))
+		}
+	}()
+
+	var r struct {
+		Error string `json:"error"`
+		Data  struct {
+			Outpoints []string `json:"outpoints"`
+		} `json:"data"`
+		Success bool `json:"success"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, errors.Err(err)
+	}
+
+	if !r.Success {
+		return nil, errors.Prefix("list_blocked API call", r.Error)
+	}
+	return r.Data.Outpoints, nil
+}
+
+type valOrErr struct {
+	Err   error
+	Value string
+}
+
+// sdHashesForOutpoints queries wallet server for the sd hashes in a given outpoints
+func sdHashesForOutpoints(walletServers, outpoints []string, stopper stop.Chan) (map[string]valOrErr, error) {
+	values := make(map[string]valOrErr)
+
+	node := wallet.NewNode()
+	err := node.Connect(walletServers, nil)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+
+	done := make(chan bool)
+	metrics.RoutinesQueue.WithLabelValues("blocklist", "sdhashesforoutput").Inc()
+	go func() {
+		defer metrics.RoutinesQueue.WithLabelValues("blocklist", "sdhashesforoutput").Dec()
+		select {
+		case <-done:
+		case <-stopper:
+		}
+		node.Shutdown()
+	}()
+
+OutpointLoop:
+	for _, outpoint := range outpoints {
+		select {
+		case <-stopper:
+			break OutpointLoop
+		default:
+		}
+
+		parts := strings.Split(outpoint, ":")
+		if len(parts) != 2 {
+			values[outpoint] = valOrErr{Err: errors.Err("invalid outpoint format")}
+			continue
+		}
+
+		nout, err := strconv.Atoi(parts[1])
+		if err != nil {
+			values[outpoint] = valOrErr{Err: errors.Prefix("invalid nout", err)}
+			continue
+		}
+
+		claim, err := node.GetClaimInTx(parts[0], nout)
+		if err != nil {
+			values[outpoint] = valOrErr{Err: err}
+			continue
+		}
+
+		hash := hex.EncodeToString(claim.GetStream().GetSource().GetSdHash())
+		values[outpoint] = valOrErr{Value: hash, Err: nil}
+	}
+
+	select {
+	case done <- true:
+	default: // in case of race where stopper got stopped right after loop finished
+	}
+
+	return values, nil
+}
+
+func OutpointSourceFactory(name string, config *viper.Viper) (Source, error) {
+	var params OutpointParams
+	err := config.Unmarshal(&params)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	params.Name = name
+	return NewOutpointSource(params), nil
+}
+
+func init() {
+	RegisterSource(nameOutpoints, OutpointSourceFactory)
+}
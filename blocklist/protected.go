@@ -0,0 +1,101 @@
+package blocklist
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultProtectedListURL is the Odysee list of protected streams
+const DefaultProtectedListURL = "https://direct.api.odysee.com/file/list_protected"
+
+// ProtectedAPISource fetches the sd hashes of the streams listed by an API speaking the file/list_protected format
+type ProtectedAPISource struct {
+	name            string
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+}
+
+type ProtectedAPIParams struct {
+	Name            string        `mapstructure:"name"`
+	URL             string        `mapstructure:"url"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+// NewProtectedAPISource returns an initialized ProtectedAPISource pointer.
+func NewProtectedAPISource(params ProtectedAPIParams) *ProtectedAPISource {
+	if params.URL == "" {
+		params.URL = DefaultProtectedListURL
+	}
+	if params.Timeout <= 0 {
+		params.Timeout = 5 * time.Second
+	}
+	if params.RefreshInterval <= 0 {
+		params.RefreshInterval = 2 * time.Minute
+	}
+	return &ProtectedAPISource{
+		name:            params.Name,
+		url:             params.URL,
+		client:          &http.Client{Timeout: params.Timeout},
+		refreshInterval: params.RefreshInterval,
+	}
+}
+
+const nameProtectedAPI = "list_protected"
+
+// Name is the source type and name
+func (p *ProtectedAPISource) Name() string { return nameProtectedAPI + "-" + p.name }
+
+// Fetch downloads the list
+func (p *ProtectedAPISource) Fetch(stopper stop.Chan) ([]string, error) {
+	data, err := download(stopper, p.client, p.url, "")
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		Error string `json:"error"`
+		Data  []struct {
+			SDHash  string `json:"sd_hash"`
+			ClaimID string `json:"claim_id"`
+		} `json:"data"`
+		Success bool `json:"success"`
+	}
+	err = json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	if !r.Success {
+		return nil, errors.Prefix("file/list_protected API call", r.Error)
+	}
+	hashes := make([]string, 0, len(r.Data))
+	for _, pc := range r.Data {
+		if isValidHash(pc.SDHash) {
+			hashes = append(hashes, pc.SDHash)
+		}
+	}
+	return hashes, nil
+}
+
+// RefreshInterval is how often the list is downloaded again
+func (p *ProtectedAPISource) RefreshInterval() time.Duration { return p.refreshInterval }
+
+func ProtectedAPISourceFactory(name string, config *viper.Viper) (Source, error) {
+	var params ProtectedAPIParams
+	err := config.Unmarshal(&params)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	params.Name = name
+	return NewProtectedAPISource(params), nil
+}
+
+func init() {
+	RegisterSource(nameProtectedAPI, ProtectedAPISourceFactory)
+}
@@ -0,0 +1,66 @@
+package blocklist
+
+import (
+	"time"
+
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+)
+
+const (
+	// minResolveBackoff is how long a stream whose sd blob wasn't found is left alone before looking again
+	minResolveBackoff = 10 * time.Minute
+	// maxResolveBackoff caps the wait, it doubles every time the sd blob is still not found
+	maxResolveBackoff = 24 * time.Hour
+)
+
+// Resolver finds the content blobs of listed streams. The sd blobs are peeked, so resolving doesn't pull them
+// from the origin into the local caches, and streams whose sd blob can't be found are looked up again less and
+// less often. A Resolver is not safe for concurrent use.
+type Resolver struct {
+	store  store.BlobStore
+	misses map[string]miss
+}
+
+type miss struct {
+	retryAt time.Time
+	backoff time.Duration
+}
+
+// NewResolver returns a Resolver that looks up sd blobs in s
+func NewResolver(s store.BlobStore) *Resolver {
+	return &Resolver{store: s, misses: make(map[string]miss)}
+}
+
+// ContentBlobs returns the content blobs of the stream with the given sd hash. It returns ErrBlobNotFound
+// without looking if the sd blob was recently not found.
+func (r *Resolver) ContentBlobs(sdHash string) ([]string, error) {
+	m, missed := r.misses[sdHash]
+	if missed && time.Now().Before(m.retryAt) {
+		return nil, errors.Err(store.ErrBlobNotFound)
+	}
+	blobHashes, err := PeekContentBlobs(r.store, sdHash)
+	if errors.Is(err, store.ErrBlobNotFound) {
+		m.backoff *= 2
+		if m.backoff < minResolveBackoff {
+			m.backoff = minResolveBackoff
+		} else if m.backoff > maxResolveBackoff {
+			m.backoff = maxResolveBackoff
+		}
+		m.retryAt = time.Now().Add(m.backoff)
+		r.misses[sdHash] = m
+		return nil, err
+	}
+	delete(r.misses, sdHash)
+	return blobHashes, err
+}
+
+// Forget drops the misses of the sd hashes that listed returns false for, once they are no longer listed
+func (r *Resolver) Forget(listed func(sdHash string) bool) {
+	for sdHash := range r.misses {
+		if !listed(sdHash) {
+			delete(r.misses, sdHash)
+		}
+	}
+}
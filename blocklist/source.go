@@ -0,0 +1,130 @@
+package blocklist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Source provides a list of sd hashes that must be blocked
+type Source interface {
+	// Name of the source (useful for logs)
+	Name() string
+	// Fetch returns the sd hashes currently on the list. It should give up when stopper is closed.
+	Fetch(stopper stop.Chan) ([]string, error)
+	// RefreshInterval is how often the list should be fetched again
+	RefreshInterval() time.Duration
+}
+
+var Factories = make(map[string]Factory)
+
+func RegisterSource(name string, factory Factory) {
+	Factories[name] = factory
+}
+
+// Factory creates a source named name from its config
+type Factory func(name string, config *viper.Viper) (Source, error)
+
+// NewSourcesFromConfig creates one source per key of config. Each source config must contain exactly one key: the source type.
+//
+//	blocklists:
+//	  local:
+//	    file:
+//	      path: /etc/reflector/blocked.txt
+//	      refresh_interval: 5m
+func NewSourcesFromConfig(config *viper.Viper) ([]Source, error) {
+	var sources []Source
+	if config == nil {
+		return sources, nil
+	}
+	for name := range config.AllSettings() {
+		sourceConfig := config.Sub(name)
+		if sourceConfig == nil || len(sourceConfig.AllSettings()) != 1 {
+			return nil, errors.Err("blocklist %s: expected a single source type", name)
+		}
+		sourceType := sourceTypeOf(sourceConfig)
+		factory, ok := Factories[sourceType]
+		if !ok {
+			return nil, errors.Err("blocklist %s: unknown source type %s", name, sourceType)
+		}
+		settings := sourceConfig.Sub(sourceType)
+		if settings == nil {
+			settings = viper.New()
+		}
+		source, err := factory(name, settings)
+		if err != nil {
+			return nil, errors.Prefix("blocklist "+name, err)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// sourceTypeOf returns the source type of a source config, which is its only top level key
+func sourceTypeOf(config *viper.Viper) string {
+	for sourceType := range config.AllSettings() {
+		return sourceType
+	}
+	return ""
+}
+
+// DefaultSources are used when the blocklist is enabled but no sources are configured. They follow the LBRY Inc./Odysee moderation list.
+func DefaultSources() []Source {
+	return []Source{NewOutpointSource(OutpointParams{Name: "odysee"})}
+}
+
+// defaultTimeout is used for remote sources that don't configure one
+const defaultTimeout = 10 * time.Second
+
+// parseHashes reads a list of sd hashes, either as a JSON array or as one hash per line.
+// Blank lines and lines starting with # are ignored.
+func parseHashes(data []byte) ([]string, error) {
+	var hashes []string
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		err := json.Unmarshal(trimmed, &hashes)
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			hashes = append(hashes, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Err(err)
+		}
+	}
+
+	valid := hashes[:0]
+	for _, hash := range hashes {
+		if !isValidHash(hash) {
+			log.Warnf("blocklist: ignoring invalid sd hash %q", hash)
+			continue
+		}
+		valid = append(valid, hash)
+	}
+	return valid, nil
+}
+
+func isValidHash(hash string) bool {
+	if len(hash) != stream.BlobHashHexLength {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
@@ -0,0 +1,66 @@
+package blocklist
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	hash1 = strings.Repeat("a", 96)
+	hash2 = strings.Repeat("b", 96)
+)
+
+func TestParseHashes(t *testing.T) {
+	tests := map[string]string{
+		"lines": "# blocked streams\n" + hash1 + "\n\n  " + hash2 + "  \nnot-a-hash\n",
+		"json":  `["` + hash1 + `", "` + hash2 + `", "zz"]`,
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			hashes, err := parseHashes([]byte(input))
+			require.NoError(t, err)
+			assert.Equal(t, []string{hash1, hash2}, hashes)
+		})
+	}
+
+	_, err := parseHashes([]byte(`["unterminated`))
+	assert.Error(t, err)
+}
+
+func TestNewSourcesFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocked.txt")
+	require.NoError(t, os.WriteFile(path, []byte(hash1+"\n"), 0644))
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(strings.NewReader(`
+local:
+  file:
+    path: `+path+`
+    refresh_interval: 5m
+`)))
+	sources, err := NewSourcesFromConfig(v)
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Equal(t, "file-local", sources[0].Name())
+	assert.Equal(t, 5*time.Minute, sources[0].RefreshInterval())
+
+	hashes, err := sources[0].Fetch(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{hash1}, hashes)
+
+	require.NoError(t, v.ReadConfig(strings.NewReader(`
+broken:
+  carrier_pigeon:
+    coop: roof
+`)))
+	_, err = NewSourcesFromConfig(v)
+	assert.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package blocklist
+
+import (
+	"time"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Watcher fetches every source on its own refresh interval and hands the results to a callback
+type Watcher struct {
+	sources []Source
+	apply   func(source Source, hashes []string)
+	reloads []chan struct{}
+	grp     *stop.Group
+
+	// Failed, if set, is called every time a source can't be fetched. It must be set before Start.
+	Failed func(source Source, err error)
+}
+
+// NewWatcher returns an initialized Watcher pointer. apply is called with the full list every time a source is fetched.
+func NewWatcher(sources []Source, apply func(source Source, hashes []string)) *Watcher {
+	w := &Watcher{
+		sources: sources,
+		apply:   apply,
+		grp:     stop.New(),
+	}
+	for range sources {
+		w.reloads = append(w.reloads, make(chan struct{}, 1))
+	}
+	return w
+}
+
+// Start fetches every source right away and then keeps them up to date in the background
+func (w *Watcher) Start() {
+	for i, source := range w.sources {
+		w.grp.Add(1)
+		metrics.RoutinesQueue.WithLabelValues("blocklist", "watch").Inc()
+		go func(source Source, reload chan struct{}) {
+			defer metrics.RoutinesQueue.WithLabelValues("blocklist", "watch").Dec()
+			defer w.grp.Done()
+			w.watch(source, reload)
+		}(source, w.reloads[i])
+	}
+}
+
+// Reload fetches every source again without waiting for their next refresh
+func (w *Watcher) Reload() {
+	for _, reload := range w.reloads {
+		select {
+		case reload <- struct{}{}:
+		default: // a reload is already pending
+		}
+	}
+}
+
+// Shutdown stops watching the sources
+func (w *Watcher) Shutdown() {
+	w.grp.StopAndWait()
+}
+
+func (w *Watcher) watch(source Source, reload chan struct{}) {
+	w.update(source)
+	t := time.NewTicker(source.RefreshInterval())
+	defer t.Stop()
+	for {
+		select {
+		case <-w.grp.Ch():
+			return
+		case <-t.C:
+			w.update(source)
+		case <-reload:
+			w.update(source)
+		}
+	}
+}
+
+func (w *Watcher) update(source Source) {
+	log.Debugf("blocklist %s update starting", source.Name())
+	hashes, err := source.Fetch(w.grp.Ch())
+	if err != nil {
+		log.Error(errors.FullTrace(errors.Prefix("blocklist "+source.Name(), err)))
+		if w.Failed != nil {
+			w.Failed(source, err)
+		}
+		return
+	}
+	w.apply(source, hashes)
+	log.Debugf("blocklist %s update done: %d hashes", source.Name(), len(hashes))
+}
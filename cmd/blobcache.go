@@ -1,10 +1,7 @@
 package cmd
 
 import (
-	"os"
-	"os/signal"
 	"strconv"
-	"syscall"
 
 	"github.com/lbryio/reflector.go/config"
 	"github.com/lbryio/reflector.go/internal/metrics"
@@ -27,29 +24,28 @@ func init() {
 }
 
 func blobcacheCmd(cmd *cobra.Command, args []string) {
-	store, err := config.LoadStores(conf, "blobcache")
+	reloader, err := config.NewReloader(conf, "blobcache")
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer store.Shutdown()
+	defer reloader.Shutdown()
 
-	servers, err := config.LoadServers(store, conf, "blobcache")
+	if disableBlocklist {
+		reloader.DisableBlocklists()
+	}
+	err = reloader.StartServers()
 	if err != nil {
 		log.Fatal(err)
 	}
-	for _, s := range servers {
-		err = s.Start()
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer s.Shutdown()
-	}
 
 	metricsServer := metrics.NewServer(":"+strconv.Itoa(metricsPort), "/metrics")
 	metricsServer.Start()
 	defer metricsServer.Shutdown()
 
-	interruptChan := make(chan os.Signal, 1)
-	signal.Notify(interruptChan, os.Interrupt, syscall.SIGTERM)
-	<-interruptChan
+	adminServer := startAdminServer(reloader, "blobcache")
+	if adminServer != nil {
+		defer adminServer.Shutdown()
+	}
+
+	waitForSignals(reloader)
 }
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lbryio/reflector.go/config"
+	"github.com/lbryio/reflector.go/db"
+	"github.com/lbryio/reflector.go/store"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var blocklistContentBlobs bool
+var blocklistHistory string
+var blocklistReason string
+var blocklistSource string
+
+func init() {
+	var cmd = &cobra.Command{
+		Use:   "blocklist",
+		Short: "Manage the blocked hashes in the database",
+	}
+
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List blocked sd hashes, or the block history of a hash",
+		Args:  cobra.NoArgs,
+		Run:   blocklistListCmd,
+	}
+	listCmd.Flags().BoolVar(&blocklistContentBlobs, "content-blobs", false, "Also list the content blobs blocked along with their stream")
+	listCmd.Flags().StringVar(&blocklistHistory, "history", "", "Show the block history of this hash instead")
+
+	var addCmd = &cobra.Command{
+		Use:   "add HASH",
+		Short: "Block a hash, and the content blobs of its stream if it is an sd hash",
+		Args:  cobra.ExactArgs(1),
+		Run:   blocklistAddCmd,
+	}
+	var removeCmd = &cobra.Command{
+		Use:   "remove HASH",
+		Short: "Unblock a hash, and the content blobs that were blocked along with it",
+		Args:  cobra.ExactArgs(1),
+		Run:   blocklistRemoveCmd,
+	}
+	for _, c := range []*cobra.Command{addCmd, removeCmd} {
+		c.Flags().StringVar(&blocklistReason, "reason", "", "Why the hash is blocked or unblocked, kept in the block history")
+		c.Flags().StringVar(&blocklistSource, "source", "operator", "Who blocks or unblocks the hash, kept in the block history")
+	}
+
+	cmd.AddCommand(listCmd, addCmd, removeCmd)
+	rootCmd.AddCommand(cmd)
+}
+
+func blocklistListCmd(cmd *cobra.Command, args []string) {
+	database, err := config.LoadDatabase(conf, "blocklist")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	if blocklistHistory != "" {
+		events, err := database.BlockHistory(blocklistHistory)
+		checkErr(err)
+		_, _ = fmt.Fprintln(w, "TIME\tACTION\tSOURCE\tREASON")
+		for _, e := range events {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.CreatedAt.Format(time.RFC3339), e.Action, e.Source, e.Reason)
+		}
+		return
+	}
+
+	records, err := database.ListBlocked(blocklistContentBlobs)
+	checkErr(err)
+	_, _ = fmt.Fprintln(w, "HASH\tBLOCKED AT\tSOURCE\tREASON\tSTREAM")
+	for _, r := range records {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Hash, r.BlockedAt.Format(time.RFC3339), r.Source, r.Reason, r.StreamSdHash)
+	}
+}
+
+func blocklistAddCmd(cmd *cobra.Command, args []string) {
+	bl, shutdown := loadBlocklister()
+	defer shutdown()
+	err := bl.Block(args[0], store.BlockInfo{Reason: blocklistReason, Source: blocklistSource})
+	checkErr(err)
+	log.Infof("blocked %s", args[0])
+}
+
+func blocklistRemoveCmd(cmd *cobra.Command, args []string) {
+	bl, shutdown := loadBlocklister()
+	defer shutdown()
+	err := bl.Unblock(args[0], store.BlockInfo{Reason: blocklistReason, Source: blocklistSource})
+	checkErr(err)
+	log.Infof("unblocked %s", args[0])
+}
+
+// loadBlocklister returns the store defined in blocklist.yaml, so blocked blobs are also deleted from storage.
+// Without a store section, blocks only go to the database.
+func loadBlocklister() (store.Blocklister, func()) {
+	s, err := config.LoadStores(conf, "blocklist")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if s == nil {
+		var database *db.SQL
+		database, err = config.LoadDatabase(conf, "blocklist")
+		if err != nil {
+			log.Fatal(err)
+		}
+		s = store.NewDBBackedStore(store.DBBackedParams{Store: store.NewNoopStore("blocklist"), DB: database, Name: "blocklist"})
+	}
+	bl, ok := s.(store.Blocklister)
+	if !ok {
+		s.Shutdown()
+		log.Fatalf("store %s does not support blocking", s.Name())
+	}
+	return bl, s.Shutdown
+}
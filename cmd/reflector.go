@@ -9,7 +9,10 @@ import (
 
 	"github.com/lbryio/reflector.go/config"
 	"github.com/lbryio/reflector.go/internal/metrics"
-	"github.com/lbryio/reflector.go/reflector"
+	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/server/admin"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -32,45 +35,68 @@ func init() {
 	}
 
 	cmd.Flags().IntVar(&metricsPort, "metrics-port", 2112, "The port reflector will use for prometheus metrics")
-	cmd.Flags().IntVar(&receiverPort, "receiver-port", 5566, "The port reflector will receive content from")
-	cmd.Flags().BoolVar(&disableBlocklist, "disable-blocklist", false, "Disable blocklist watching/updating")
+	cmd.Flags().IntVar(&receiverPort, "receiver-port", 5566, "The port reflector will receive content from, unless a reflector server is configured")
+	cmd.Flags().BoolVar(&disableBlocklist, "disable-blocklist", false, "Disable blocklist watching/updating, unless a reflector server is configured")
 
 	rootCmd.AddCommand(cmd)
 }
 
 func reflectorCmd(cmd *cobra.Command, args []string) {
-	store, err := config.LoadStores(conf, "reflector")
+	reloader, err := config.NewReloader(conf, "reflector")
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer store.Shutdown()
+	defer reloader.Shutdown()
 
-	servers, err := config.LoadServers(store, conf, "reflector")
+	// the flags only apply when the config file doesn't define a reflector server
+	reloader.SetDefaultServer("reflector", server.BlobServerConfig{
+		Port:            receiverPort,
+		Timeout:         3 * time.Minute,
+		EnableBlocklist: !disableBlocklist,
+	})
+	err = reloader.StartServers()
 	if err != nil {
 		log.Fatal(err)
 	}
-	for _, s := range servers {
-		err = s.Start()
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer s.Shutdown()
+
+	metricsServer := metrics.NewServer(":"+strconv.Itoa(metricsPort), "/metrics")
+	metricsServer.Start()
+	defer metricsServer.Shutdown()
+
+	adminServer := startAdminServer(reloader, "reflector")
+	if adminServer != nil {
+		defer adminServer.Shutdown()
 	}
 
-	reflectorServer := reflector.NewIngestionServer(store)
-	reflectorServer.Timeout = 3 * time.Minute
-	reflectorServer.EnableBlocklist = !disableBlocklist
-	err = reflectorServer.Start(":" + strconv.Itoa(receiverPort))
+	waitForSignals(reloader)
+}
+
+// startAdminServer starts the admin server if the config file has an admin section. It returns nil otherwise.
+func startAdminServer(reloader *config.Reloader, file string) *admin.Server {
+	cfg, err := config.LoadAdminConfig(conf, file)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer reflectorServer.Shutdown()
-
-	metricsServer := metrics.NewServer(":"+strconv.Itoa(metricsPort), "/metrics")
-	metricsServer.Start()
-	defer metricsServer.Shutdown()
+	if cfg == nil {
+		return nil
+	}
+	adminServer := admin.NewServer(reloader, *cfg)
+	adminServer.Start()
+	return adminServer
+}
 
-	interruptChan := make(chan os.Signal, 1)
-	signal.Notify(interruptChan, os.Interrupt, syscall.SIGTERM)
-	<-interruptChan
+// waitForSignals blocks until the process is asked to stop. SIGHUP reloads the configuration instead.
+func waitForSignals(reloader *config.Reloader) {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signalChan {
+		if sig != syscall.SIGHUP {
+			return
+		}
+		log.Infoln("SIGHUP received, reloading configuration")
+		err := reloader.Reload()
+		if err != nil {
+			log.Errorf("error reloading configuration: %s", errors.FullTrace(err))
+		}
+	}
 }
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+)
+
+// filePrefix marks a config value that should be replaced by the contents of a file (e.g. a mounted secret)
+const filePrefix = "file:"
+
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolate walks the config settings and resolves every string value:
+//   - ${ENV_VAR} anywhere in a value is replaced by the value of the environment variable
+//   - a value of the form file:/path is replaced by the contents of the file, without the trailing newline
+func interpolate(settings interface{}) (interface{}, error) {
+	switch v := settings.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			resolved, err := interpolate(value)
+			if err != nil {
+				return nil, errors.Prefix(key, err)
+			}
+			v[key] = resolved
+		}
+		return v, nil
+	case []interface{}:
+		for i, value := range v {
+			resolved, err := interpolate(value)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	case string:
+		return interpolateString(v)
+	default:
+		return v, nil
+	}
+}
+
+func interpolateString(value string) (string, error) {
+	var missing []string
+	value = envVarPattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := envVarPattern.FindStringSubmatch(match)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return envValue
+	})
+	if len(missing) > 0 {
+		return "", errors.Err("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	if strings.HasPrefix(value, filePrefix) {
+		contents, err := os.ReadFile(strings.TrimPrefix(value, filePrefix))
+		if err != nil {
+			return "", errors.Err(err)
+		}
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	}
+	return value, nil
+}
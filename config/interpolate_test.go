@@ -0,0 +1,45 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("REFLECTOR_TEST_USER", "reflector")
+	t.Setenv("REFLECTOR_TEST_HOST", "db.local")
+
+	secret := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(secret, []byte("hunter2\n"), 0600))
+
+	settings := map[string]interface{}{
+		"database": map[string]interface{}{
+			"user":     "${REFLECTOR_TEST_USER}",
+			"host":     "${REFLECTOR_TEST_HOST}:3306",
+			"password": "file:" + secret,
+			"port":     3306,
+		},
+		"list": []interface{}{"${REFLECTOR_TEST_USER}", "plain"},
+	}
+	resolved, err := interpolate(settings)
+	require.NoError(t, err)
+
+	db := resolved.(map[string]interface{})["database"].(map[string]interface{})
+	assert.Equal(t, "reflector", db["user"])
+	assert.Equal(t, "db.local:3306", db["host"])
+	assert.Equal(t, "hunter2", db["password"])
+	assert.Equal(t, 3306, db["port"])
+	assert.Equal(t, []interface{}{"reflector", "plain"}, resolved.(map[string]interface{})["list"])
+}
+
+func TestInterpolate_Errors(t *testing.T) {
+	_, err := interpolate(map[string]interface{}{"key": "${REFLECTOR_TEST_UNSET_VARIABLE}"})
+	assert.Error(t, err)
+
+	_, err = interpolate(map[string]interface{}{"key": "file:" + filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+}
@@ -1,13 +1,26 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/lbryio/reflector.go/blocklist"
 	"github.com/lbryio/reflector.go/db"
+	"github.com/lbryio/reflector.go/events"
+	"github.com/lbryio/reflector.go/protected"
+	"github.com/lbryio/reflector.go/proxyproto"
+	"github.com/lbryio/reflector.go/ratelimit"
+	"github.com/lbryio/reflector.go/reflector"
 	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/server/admin"
 	"github.com/lbryio/reflector.go/server/http"
 	"github.com/lbryio/reflector.go/server/http3"
 	"github.com/lbryio/reflector.go/server/peer"
+	"github.com/lbryio/reflector.go/signing"
 	"github.com/lbryio/reflector.go/store"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
@@ -16,7 +29,12 @@ import (
 	"github.com/spf13/viper"
 )
 
-func LoadStores(path, file string) (store.BlobStore, error) {
+// storeBuilder creates the store trees returned by LoadStores. Calling LoadStores again for the same config
+// reuses the stores whose configuration did not change.
+var storeBuilder = store.NewBuilder()
+
+// readConfig reads a yaml config file and resolves ${ENV_VAR} and file:/path values in it
+func readConfig(path, file string) (*viper.Viper, error) {
 	v := viper.New()
 	v.SetConfigType("yaml")
 	v.AddConfigPath(path)
@@ -26,66 +44,424 @@ func LoadStores(path, file string) (store.BlobStore, error) {
 		return nil, errors.Err(err)
 	}
 
+	settings, err := interpolate(v.AllSettings())
+	if err != nil {
+		return nil, errors.Prefix("interpolating "+file, err)
+	}
+	resolved := viper.New()
+	err = resolved.MergeConfigMap(settings.(map[string]interface{}))
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	return resolved, nil
+}
+
+func LoadStores(path, file string) (store.BlobStore, error) {
+	v, err := readConfig(path, file)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := loadStores(v)
+	if err != nil || tree == nil {
+		return nil, err
+	}
+	tree.Commit()
+	return tree.Store, nil
+}
+
+// loadStores builds the store tree of the config. It returns nil if the config has no store. The tree has to be
+// committed once it is used, or aborted.
+func loadStores(v *viper.Viper) (*store.Tree, error) {
 	storeViper := v.Sub("store")
-	for storeType := range storeViper.AllSettings() {
-		factory, exists := store.Factories[storeType]
-		if !exists {
-			return nil, errors.Err("unknown store type: %s", storeType)
+	if storeViper == nil {
+		return nil, nil
+	}
+	//we only expect 1 store as the root. named stores under "stores" can be referenced from anywhere in the tree
+	tree, err := storeBuilder.Build(storeViper, v.Sub("stores"))
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	return tree, nil
+}
+
+func LoadServers(store store.BlobStore, path, file string) ([]server.BlobServer, error) {
+	v, err := readConfig(path, file)
+	if err != nil {
+		return nil, err
+	}
+
+	configs, err := loadServerConfigs(v)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := blocklist.NewSourcesFromConfig(v.Sub("blocklists"))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := loadSigningKeys(v)
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := signing.NewKeyring(keys)
+	if err != nil {
+		return nil, err
+	}
+	protectedSources, protectedCfg, _, err := loadProtectedContent(v)
+	if err != nil {
+		return nil, err
+	}
+	var protectedList *protected.List
+	if needsProtectedList(configs) {
+		protectedList, err = protected.NewList(store, protectedSources, protectedCfg)
+		if err != nil {
+			return nil, err
 		}
-		storeConfig := storeViper.Sub(storeType)
-		s, err := factory(storeConfig)
+	}
+	limits, err := loadRateLimits(v)
+	if err != nil {
+		return nil, err
+	}
+	limiter, err := ratelimit.NewLimiter(limits)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := proxyproto.NewTrusted(v.GetStringSlice("trusted_proxies"))
+	if err != nil {
+		return nil, err
+	}
+	authSource, authRefresh, _, err := loadUploadAuth(v)
+	if err != nil {
+		return nil, err
+	}
+	uploadAuth := reflector.NewAuth()
+	uploadAuth.SetSource(authSource, authRefresh)
+	eventsCfg, _, err := loadEvents(v)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := eventsCfg.Sinks()
+	if err != nil {
+		return nil, err
+	}
+	// without a Reloader to own them, the protected list and the emitter are shut down with the last server
+	emitter := events.NewEmitter(sinks...)
+	owned := &sharedDeps{refs: len(configs), shutdown: []func(){emitter.Shutdown}}
+	if protectedList != nil {
+		owned.shutdown = append(owned.shutdown, protectedList.Shutdown)
+	}
+	servers := make([]server.BlobServer, 0, len(configs))
+	for serverType, cfg := range configs {
+		// without a Reloader to own it there is no blocklist filter, only the reflector server blocks
+		s, err := newServer(store, serverType, cfg, serverDeps{blocklists: sources, protected: protectedList, signatures: keyring, limiter: limiter, proxies: proxies, uploadAuth: uploadAuth, events: emitter})
 		if err != nil {
-			return nil, errors.Err(err)
+			emitter.Shutdown()
+			return nil, err
 		}
-		//we only expect 1 store as the root, so let's return it
-		return s, nil
+		servers = append(servers, &sharingServer{BlobServer: s, deps: owned})
+	}
+	if len(servers) == 0 {
+		emitter.Shutdown()
+		return servers, nil
 	}
-	return nil, nil
+	if protectedList != nil {
+		protectedList.Start()
+	}
+	return servers, nil
 }
 
-func LoadServers(store store.BlobStore, path, file string) ([]server.BlobServer, error) {
-	v := viper.New()
-	v.SetConfigType("yaml")
-	v.AddConfigPath(path)
-	v.SetConfigName(file)
+// needsProtectedList returns true if a server that serves blobs is configured. The reflector server only
+// receives blobs, so it doesn't use the protected content list.
+func needsProtectedList(configs map[string]server.BlobServerConfig) bool {
+	for serverType := range configs {
+		if serverType != "reflector" {
+			return true
+		}
+	}
+	return false
+}
 
-	err := v.ReadInConfig()
-	if err != nil {
-		return nil, errors.Err(err)
+// sharedDeps are the objects shared by the servers created by LoadServers. They are shut down along with
+// the last of those servers.
+type sharedDeps struct {
+	mu       sync.Mutex
+	refs     int
+	shutdown []func()
+}
+
+func (d *sharedDeps) release() {
+	d.mu.Lock()
+	d.refs--
+	last := d.refs == 0
+	d.mu.Unlock()
+	if !last {
+		return
+	}
+	for _, shutdown := range d.shutdown {
+		shutdown()
 	}
+}
 
-	servers := make([]server.BlobServer, 0)
+// sharingServer is a server created by LoadServers. Shutting it down releases the objects it shares with the others.
+type sharingServer struct {
+	server.BlobServer
+	deps *sharedDeps
+	once sync.Once
+}
+
+func (s *sharingServer) Shutdown() {
+	s.BlobServer.Shutdown()
+	s.once.Do(s.deps.release)
+}
+
+// loadServerConfigs returns the config of each server in the servers section, keyed by server type
+func loadServerConfigs(v *viper.Viper) (map[string]server.BlobServerConfig, error) {
+	configs := make(map[string]server.BlobServerConfig)
 	serversViper := v.Sub("servers")
+	if serversViper == nil {
+		return configs, nil
+	}
 	for serverType := range serversViper.AllSettings() {
 		var cfg server.BlobServerConfig
 		err := serversViper.Sub(serverType).Unmarshal(&cfg)
 		if err != nil {
 			return nil, errors.Err(err)
 		}
-		switch serverType {
-		case "http":
-			servers = append(servers, http.NewServer(store, cfg.MaxConcurrentRequests, cfg.EdgeToken, fmt.Sprintf("%s:%d", cfg.Address, cfg.Port)))
-		case "http3":
-			servers = append(servers, http3.NewServer(store, cfg.MaxConcurrentRequests, fmt.Sprintf("%s:%d", cfg.Address, cfg.Port)))
-		case "peer":
-			servers = append(servers, peer.NewServer(store, fmt.Sprintf("%s:%d", cfg.Address, cfg.Port)))
-		default:
-			return nil, errors.Err("unknown server type: %s", serverType)
+		configs[serverType] = cfg
+	}
+	return configs, nil
+}
+
+// serverDeps are the objects shared by the servers of a node
+type serverDeps struct {
+	// blocklists are the sources the reflector server blocks in its store
+	blocklists []blocklist.Source
+	// filter is the blocklist the other servers enforce
+	filter *blocklist.Filter
+	// protected is the list of protected content
+	protected *protected.List
+	// signatures verifies the signed URLs of protected blobs
+	signatures *signing.Keyring
+	// limiter enforces the per client rate limits of every server
+	limiter *ratelimit.Limiter
+	// proxies are the load balancers trusted to send PROXY protocol headers
+	proxies *proxyproto.Trusted
+	// uploadAuth checks the upload tokens of the reflector server
+	uploadAuth *reflector.Auth
+	// events gets the stream_completed events of the reflector server
+	events *events.Emitter
+}
+
+// newServer creates a server of the given type. If the server enables the blocklist, the reflector server
+// blocks the hashes listed by the blocklist sources in its store, and the other servers refuse the blobs
+// blocked by the filter.
+func newServer(store store.BlobStore, serverType string, cfg server.BlobServerConfig, deps serverDeps) (server.BlobServer, error) {
+	filter := deps.filter
+	if !cfg.EnableBlocklist {
+		filter = nil
+	}
+	err := cfg.TLS.Validate()
+	if err != nil {
+		return nil, errors.Prefix(serverType+" server", err)
+	}
+	var proxies *proxyproto.Trusted
+	if cfg.ProxyProtocol {
+		if serverType == "http3" {
+			return nil, errors.Err("http3 server: the PROXY protocol is only supported over TCP")
 		}
+		if deps.proxies.Empty() {
+			return nil, errors.Err("%s server: the PROXY protocol needs trusted_proxies", serverType)
+		}
+		proxies = deps.proxies
+	}
+	switch serverType {
+	case "http":
+		s := http.NewServer(store, cfg.MaxConcurrentRequests, cfg.EdgeToken, net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port)))
+		s.Blocklist = filter
+		s.Protected = deps.protected
+		s.Signatures = deps.signatures
+		s.EnableStreams = cfg.EnableStreams
+		s.UploadToken = cfg.UploadToken
+		s.TLS = cfg.TLS
+		s.Queue = cfg.QueueConfig()
+		s.RateLimit = deps.limiter
+		s.ProxyProtocol = proxies
+		return s, nil
+	case "http3":
+		s := http3.NewServer(store, cfg.MaxConcurrentRequests, net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port)))
+		s.Blocklist = filter
+		s.Protected = deps.protected
+		s.Signatures = deps.signatures
+		s.UploadToken = cfg.UploadToken
+		s.TLS = cfg.TLS
+		s.Queue = cfg.QueueConfig()
+		s.RateLimit = deps.limiter
+		return s, nil
+	case "peer":
+		s := peer.NewServer(store, net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port)))
+		s.Blocklist = filter
+		s.Protected = deps.protected
+		s.Signatures = deps.signatures
+		s.TLS = cfg.TLS
+		s.RateLimit = deps.limiter
+		s.ProxyProtocol = proxies
+		s.MaxConnections = cfg.MaxConnections
+		s.MaxConnectionsPerIP = cfg.MaxConnectionsPerIP
+		if cfg.IdleTimeout > 0 {
+			s.IdleTimeout = cfg.IdleTimeout
+		}
+		if cfg.DrainTimeout > 0 {
+			s.DrainTimeout = cfg.DrainTimeout
+		}
+		return s, nil
+	case "reflector":
+		s := reflector.NewIngestionServer(store)
+		if cfg.Timeout > 0 {
+			s.Timeout = cfg.Timeout
+		}
+		s.MaxConnections = cfg.MaxConnections
+		s.EnableBlocklist = cfg.EnableBlocklist
+		s.BlocklistSources = deps.blocklists
+		s.RateLimit = deps.limiter
+		s.ProxyProtocol = proxies
+		s.Auth = deps.uploadAuth
+		s.Events = deps.events
+		return &ingestionServer{Server: s, address: net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port))}, nil
+	default:
+		return nil, errors.Err("unknown server type: %s", serverType)
 	}
-	return servers, nil
 }
 
-func LoadDatabase(path, file string) (*db.SQL, error) {
-	v := viper.New()
-	v.SetConfigType("yaml")
-	v.AddConfigPath(path)
-	v.SetConfigName(file)
+// loadSigningKeys returns the keys accepted in signed URLs, from the keys list of the url_signing section
+func loadSigningKeys(v *viper.Viper) ([]signing.Key, error) {
+	var keys []signing.Key
+	err := v.UnmarshalKey("url_signing.keys", &keys)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	return keys, nil
+}
 
-	err := v.ReadInConfig()
+// loadRateLimits returns the per client limits of the rate_limits section. Without one, nothing is limited.
+func loadRateLimits(v *viper.Viper) (ratelimit.Config, error) {
+	var cfg ratelimit.Config
+	err := v.UnmarshalKey("rate_limits", &cfg)
+	if err != nil {
+		return cfg, errors.Err(err)
+	}
+	return cfg, nil
+}
+
+// loadUploadAuth returns the source of the upload tokens of the upload_auth section, its refresh interval and
+// the serialized section. Without one, the source is nil and uploads need no token.
+func loadUploadAuth(v *viper.Viper) (reflector.TokenSource, time.Duration, string, error) {
+	section := v.Sub("upload_auth")
+	if section == nil {
+		return nil, 0, "", nil
+	}
+	var cfg reflector.AuthConfig
+	err := section.Unmarshal(&cfg)
+	if err != nil {
+		return nil, 0, "", errors.Err(err)
+	}
+	source, err := cfg.Source()
+	if err != nil {
+		return nil, 0, "", err
+	}
+	serialized, err := json.Marshal(v.Get("upload_auth"))
+	if err != nil {
+		return nil, 0, "", errors.Err(err)
+	}
+	return source, cfg.RefreshInterval, string(serialized), nil
+}
+
+// loadEvents returns the events section and its serialized form. Without one, there are no sinks.
+func loadEvents(v *viper.Viper) (events.Config, string, error) {
+	var cfg events.Config
+	section := v.Sub("events")
+	if section == nil {
+		return cfg, "", nil
+	}
+	err := section.Unmarshal(&cfg)
+	if err != nil {
+		return cfg, "", errors.Err(err)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return cfg, "", err
+	}
+	serialized, err := json.Marshal(v.Get("events"))
+	if err != nil {
+		return cfg, "", errors.Err(err)
+	}
+	return cfg, string(serialized), nil
+}
+
+// loadProtectedContent creates the sources of the protected_content section, falling back to the Odysee list,
+// and returns them along with the policy and the serialized section
+func loadProtectedContent(v *viper.Viper) ([]blocklist.Source, protected.Config, string, error) {
+	var cfg protected.Config
+	section := v.Sub("protected_content")
+	if section == nil {
+		return protected.DefaultSources(), cfg, "", nil
+	}
+	err := section.Unmarshal(&cfg)
+	if err != nil {
+		return nil, cfg, "", errors.Err(err)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return nil, cfg, "", err
+	}
+	sources, err := blocklist.NewSourcesFromConfig(section.Sub("sources"))
+	if err != nil {
+		return nil, cfg, "", errors.Prefix("protected_content", err)
+	}
+	if len(sources) == 0 {
+		sources = protected.DefaultSources()
+	}
+	serialized, err := json.Marshal(v.Get("protected_content"))
+	if err != nil {
+		return nil, cfg, "", errors.Err(err)
+	}
+	return sources, cfg, string(serialized), nil
+}
+
+// ingestionServer adapts the reflector ingestion server to the server.BlobServer interface
+type ingestionServer struct {
+	*reflector.Server
+	address string
+}
+
+func (s *ingestionServer) Start() error {
+	return s.Server.Start(s.address)
+}
+
+// LoadAdminConfig returns the admin section of the config file, or nil if there is none
+func LoadAdminConfig(path, file string) (*admin.Config, error) {
+	v, err := readConfig(path, file)
+	if err != nil {
+		return nil, err
+	}
+	adminViper := v.Sub("admin")
+	if adminViper == nil {
+		return nil, nil
+	}
+	var cfg admin.Config
+	err = adminViper.Unmarshal(&cfg)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
+	if cfg.Token == "" {
+		return nil, errors.Err("admin server requires a token")
+	}
+	return &cfg, nil
+}
+
+func LoadDatabase(path, file string) (*db.SQL, error) {
+	v, err := readConfig(path, file)
+	if err != nil {
+		return nil, err
+	}
 
 	dbConfig := v.Sub("database")
 	if dbConfig == nil {
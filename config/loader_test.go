@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/server/http"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, yaml string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.yaml"), []byte(yaml), 0600))
+	return dir
+}
+
+func TestLoadServers_ProtectedList(t *testing.T) {
+	st := store.NewMemStore(store.MemParams{Name: "test"})
+	protectedFile := filepath.Join(t.TempDir(), "protected.txt")
+	require.NoError(t, os.WriteFile(protectedFile, nil, 0600))
+
+	dir := writeConfig(t, `
+servers:
+  http:
+    port: 5569
+  reflector:
+    port: 5566
+protected_content:
+  sources:
+    local:
+      file:
+        path: `+protectedFile+`
+`)
+	servers, err := LoadServers(st, dir, "test")
+	require.NoError(t, err)
+	require.Len(t, servers, 2)
+	for _, s := range servers {
+		if h, ok := s.(*sharingServer).BlobServer.(*http.Server); ok {
+			assert.NotNil(t, h.Protected, "the http server should get the protected list")
+		}
+	}
+	for _, s := range servers {
+		s.Shutdown()
+	}
+	assert.Zero(t, servers[0].(*sharingServer).deps.refs)
+
+	// the reflector server doesn't serve blobs, so it doesn't need the list
+	assert.False(t, needsProtectedList(map[string]server.BlobServerConfig{"reflector": {}}))
+}
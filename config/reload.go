@@ -0,0 +1,563 @@
+package config
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lbryio/reflector.go/blocklist"
+	"github.com/lbryio/reflector.go/events"
+	"github.com/lbryio/reflector.go/protected"
+	"github.com/lbryio/reflector.go/proxyproto"
+	"github.com/lbryio/reflector.go/ratelimit"
+	"github.com/lbryio/reflector.go/reflector"
+	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/signing"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Reloader owns the store tree and the blob servers of a running command, and can rebuild them from the
+// config file without restarting the process. Servers are handed a store.ReloadableStore, so a new store
+// tree can be swapped in under them while they keep running.
+type Reloader struct {
+	store    *store.ReloadableStore
+	servers  map[string]*runningServer
+	defaults map[string]server.BlobServerConfig
+	// blocklists are the configured blocklist sources. blocklistConfig is their serialized config, used to detect changes
+	blocklists      []blocklist.Source
+	blocklistConfig string
+	// filter is the in-memory blocklist shared by the blob servers that enable the blocklist
+	filter            *blocklist.Filter
+	filterConfig      string
+	blocklistDisabled bool
+	// protected is the list of protected content shared by the blob servers
+	protected         *protected.List
+	protectedSources  []blocklist.Source
+	protectedSettings protected.Config
+	protectedConfig   string
+	// protectedListConfig is the config r.protected was created with
+	protectedListConfig string
+	// signatures holds the url signing keys. It is updated in place, so keys rotate without restarting servers
+	signatures *signing.Keyring
+	// limiter enforces the rate limits. Like the keyring, it is updated in place
+	limiter *ratelimit.Limiter
+	// proxies are the trusted PROXY protocol senders, also updated in place
+	proxies *proxyproto.Trusted
+	// uploadAuth checks the upload tokens of the reflector server. Its source is only replaced when
+	// uploadAuthConfig changes, so the quotas used so far are kept
+	uploadAuth       *reflector.Auth
+	uploadAuthConfig string
+	// events sends the events of the reflector server to the sinks of eventsConfig. Its sinks are only
+	// replaced when eventsConfig changes
+	events       *events.Emitter
+	eventsConfig string
+	path         string
+	file         string
+	mu           sync.Mutex
+}
+
+type runningServer struct {
+	server          server.BlobServer
+	config          server.BlobServerConfig
+	blocklistConfig string
+	protectedConfig string
+}
+
+// NewReloader loads the stores defined in the config file and returns an initialized Reloader pointer.
+func NewReloader(path, file string) (*Reloader, error) {
+	s, err := LoadStores(path, file)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, errors.Err("no store defined in %s", file)
+	}
+	return &Reloader{
+		store:      store.NewReloadableStore(s),
+		servers:    make(map[string]*runningServer),
+		defaults:   make(map[string]server.BlobServerConfig),
+		signatures: &signing.Keyring{},
+		limiter:    &ratelimit.Limiter{},
+		proxies:    &proxyproto.Trusted{},
+		uploadAuth: reflector.NewAuth(),
+		events:     events.NewEmitter(),
+		path:       path,
+		file:       file,
+	}, nil
+}
+
+// SetDefaultServer runs a server of the given type with cfg whenever the config file doesn't define one.
+// It must be called before StartServers.
+func (r *Reloader) SetDefaultServer(serverType string, cfg server.BlobServerConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaults[serverType] = cfg
+}
+
+// Store returns the store that servers should use. It always points to the latest loaded store tree.
+func (r *Reloader) Store() store.BlobStore {
+	return r.store
+}
+
+// DisableBlocklists turns the blocklist off for every server, whatever the config file says.
+// It must be called before StartServers.
+func (r *Reloader) DisableBlocklists() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blocklistDisabled = true
+}
+
+// StartServers starts the servers defined in the config file
+func (r *Reloader) StartServers() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, err := readConfig(r.path, r.file)
+	if err != nil {
+		return err
+	}
+	configs, err := loadServerConfigs(v)
+	if err != nil {
+		return err
+	}
+	r.blocklists, r.blocklistConfig, err = loadBlocklists(v)
+	if err != nil {
+		return err
+	}
+	err = r.loadSigningKeys(v)
+	if err != nil {
+		return err
+	}
+	r.protectedSources, r.protectedSettings, r.protectedConfig, err = loadProtectedContent(v)
+	if err != nil {
+		return err
+	}
+	limits, err := loadRateLimits(v)
+	if err != nil {
+		return err
+	}
+	err = r.limiter.SetConfig(limits)
+	if err != nil {
+		return err
+	}
+	err = r.proxies.Set(v.GetStringSlice("trusted_proxies"))
+	if err != nil {
+		return err
+	}
+	authSource, authRefresh, authConfig, err := loadUploadAuth(v)
+	if err != nil {
+		return err
+	}
+	r.setUploadAuth(authSource, authRefresh, authConfig)
+	eventsCfg, eventsConfig, err := loadEvents(v)
+	if err != nil {
+		return err
+	}
+	err = r.setEvents(eventsCfg, eventsConfig)
+	if err != nil {
+		return err
+	}
+	state := serverState{
+		blocklists:        r.blocklists,
+		blocklistConfig:   r.blocklistConfig,
+		protectedSources:  r.protectedSources,
+		protectedSettings: r.protectedSettings,
+		protectedConfig:   r.protectedConfig,
+	}
+	changes, err := r.prepareServers(configs, state)
+	if err != nil {
+		return err
+	}
+	return r.applyServers(state, changes)
+}
+
+// Reload re-reads the config file, swaps in the new store tree and restarts the servers whose config changed.
+// Stores whose config did not change are carried over to the new tree as they are.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, err := readConfig(r.path, r.file)
+	if err != nil {
+		return err
+	}
+	// parse the server configs first so a broken servers section doesn't leave us with a half applied reload
+	configs, err := loadServerConfigs(v)
+	if err != nil {
+		return err
+	}
+	blocklists, blocklistConfig, err := loadBlocklists(v)
+	if err != nil {
+		return err
+	}
+	keys, err := loadSigningKeys(v)
+	if err != nil {
+		return err
+	}
+	// check the keys before swapping anything in
+	_, err = signing.NewKeyring(keys)
+	if err != nil {
+		return err
+	}
+	protectedSources, protectedSettings, protectedConfig, err := loadProtectedContent(v)
+	if err != nil {
+		return err
+	}
+	limits, err := loadRateLimits(v)
+	if err != nil {
+		return err
+	}
+	_, err = ratelimit.NewLimiter(limits)
+	if err != nil {
+		return err
+	}
+	_, err = proxyproto.NewTrusted(v.GetStringSlice("trusted_proxies"))
+	if err != nil {
+		return err
+	}
+	authSource, authRefresh, authConfig, err := loadUploadAuth(v)
+	if err != nil {
+		return err
+	}
+	eventsCfg, eventsConfig, err := loadEvents(v)
+	if err != nil {
+		return err
+	}
+	tree, err := loadStores(v)
+	if err != nil {
+		return err
+	}
+	if tree == nil {
+		return errors.Err("no store defined in %s", r.file)
+	}
+
+	// everything that can fail is created before anything is swapped in, so a failed reload leaves the
+	// running servers and stores as they were
+	sinks, sinksChanged, err := r.newSinks(eventsCfg, eventsConfig)
+	if err != nil {
+		tree.Abort()
+		return err
+	}
+	state := serverState{
+		blocklists:        blocklists,
+		blocklistConfig:   blocklistConfig,
+		protectedSources:  protectedSources,
+		protectedSettings: protectedSettings,
+		protectedConfig:   protectedConfig,
+	}
+	changes, err := r.prepareServers(configs, state)
+	if err != nil {
+		tree.Abort()
+		closeSinks(sinks)
+		return err
+	}
+
+	r.store.Swap(tree.Store)
+	tree.Commit()
+	log.Infoln("store tree reloaded")
+	err = r.signatures.SetKeys(keys)
+	if err != nil {
+		return err
+	}
+	err = r.limiter.SetConfig(limits)
+	if err != nil {
+		return err
+	}
+	err = r.proxies.Set(v.GetStringSlice("trusted_proxies"))
+	if err != nil {
+		return err
+	}
+	r.setUploadAuth(authSource, authRefresh, authConfig)
+	if sinksChanged {
+		r.events.SetSinks(sinks)
+		r.eventsConfig = eventsConfig
+		log.Infoln("event sinks reloaded")
+	}
+	return r.applyServers(state, changes)
+}
+
+// newSinks creates the event sinks if their config changed. It returns false if the current sinks are kept.
+func (r *Reloader) newSinks(cfg events.Config, config string) ([]events.Sink, bool, error) {
+	if config == r.eventsConfig {
+		return nil, false, nil
+	}
+	sinks, err := cfg.Sinks()
+	if err != nil {
+		return nil, false, err
+	}
+	return sinks, true, nil
+}
+
+// closeSinks closes sinks that were created but never used
+func closeSinks(sinks []events.Sink) {
+	for _, sink := range sinks {
+		if closer, ok := sink.(interface{ Close() error }); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
+// setEvents gives the emitter new sinks if their config changed
+func (r *Reloader) setEvents(cfg events.Config, config string) error {
+	sinks, changed, err := r.newSinks(cfg, config)
+	if err != nil || !changed {
+		return err
+	}
+	r.events.SetSinks(sinks)
+	r.eventsConfig = config
+	log.Infoln("event sinks reloaded")
+	return nil
+}
+
+// setUploadAuth gives the upload tokens a new source if their config changed
+func (r *Reloader) setUploadAuth(source reflector.TokenSource, refreshInterval time.Duration, config string) {
+	if config == r.uploadAuthConfig {
+		return
+	}
+	r.uploadAuth.SetSource(source, refreshInterval)
+	r.uploadAuthConfig = config
+	log.Infoln("upload tokens reloaded")
+}
+
+// loadSigningKeys loads the url signing keys into the keyring shared by the servers
+func (r *Reloader) loadSigningKeys(v *viper.Viper) error {
+	keys, err := loadSigningKeys(v)
+	if err != nil {
+		return err
+	}
+	return r.signatures.SetKeys(keys)
+}
+
+// loadBlocklists creates the blocklist sources defined in the blocklists section, and returns them along with
+// their serialized config
+func loadBlocklists(v *viper.Viper) ([]blocklist.Source, string, error) {
+	sources, err := blocklist.NewSourcesFromConfig(v.Sub("blocklists"))
+	if err != nil {
+		return nil, "", err
+	}
+	serialized, err := json.Marshal(v.Get("blocklists"))
+	if err != nil {
+		return nil, "", errors.Err(err)
+	}
+	return sources, string(serialized), nil
+}
+
+// serverState is the part of the config the servers, the blocklist filter and the protected list are created from
+type serverState struct {
+	blocklists        []blocklist.Source
+	blocklistConfig   string
+	protectedSources  []blocklist.Source
+	protectedSettings protected.Config
+	protectedConfig   string
+}
+
+// serverChanges are the servers to stop and the ones to start, created but not started yet, along with the
+// blocklist filter and the protected list they use
+type serverChanges struct {
+	stop  []string
+	start map[string]*runningServer
+	// filter and protected replace the current ones if replaceFilter and replaceProtected are set. They may be nil.
+	filter           *blocklist.Filter
+	replaceFilter    bool
+	protected        *protected.List
+	replaceProtected bool
+}
+
+// prepareServers creates the servers that are missing or whose config changed, without starting or stopping
+// anything, so that nothing is left half done if one of them can't be created
+func (r *Reloader) prepareServers(configs map[string]server.BlobServerConfig, state serverState) (*serverChanges, error) {
+	for serverType, cfg := range r.defaults {
+		if _, ok := configs[serverType]; !ok {
+			configs[serverType] = cfg
+		}
+	}
+	if r.blocklistDisabled {
+		for serverType, cfg := range configs {
+			cfg.EnableBlocklist = false
+			configs[serverType] = cfg
+		}
+	}
+	changes := &serverChanges{start: make(map[string]*runningServer), filter: r.filter, protected: r.protected}
+	r.prepareFilter(configs, state, changes)
+	err := r.prepareProtected(configs, state, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	for serverType, running := range r.servers {
+		cfg, ok := configs[serverType]
+		if ok && cfg == running.config && (!cfg.EnableBlocklist || running.blocklistConfig == state.blocklistConfig) &&
+			(serverType == "reflector" || running.protectedConfig == state.protectedConfig) {
+			continue
+		}
+		changes.stop = append(changes.stop, serverType)
+	}
+	for serverType, cfg := range configs {
+		if _, ok := r.servers[serverType]; ok && !slices.Contains(changes.stop, serverType) {
+			continue
+		}
+		deps := serverDeps{blocklists: state.blocklists, filter: changes.filter, protected: changes.protected, signatures: r.signatures, limiter: r.limiter, proxies: r.proxies, uploadAuth: r.uploadAuth, events: r.events}
+		s, err := newServer(r.store, serverType, cfg, deps)
+		if err != nil {
+			return nil, err
+		}
+		changes.start[serverType] = &runningServer{server: s, config: cfg, blocklistConfig: state.blocklistConfig, protectedConfig: state.protectedConfig}
+	}
+	return changes, nil
+}
+
+// applyServers stops the servers that were removed or changed and starts the prepared ones. A changed server
+// whose replacement fails to start, e.g. because its new port is taken, is started again with its previous config.
+func (r *Reloader) applyServers(state serverState, changes *serverChanges) error {
+	r.blocklists, r.blocklistConfig = state.blocklists, state.blocklistConfig
+	r.protectedSources, r.protectedSettings, r.protectedConfig = state.protectedSources, state.protectedSettings, state.protectedConfig
+
+	previous := make(map[string]*runningServer)
+	for _, serverType := range changes.stop {
+		log.Infof("stopping %s server", serverType)
+		r.servers[serverType].server.Shutdown()
+		previous[serverType] = r.servers[serverType]
+		delete(r.servers, serverType)
+	}
+	if changes.replaceFilter {
+		if r.filter != nil {
+			r.filter.Shutdown()
+		}
+		r.filter, r.filterConfig = changes.filter, state.blocklistConfig
+		if r.filter != nil {
+			r.filter.Start()
+		}
+	}
+	if changes.replaceProtected {
+		if r.protected != nil {
+			r.protected.Shutdown()
+		}
+		r.protected, r.protectedListConfig = changes.protected, state.protectedConfig
+		if r.protected != nil {
+			r.protected.Start()
+		}
+	}
+
+	var startErr error
+	for serverType, running := range changes.start {
+		err := running.server.Start()
+		if err == nil {
+			r.servers[serverType] = running
+			continue
+		}
+		err = errors.Prefix("starting "+serverType+" server", err)
+		log.Errorln(err)
+		if startErr == nil {
+			startErr = err
+		}
+		old, ok := previous[serverType]
+		if !ok {
+			continue
+		}
+		deps := serverDeps{blocklists: r.blocklists, filter: r.filter, protected: r.protected, signatures: r.signatures, limiter: r.limiter, proxies: r.proxies, uploadAuth: r.uploadAuth, events: r.events}
+		s, err := newServer(r.store, serverType, old.config, deps)
+		if err == nil {
+			err = s.Start()
+		}
+		if err != nil {
+			log.Errorln(errors.Prefix("restarting "+serverType+" server with its previous config", err))
+			continue
+		}
+		r.servers[serverType] = &runningServer{server: s, config: old.config, blocklistConfig: r.blocklistConfig, protectedConfig: r.protectedConfig}
+	}
+	return startErr
+}
+
+// prepareProtected creates the protected content list if a blob server needs it and it is missing or its config changed.
+// The reflector server only receives blobs, so it doesn't use the list.
+func (r *Reloader) prepareProtected(configs map[string]server.BlobServerConfig, state serverState, changes *serverChanges) error {
+	needed := needsProtectedList(configs)
+	if r.protected != nil && (!needed || r.protectedListConfig != state.protectedConfig) {
+		changes.protected = nil
+		changes.replaceProtected = true
+	}
+	if needed && changes.protected == nil {
+		l, err := protected.NewList(r.store, state.protectedSources, state.protectedSettings)
+		if err != nil {
+			return err
+		}
+		changes.protected = l
+		changes.replaceProtected = true
+	}
+	return nil
+}
+
+// prepareFilter creates the blocklist filter if a blob server needs it and it is missing or the blocklists changed.
+// The reflector server blocks through its store instead, so it doesn't use the filter.
+func (r *Reloader) prepareFilter(configs map[string]server.BlobServerConfig, state serverState, changes *serverChanges) {
+	needed := false
+	for serverType, cfg := range configs {
+		if cfg.EnableBlocklist && serverType != "reflector" {
+			needed = true
+		}
+	}
+	if r.filter != nil && (!needed || r.filterConfig != state.blocklistConfig) {
+		changes.filter = nil
+		changes.replaceFilter = true
+	}
+	if needed && changes.filter == nil {
+		sources := state.blocklists
+		if len(sources) == 0 {
+			sources = blocklist.DefaultSources()
+		}
+		changes.filter = blocklist.NewFilter(r.store, sources)
+		changes.replaceFilter = true
+	}
+}
+
+// ReloadBlocklists triggers a blocklist update on the blocklist filter and on every running server that watches a blocklist
+func (r *Reloader) ReloadBlocklists() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reloaded := 0
+	if r.filter != nil {
+		r.filter.Reload()
+		reloaded++
+	}
+	for serverType, running := range r.servers {
+		bl, ok := running.server.(interface{ ReloadBlocklist() error })
+		if !ok || !running.config.EnableBlocklist {
+			continue
+		}
+		err := bl.ReloadBlocklist()
+		if err != nil {
+			return errors.Prefix(serverType, err)
+		}
+		reloaded++
+	}
+	if reloaded == 0 {
+		return errors.Err("no running server has a blocklist enabled")
+	}
+	return nil
+}
+
+// Shutdown stops all servers and then shuts down the store
+func (r *Reloader) Shutdown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for serverType, running := range r.servers {
+		running.server.Shutdown()
+		delete(r.servers, serverType)
+	}
+	if r.filter != nil {
+		r.filter.Shutdown()
+	}
+	if r.protected != nil {
+		r.protected.Shutdown()
+	}
+	r.events.Shutdown()
+	r.store.Shutdown()
+}
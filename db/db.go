@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"regexp"
 	"runtime"
 	"strings"
 	"time"
@@ -87,6 +88,11 @@ func (s *SQL) Connect(dsn string) error {
 	return errors.Err(s.conn.Ping())
 }
 
+// SetConnection makes the SQL use an open database connection instead of connecting with Connect
+func (s *SQL) SetConnection(conn *sql.DB) {
+	s.conn = conn
+}
+
 // AddBlob adds a blob to the database.
 func (s *SQL) AddBlob(hash string, length int, isStored bool) error {
 	if s.conn == nil {
@@ -466,15 +472,249 @@ func (s *SQL) Count() (int, error) {
 	return count, errors.Err(err)
 }
 
-// Block will mark a blob as blocked
-func (s *SQL) Block(hash string) error {
-	query := "INSERT IGNORE INTO blocked SET hash = ?"
-	args := []interface{}{hash}
+// BlockRecord says when, why and by whom a hash was blocked
+type BlockRecord struct {
+	Hash         string
+	Reason       string
+	Source       string    // who blocked it, e.g. a blocklist source or an operator
+	StreamSdHash string    // set on content blobs that were blocked because their stream was blocked
+	BlockedAt    time.Time // set by the db
+}
+
+// BlockEvent is an entry of the block history
+type BlockEvent struct {
+	Hash      string
+	Action    string // BlockActionBlock or BlockActionUnblock
+	Reason    string
+	Source    string
+	CreatedAt time.Time
+}
+
+const (
+	BlockActionBlock   = "block"
+	BlockActionUnblock = "unblock"
+)
+
+// Block will mark a blob as blocked and record it in the block history. Blocking a hash that is already blocked does nothing.
+func (s *SQL) Block(record BlockRecord) error {
+	if s.conn == nil {
+		return errors.Err("not connected")
+	}
+
+	var streamSdHash null.String
+	if record.StreamSdHash != "" {
+		streamSdHash = null.StringFrom(record.StreamSdHash)
+	}
+
+	return withTx(s.conn, func(tx *sql.Tx) error {
+		query := "INSERT IGNORE INTO blocked (hash, reason, source, stream_sd_hash) VALUES (?,?,?,?)"
+		args := []interface{}{record.Hash, record.Reason, record.Source, streamSdHash}
+		s.logQuery(query, args...)
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return errors.Err(err)
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return errors.Err(err)
+		}
+		if inserted == 0 {
+			return nil
+		}
+		return s.addBlockEvent(tx, BlockEvent{Hash: record.Hash, Action: BlockActionBlock, Reason: record.Reason, Source: record.Source})
+	})
+}
+
+// Unblock removes the hash from the blocked list along with the content blobs that were blocked with it, and records
+// it in the block history. Content blobs that are also part of another blocked stream stay blocked, and are moved to
+// that stream so that unblocking it releases them. It returns the hashes that were unblocked.
+func (s *SQL) Unblock(hash, reason, source string) ([]string, error) {
+	if s.conn == nil {
+		return nil, errors.Err("not connected")
+	}
+
+	var unblocked []string
+	err := withTx(s.conn, func(tx *sql.Tx) error {
+		query := "SELECT hash FROM blocked WHERE hash = ? OR stream_sd_hash = ? FOR UPDATE"
+		candidates, err := s.queryHashesTx(tx, query, hash, hash)
+		if err != nil {
+			return err
+		}
+
+		// a content blob row only keeps the first stream it was blocked with, so look for the others
+		var contentBlobs []string
+		for _, h := range candidates {
+			if h != hash {
+				contentBlobs = append(contentBlobs, h)
+			}
+		}
+		stillBlocked, err := s.blockedStreamsOf(tx, hash, contentBlobs)
+		if err != nil {
+			return err
+		}
+		for _, h := range candidates {
+			if sdHash, ok := stillBlocked[h]; ok {
+				query = "UPDATE blocked SET stream_sd_hash = ? WHERE hash = ?"
+				s.logQuery(query, sdHash, h)
+				_, err = tx.Exec(query, sdHash, h)
+				if err != nil {
+					return errors.Err(err)
+				}
+				continue
+			}
+			unblocked = append(unblocked, h)
+		}
+		if len(unblocked) == 0 {
+			return nil
+		}
+
+		query = "DELETE FROM blocked WHERE hash IN (" + qt.Qs(len(unblocked)) + ")"
+		args := make([]interface{}, len(unblocked))
+		for i, h := range unblocked {
+			args[i] = h
+		}
+		s.logQuery(query, args...)
+		_, err = tx.Exec(query, args...)
+		if err != nil {
+			return errors.Err(err)
+		}
+		for _, h := range unblocked {
+			err = s.addBlockEvent(tx, BlockEvent{Hash: h, Action: BlockActionUnblock, Reason: reason, Source: source})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return unblocked, err
+}
+
+// blockedStreamsOf maps each of the hashes that is part of a blocked stream other than the one with the given sd hash
+// to the sd hash of that stream
+func (s *SQL) blockedStreamsOf(tx *sql.Tx, sdHash string, hashes []string) (map[string]string, error) {
+	streams := make(map[string]string)
+	if len(hashes) == 0 {
+		return streams, nil
+	}
+
+	query := `
+		SELECT b.hash, sdb.hash FROM blob_ b
+		INNER JOIN stream_blob sb ON b.id = sb.blob_id
+		INNER JOIN stream s ON s.id = sb.stream_id
+		INNER JOIN blob_ sdb ON sdb.id = s.sd_blob_id AND sdb.hash != ?
+		INNER JOIN blocked bl ON bl.hash = sdb.hash
+		WHERE b.hash IN (` + qt.Qs(len(hashes)) + `)
+	`
+	args := make([]interface{}, 0, len(hashes)+1)
+	args = append(args, sdHash)
+	for _, hash := range hashes {
+		args = append(args, hash)
+	}
+	s.logQuery(query, args...)
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	defer closeRows(rows)
+	for rows.Next() {
+		var hash, streamSdHash string
+		err = rows.Scan(&hash, &streamSdHash)
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		streams[hash] = streamSdHash
+	}
+	return streams, errors.Err(rows.Err())
+}
+
+// queryHashesTx runs a query that selects a single hash column inside a transaction
+func (s *SQL) queryHashesTx(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	s.logQuery(query, args...)
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	defer closeRows(rows)
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, errors.Err(rows.Err())
+}
+
+func (s *SQL) addBlockEvent(tx *sql.Tx, event BlockEvent) error {
+	query := "INSERT INTO blocked_history (hash, action, reason, source) VALUES (?,?,?,?)"
+	args := []interface{}{event.Hash, event.Action, event.Reason, event.Source}
 	s.logQuery(query, args...)
-	_, err := s.conn.Exec(query, args...)
+	_, err := tx.Exec(query, args...)
 	return errors.Err(err)
 }
 
+// ListBlocked returns the block records of every blocked hash, most recent first. Content blobs blocked along with their
+// stream are left out unless withContentBlobs is set.
+func (s *SQL) ListBlocked(withContentBlobs bool) ([]BlockRecord, error) {
+	if s.conn == nil {
+		return nil, errors.Err("not connected")
+	}
+
+	query := "SELECT hash, reason, source, stream_sd_hash, blocked_at FROM blocked"
+	if !withContentBlobs {
+		query += " WHERE stream_sd_hash IS NULL"
+	}
+	query += " ORDER BY blocked_at DESC"
+	s.logQuery(query)
+	rows, err := s.conn.Query(query)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	defer closeRows(rows)
+
+	var records []BlockRecord
+	for rows.Next() {
+		var r BlockRecord
+		var streamSdHash null.String
+		err = rows.Scan(&r.Hash, &r.Reason, &r.Source, &streamSdHash, &r.BlockedAt)
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		r.StreamSdHash = streamSdHash.String
+		records = append(records, r)
+	}
+	return records, errors.Err(rows.Err())
+}
+
+// BlockHistory returns the block and unblock events of a hash, oldest first
+func (s *SQL) BlockHistory(hash string) ([]BlockEvent, error) {
+	if s.conn == nil {
+		return nil, errors.Err("not connected")
+	}
+
+	query := "SELECT hash, action, reason, source, created_at FROM blocked_history WHERE hash = ? ORDER BY id"
+	s.logQuery(query, hash)
+	rows, err := s.conn.Query(query, hash)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	defer closeRows(rows)
+
+	var events []BlockEvent
+	for rows.Next() {
+		var e BlockEvent
+		err = rows.Scan(&e.Hash, &e.Action, &e.Reason, &e.Source, &e.CreatedAt)
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		events = append(events, e)
+	}
+	return events, errors.Err(rows.Err())
+}
+
 // GetBlocked will return a list of blocked hashes
 func (s *SQL) GetBlocked() (map[string]bool, error) {
 	query := "SELECT hash FROM blocked"
@@ -548,6 +788,143 @@ func (s *SQL) MissingBlobsForKnownStream(sdHash string) ([]string, error) {
 	return missingBlobs, errors.Err(err)
 }
 
+// identifierRegex matches the table and column names accepted by HashesFromTable
+var identifierRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// HashesFromTable returns every hash in the given column of a table. It lets operators maintain hash lists
+// (e.g. protected streams) in their own tables.
+func (s *SQL) HashesFromTable(table, column string) ([]string, error) {
+	if s.conn == nil {
+		return nil, errors.Err("not connected")
+	}
+	if !identifierRegex.MatchString(table) || !identifierRegex.MatchString(column) {
+		return nil, errors.Err("invalid table or column name")
+	}
+
+	return s.queryHashes(fmt.Sprintf("SELECT `%s` FROM `%s`", column, table))
+}
+
+// UploadToken is a token allowed to upload to the reflector server, with the daily quotas of its uploader
+type UploadToken struct {
+	Name       string // uploader the token belongs to
+	Token      string
+	DailyBytes int64 // 0 means no limit
+	DailyBlobs int64 // 0 means no limit
+}
+
+// UploadTokens returns every upload token in a table with name, token, daily_bytes and daily_blobs columns
+func (s *SQL) UploadTokens(table string) ([]UploadToken, error) {
+	if s.conn == nil {
+		return nil, errors.Err("not connected")
+	}
+	if !identifierRegex.MatchString(table) {
+		return nil, errors.Err("invalid table name")
+	}
+
+	query := fmt.Sprintf("SELECT name, token, daily_bytes, daily_blobs FROM `%s`", table)
+	s.logQuery(query)
+	rows, err := s.conn.Query(query)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	defer closeRows(rows)
+
+	var tokens []UploadToken
+	for rows.Next() {
+		var t UploadToken
+		err = rows.Scan(&t.Name, &t.Token, &t.DailyBytes, &t.DailyBlobs)
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, errors.Err(rows.Err())
+}
+
+// StreamBlobs returns the content blobs of the stream with the given sd hash, whether they are stored or not.
+// It returns nothing if the stream is not known.
+func (s *SQL) StreamBlobs(sdHash string) ([]string, error) {
+	if s.conn == nil {
+		return nil, errors.Err("not connected")
+	}
+
+	query := `
+		SELECT b.hash FROM blob_ b
+		INNER JOIN stream_blob sb ON b.id = sb.blob_id
+		INNER JOIN stream s ON s.id = sb.stream_id
+		INNER JOIN blob_ sdb ON sdb.id = s.sd_blob_id AND sdb.hash = ?
+	`
+	return s.queryHashes(query, sdHash)
+}
+
+// UnsharedBlobs returns the blobs from hashes that are not part of any stream other than the one with the given
+// sd hash, ignoring streams whose sd hash is blocked
+func (s *SQL) UnsharedBlobs(sdHash string, hashes []string) ([]string, error) {
+	if s.conn == nil {
+		return nil, errors.Err("not connected")
+	}
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT DISTINCT b.hash FROM blob_ b
+		INNER JOIN stream_blob sb ON b.id = sb.blob_id
+		INNER JOIN stream s ON s.id = sb.stream_id
+		INNER JOIN blob_ sdb ON sdb.id = s.sd_blob_id AND sdb.hash != ?
+		LEFT JOIN blocked bl ON bl.hash = sdb.hash
+		WHERE bl.hash IS NULL AND b.hash IN (` + qt.Qs(len(hashes)) + `)
+	`
+	args := make([]interface{}, 0, len(hashes)+1)
+	args = append(args, sdHash)
+	for _, hash := range hashes {
+		args = append(args, hash)
+	}
+	shared, err := s.queryHashes(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	isShared := make(map[string]bool, len(shared))
+	for _, hash := range shared {
+		isShared[hash] = true
+	}
+	var unshared []string
+	for _, hash := range hashes {
+		if !isShared[hash] {
+			unshared = append(unshared, hash)
+		}
+	}
+	return unshared, nil
+}
+
+// queryHashes runs a query that selects a single hash column
+func (s *SQL) queryHashes(query string, args ...interface{}) ([]string, error) {
+	s.logQuery(query, args...)
+
+	rows, err := s.conn.Query(query, args...)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	defer closeRows(rows)
+
+	var hashes []string
+	var hash string
+	for rows.Next() {
+		err = rows.Scan(&hash)
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	return hashes, nil
+}
+
 // AddSDBlob insert the SD blob and all the content blobs. The content blobs are marked as "not stored",
 // but they are tracked so reflector knows what it is missing.
 func (s *SQL) AddSDBlob(sdHash string, sdBlobLength int, sdBlob SdBlob) error {
@@ -774,7 +1151,39 @@ CREATE TABLE stream_blob (
 
 CREATE TABLE blocked (
   hash char(96) NOT NULL,
-  PRIMARY KEY (hash)
+  reason varchar(255) NOT NULL DEFAULT '',
+  source varchar(255) NOT NULL DEFAULT '',
+  stream_sd_hash char(96) NULL DEFAULT NULL,
+  blocked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (hash),
+  KEY blocked_stream_sd_hash_idx (stream_sd_hash)
 );
 
+CREATE TABLE blocked_history (
+  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  hash char(96) NOT NULL,
+  action ENUM('block','unblock') NOT NULL,
+  reason varchar(255) NOT NULL DEFAULT '',
+  source varchar(255) NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY blocked_history_hash_idx (hash)
+);
+
+CREATE TABLE upload_token (
+  name varchar(255) NOT NULL,
+  token varchar(255) NOT NULL,
+  daily_bytes bigint(20) unsigned NOT NULL DEFAULT 0,
+  daily_blobs bigint(20) unsigned NOT NULL DEFAULT 0,
+  PRIMARY KEY (token)
+);
+
+-- upgrading an existing blocked table (required, see Upgrading in the readme), then create blocked_history as above:
+ALTER TABLE blocked
+  ADD COLUMN reason varchar(255) NOT NULL DEFAULT '',
+  ADD COLUMN source varchar(255) NOT NULL DEFAULT '',
+  ADD COLUMN stream_sd_hash char(96) NULL DEFAULT NULL,
+  ADD COLUMN blocked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ADD KEY blocked_stream_sd_hash_idx (stream_sd_hash);
+
 */
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockSQL(t *testing.T) (*SQL, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	s := &SQL{}
+	s.SetConnection(conn)
+	return s, mock
+}
+
+func TestSQL_StreamBlobs(t *testing.T) {
+	s, mock := newMockSQL(t)
+	mock.ExpectQuery(regexp.QuoteMeta("INNER JOIN blob_ sdb ON sdb.id = s.sd_blob_id AND sdb.hash = ?")).
+		WithArgs("sd").
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow("a").AddRow("b"))
+
+	hashes, err := s.StreamBlobs("sd")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, hashes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQL_UnsharedBlobs(t *testing.T) {
+	s, mock := newMockSQL(t)
+	// b is also part of a stream that isn't blocked
+	mock.ExpectQuery(regexp.QuoteMeta("LEFT JOIN blocked bl ON bl.hash = sdb.hash")).
+		WithArgs("sd", "a", "b", "c").
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow("b"))
+
+	unshared, err := s.UnsharedBlobs("sd", []string{"a", "b", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, unshared)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// nothing to check, so no query
+	unshared, err = s.UnsharedBlobs("sd", nil)
+	require.NoError(t, err)
+	assert.Empty(t, unshared)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQL_Unblock(t *testing.T) {
+	s, mock := newMockSQL(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT hash FROM blocked WHERE hash = ? OR stream_sd_hash = ? FOR UPDATE")).
+		WithArgs("sd", "sd").
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow("sd").AddRow("a").AddRow("b"))
+	// b is also part of the blocked stream other_sd
+	mock.ExpectQuery(regexp.QuoteMeta("INNER JOIN blocked bl ON bl.hash = sdb.hash")).
+		WithArgs("sd", "a", "b").
+		WillReturnRows(sqlmock.NewRows([]string{"hash", "sd_hash"}).AddRow("b", "other_sd"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE blocked SET stream_sd_hash = ? WHERE hash = ?")).
+		WithArgs("other_sd", "b").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM blocked WHERE hash IN (?,?)")).
+		WithArgs("sd", "a").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	for _, hash := range []string{"sd", "a"} {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO blocked_history")).
+			WithArgs(hash, BlockActionUnblock, "reason", "source").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	unblocked, err := s.Unblock("sd", "reason", "source")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sd", "a"}, unblocked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
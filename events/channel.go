@@ -0,0 +1,39 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+)
+
+// Channel passes events to code running in the same process, e.g. a program using the reflector package
+// as a library. The channel is closed when the Emitter shuts down or stops using the sink.
+type Channel struct {
+	ch     chan StreamCompleted
+	closed sync.Once
+}
+
+// NewChannel returns a Channel that buffers up to size events
+func NewChannel(size int) *Channel {
+	return &Channel{ch: make(chan StreamCompleted, size)}
+}
+
+// C returns the channel the events are received from
+func (c *Channel) C() <-chan StreamCompleted { return c.ch }
+
+func (c *Channel) Name() string { return "channel" }
+
+// Send waits for room in the channel, or for stopper to be closed
+func (c *Channel) Send(stopper stop.Chan, e StreamCompleted) error {
+	select {
+	case c.ch <- e:
+	case <-stopper:
+	}
+	return nil
+}
+
+// Close closes the channel
+func (c *Channel) Close() error {
+	c.closed.Do(func() { close(c.ch) })
+	return nil
+}
@@ -0,0 +1,205 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TypeStreamCompleted is the type of the event sent when the last missing blob of a stream is uploaded
+const TypeStreamCompleted = "stream_completed"
+
+const (
+	// queueSize is how many events each sink can fall behind before new events are dropped
+	queueSize = 1000
+	// drainTimeout is how long Shutdown waits for the sinks to send the events queued for them
+	drainTimeout = 10 * time.Second
+)
+
+// StreamCompleted tells that every blob of a stream is in the store
+type StreamCompleted struct {
+	Type      string    `json:"type"`
+	SDHash    string    `json:"sd_hash"`
+	BlobCount int       `json:"blob_count"` // content blobs, without the sd blob and the stream terminator
+	TotalSize int64     `json:"total_size"` // bytes of the content blobs
+	Uploader  string    `json:"uploader,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// NewStreamCompleted returns a StreamCompleted event that happened now
+func NewStreamCompleted(sdHash string, blobCount int, totalSize int64, uploader string) StreamCompleted {
+	return StreamCompleted{
+		Type:      TypeStreamCompleted,
+		SDHash:    sdHash,
+		BlobCount: blobCount,
+		TotalSize: totalSize,
+		Uploader:  uploader,
+		Time:      time.Now().UTC(),
+	}
+}
+
+// Sink receives events. Send may block, it gives up when stopper is closed.
+type Sink interface {
+	Name() string
+	Send(stopper stop.Chan, e StreamCompleted) error
+}
+
+// Config is the events section of a config file
+type Config struct {
+	Webhooks []WebhookParams `mapstructure:"webhooks"`
+	LogFile  string          `mapstructure:"log_file"`
+}
+
+// Validate checks the config without opening anything
+func (c Config) Validate() error {
+	for _, params := range c.Webhooks {
+		if params.URL == "" {
+			return errors.Err("events webhooks require a url")
+		}
+	}
+	return nil
+}
+
+// Sinks creates the sinks of the config
+func (c Config) Sinks() ([]Sink, error) {
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	var sinks []Sink
+	for _, params := range c.Webhooks {
+		sinks = append(sinks, NewWebhook(params))
+	}
+	if c.LogFile != "" {
+		logFile, err := NewLogFile(c.LogFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, logFile)
+	}
+	return sinks, nil
+}
+
+// Emitter hands events to its sinks without blocking the caller. Each sink has its own queue, so a slow
+// webhook doesn't hold up the others. A nil Emitter drops every event.
+type Emitter struct {
+	mu     sync.RWMutex
+	queues []*queue
+}
+
+type queue struct {
+	sink Sink
+	ch   chan StreamCompleted
+	grp  *stop.Group
+	done chan struct{}
+}
+
+// NewEmitter returns an Emitter that sends to the sinks
+func NewEmitter(sinks ...Sink) *Emitter {
+	e := &Emitter{}
+	e.SetSinks(sinks)
+	return e
+}
+
+// SetSinks replaces the sinks. The old sinks still send the events already queued for them.
+func (e *Emitter) SetSinks(sinks []Sink) {
+	queues := make([]*queue, len(sinks))
+	for i, sink := range sinks {
+		queues[i] = newQueue(sink)
+	}
+	e.mu.Lock()
+	old := e.queues
+	e.queues = queues
+	e.mu.Unlock()
+	for _, q := range old {
+		close(q.ch)
+	}
+}
+
+// Enabled returns true if the emitter has sinks
+func (e *Emitter) Enabled() bool {
+	if e == nil {
+		return false
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.queues) > 0
+}
+
+// Emit queues the event for every sink. Sinks that are too far behind miss it.
+func (e *Emitter) Emit(ev StreamCompleted) {
+	if e == nil {
+		return
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, q := range e.queues {
+		select {
+		case q.ch <- ev:
+		default:
+			log.Warnf("dropping %s event for %s: sink %s is too far behind", ev.Type, ev.SDHash[:min(8, len(ev.SDHash))], q.sink.Name())
+			metrics.EventCount.WithLabelValues(ev.Type, q.sink.Name(), "dropped").Inc()
+		}
+	}
+}
+
+// Shutdown stops every sink. The events queued for them are sent if that takes less than drainTimeout, and
+// dropped otherwise.
+func (e *Emitter) Shutdown() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	queues := e.queues
+	e.queues = nil
+	e.mu.Unlock()
+	for _, q := range queues {
+		close(q.ch)
+	}
+	deadline := time.After(drainTimeout)
+	for _, q := range queues {
+		select {
+		case <-q.done:
+		case <-deadline:
+		}
+		q.grp.StopAndWait()
+	}
+}
+
+func newQueue(sink Sink) *queue {
+	q := &queue{sink: sink, ch: make(chan StreamCompleted, queueSize), grp: stop.New(), done: make(chan struct{})}
+	q.grp.Add(1)
+	go func() {
+		defer q.grp.Done()
+		defer close(q.done)
+		for ev := range q.ch {
+			select {
+			case <-q.grp.Ch():
+				// the drain timed out, the rest of the queue is dropped
+				metrics.EventCount.WithLabelValues(ev.Type, sink.Name(), "dropped").Inc()
+				continue
+			default:
+			}
+			err := sink.Send(q.grp.Ch(), ev)
+			if err != nil {
+				log.Errorln(errors.Prefix("sending "+ev.Type+" event to "+sink.Name(), err))
+				metrics.EventCount.WithLabelValues(ev.Type, sink.Name(), "failed").Inc()
+				continue
+			}
+			metrics.EventCount.WithLabelValues(ev.Type, sink.Name(), "sent").Inc()
+		}
+		if closer, ok := sink.(interface{ Close() error }); ok {
+			err := closer.Close()
+			if err != nil {
+				log.Errorln(errors.Prefix("closing "+sink.Name(), err))
+			}
+		}
+	}()
+	return q
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhook_Retries(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan StreamCompleted, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e StreamCompleted
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		received <- e
+	}))
+	defer srv.Close()
+
+	emitter := NewEmitter(NewWebhook(WebhookParams{URL: srv.URL, Token: "secret", RetryDelay: time.Millisecond}))
+	defer emitter.Shutdown()
+	emitter.Emit(NewStreamCompleted("abcdef0123", 3, 4000, "uploader"))
+
+	select {
+	case e := <-received:
+		assert.Equal(t, TypeStreamCompleted, e.Type)
+		assert.Equal(t, "abcdef0123", e.SDHash)
+		assert.Equal(t, 3, e.BlobCount)
+		assert.EqualValues(t, 4000, e.TotalSize)
+		assert.Equal(t, "uploader", e.Uploader)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestWebhook_NoRetryOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	w := NewWebhook(WebhookParams{URL: srv.URL, RetryDelay: time.Millisecond})
+	err := w.Send(make(chan struct{}), NewStreamCompleted("abcdef0123", 1, 1, ""))
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, calls.Load())
+}
+
+func TestLogFileAndChannel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sinks, err := Config{LogFile: path}.Sinks()
+	require.NoError(t, err)
+	ch := NewChannel(10)
+	emitter := NewEmitter(append(sinks, ch)...)
+
+	emitter.Emit(NewStreamCompleted("first", 1, 10, ""))
+	emitter.Emit(NewStreamCompleted("second", 2, 20, ""))
+	for _, sdHash := range []string{"first", "second"} {
+		select {
+		case e := <-ch.C():
+			assert.Equal(t, sdHash, e.SDHash)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event on the channel")
+		}
+	}
+	emitter.Shutdown()
+	_, open := <-ch.C()
+	assert.False(t, open, "the channel should be closed on shutdown")
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	var lines []StreamCompleted
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e StreamCompleted
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		lines = append(lines, e)
+	}
+	require.Len(t, lines, 2)
+	assert.Equal(t, "first", lines[0].SDHash)
+	assert.Equal(t, "second", lines[1].SDHash)
+}
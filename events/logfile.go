@@ -0,0 +1,46 @@
+package events
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+)
+
+// LogFile appends each event to a file, as a line of JSON
+type LogFile struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+// NewLogFile opens the file for appending, creating it if needed
+func NewLogFile(path string) (*LogFile, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	return &LogFile{path: path, f: f}, nil
+}
+
+func (l *LogFile) Name() string { return "log_file-" + l.path }
+
+func (l *LogFile) Send(_ stop.Chan, e StreamCompleted) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return errors.Err(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.f.Write(append(line, '\n'))
+	return errors.Err(err)
+}
+
+// Close closes the file
+func (l *LogFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return errors.Err(l.f.Close())
+}
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+)
+
+const (
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookRetries    = 5
+	defaultWebhookRetryDelay = time.Second
+	maxWebhookRetryDelay     = 5 * time.Minute
+)
+
+// Webhook POSTs each event as JSON to a URL. Failed requests are retried with an exponential backoff, except
+// the ones refused with a 4xx status other than 429.
+type Webhook struct {
+	name       string
+	url        string
+	token      string
+	client     *http.Client
+	maxRetries int
+	retryDelay time.Duration
+}
+
+type WebhookParams struct {
+	URL        string        `mapstructure:"url"`
+	Token      string        `mapstructure:"token"` // sent as a bearer token if set
+	Timeout    time.Duration `mapstructure:"timeout"`
+	MaxRetries int           `mapstructure:"max_retries"`
+	RetryDelay time.Duration `mapstructure:"retry_delay"` // before the first retry, doubled for each of the next ones
+}
+
+// NewWebhook returns an initialized Webhook pointer
+func NewWebhook(params WebhookParams) *Webhook {
+	if params.Timeout <= 0 {
+		params.Timeout = defaultWebhookTimeout
+	}
+	if params.MaxRetries <= 0 {
+		params.MaxRetries = defaultWebhookRetries
+	}
+	if params.RetryDelay <= 0 {
+		params.RetryDelay = defaultWebhookRetryDelay
+	}
+	name := params.URL
+	if u, err := url.Parse(params.URL); err == nil && u.Host != "" {
+		// the rest of the url may hold secrets, and the name ends up in logs and metrics
+		name = u.Host
+	}
+	return &Webhook{
+		name:       "webhook-" + name,
+		url:        params.URL,
+		token:      params.Token,
+		client:     &http.Client{Timeout: params.Timeout},
+		maxRetries: params.MaxRetries,
+		retryDelay: params.RetryDelay,
+	}
+}
+
+func (w *Webhook) Name() string { return w.name }
+
+// Send posts the event, retrying until it is accepted, the retries run out or stopper is closed
+func (w *Webhook) Send(stopper stop.Chan, e StreamCompleted) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Err(err)
+	}
+	delay := w.retryDelay
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = w.post(stopper, body)
+		if err == nil || !retry || attempt == w.maxRetries {
+			return err
+		}
+		select {
+		case <-stopper:
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxWebhookRetryDelay)
+	}
+}
+
+// post sends the body once, and returns whether a failed request is worth retrying
+func (w *Webhook) post(stopper stop.Chan, body []byte) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopper:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Err(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, errors.Err(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, errors.Err("unexpected status code %d from %s", resp.StatusCode, w.name)
+}
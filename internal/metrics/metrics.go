@@ -72,6 +72,8 @@ const (
 	LabelOrigin    = "origin"
 	LabelComponent = "component"
 	LabelSource    = "source"
+	LabelEdge      = "edge"
+	LabelServer    = "server"
 
 	errConnReset         = "conn_reset"
 	errReadConnReset     = "read_conn_reset"
@@ -99,6 +101,9 @@ const (
 	errBlobNotFound      = "blob_not_found"
 	errNoErr             = "no_error"
 	errQuicProto         = "quic_protocol_violation"
+	errUnauthorized      = "unauthorized"
+	errQuotaExceeded     = "quota_exceeded"
+	errInvalidSDBlob     = "invalid_sd_blob"
 	errOther             = "other"
 )
 
@@ -244,6 +249,71 @@ var (
 		Name:      "http_blob_request_queue_size",
 		Help:      "Blob requests queue size of the HTTP protocol",
 	})
+	ProtectedListAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: ns,
+		Name:      "protected_list_age_seconds",
+		Help:      "Seconds since the protected content list was last fetched from the source",
+	}, []string{LabelSource})
+	ProtectedListFetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "protected_list_fetch_errors_total",
+		Help:      "Total number of failed fetches of the protected content list",
+	}, []string{LabelSource})
+	EdgeDownloadCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "edge_blob_download_total",
+		Help:      "Total number of blobs downloaded by edges identified by their client certificate",
+	}, []string{LabelEdge, LabelServer})
+	EdgeOutBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "edge_out_bytes",
+		Help:      "Total number of bytes sent to edges identified by their client certificate",
+	}, []string{LabelEdge, LabelServer})
+	QueueRejectedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "queue_rejected_total",
+		Help:      "Total number of requests refused by the request queue of a server, by reason",
+	}, []string{LabelServer, "reason"})
+	UploaderBlobCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "uploader_blob_upload_total",
+		Help:      "Total number of blobs received on the reflector server from each authenticated uploader",
+	}, []string{"uploader"})
+	UploaderInBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "uploader_in_bytes",
+		Help:      "Total number of bytes received on the reflector server from each authenticated uploader",
+	}, []string{"uploader"})
+	UploaderQuotaExceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "uploader_quota_exceeded_total",
+		Help:      "Total number of uploads refused because the token of the uploader used up its daily quota",
+	}, []string{"uploader"})
+	EventCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "event_total",
+		Help:      "Total number of events handed to each sink, by whether they were sent, failed or dropped",
+	}, []string{"event", "sink", "result"})
+	ActiveConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: ns,
+		Name:      "active_connections",
+		Help:      "Number of open client connections",
+	}, []string{LabelServer})
+	ActiveRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: ns,
+		Name:      "active_requests",
+		Help:      "Number of requests being handled",
+	}, []string{LabelServer})
+	ConnectionsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "connections_rejected_total",
+		Help:      "Total number of client connections refused, by reason",
+	}, []string{LabelServer, "reason"})
+	ThrottledCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Name:      "throttled_total",
+		Help:      "Total number of requests refused for their request rate, or slowed down for their bandwidth, by the kind of client key",
+	}, []string{LabelServer, "limit", "kind"})
 	RoutinesQueue = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: ns,
 		Name:      "routines",
@@ -314,12 +384,18 @@ func TrackError(direction string, e error) (shouldLog bool) { // shouldLog is a
 		errType = errRequestTooLarge
 	} else if strings.Contains(err.Error(), "Invalid blob hash length") {
 		errType = errInvalidBlobHash
-	} else if strings.Contains(err.Error(), "hash of received blob data does not match hash from send request") {
+	} else if strings.Contains(err.Error(), "hash of received blob data does not match hash from") {
 		errType = errHashMismatch
 	} else if strings.Contains(err.Error(), "blob not found") {
 		errType = errBlobNotFound
 	} else if strings.Contains(err.Error(), "requested blob is protected") {
 		errType = errProtectedBlob
+	} else if strings.Contains(err.Error(), "invalid upload token") {
+		errType = errUnauthorized
+	} else if strings.Contains(err.Error(), "daily upload quota exceeded") {
+		errType = errQuotaExceeded
+	} else if strings.Contains(err.Error(), "invalid sd blob") { // checked before the json errors it may contain
+		errType = errInvalidSDBlob
 	} else if strings.Contains(err.Error(), "0-byte blob received") {
 		errType = errZeroByteBlob
 	} else if strings.Contains(err.Error(), "PROTOCOL_VIOLATION: tried to retire connection") {
@@ -0,0 +1,201 @@
+package protected
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lbryio/reflector.go/blocklist"
+	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Policies for when the protected list can't be kept up to date
+const (
+	// PolicyFailOpen serves every blob that isn't on the last known list
+	PolicyFailOpen = "fail_open"
+	// PolicyFailClosed treats every blob as protected until the list is fetched again
+	PolicyFailClosed = "fail_closed"
+)
+
+// Config is the protected_content section of a config file, without the sources
+type Config struct {
+	Policy string `mapstructure:"policy"`
+	// MaxAge is how old the list of a source can get before the policy applies. It defaults to three refresh intervals.
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+// Validate checks that the config is usable
+func (c Config) Validate() error {
+	switch c.Policy {
+	case "", PolicyFailOpen, PolicyFailClosed:
+		return nil
+	default:
+		return errors.Err("unknown protected content policy %s", c.Policy)
+	}
+}
+
+// List is the set of protected streams. It holds the sd hashes listed by its sources along with the content
+// blobs of those streams, so every blob of a protected stream is protected.
+type List struct {
+	resolver   *blocklist.Resolver
+	sources    []blocklist.Source
+	watcher    *blocklist.Watcher
+	failClosed bool
+	maxAge     time.Duration
+	grp        *stop.Group
+
+	// updateMu serializes updates from the sources. lists and streams are only used while holding it
+	updateMu sync.Mutex
+	lists    map[string][]string // hashes listed by each source
+	streams  map[string][]string // content blobs of each resolved sd hash
+
+	protected map[string]bool
+	fetched   map[string]time.Time // when each source was last fetched successfully
+	mu        sync.RWMutex
+}
+
+// NewList returns an initialized List pointer. The store is used to resolve sd blobs into their content blobs.
+func NewList(s store.BlobStore, sources []blocklist.Source, cfg Config) (*List, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	l := &List{
+		resolver:   blocklist.NewResolver(s),
+		sources:    sources,
+		failClosed: cfg.Policy == PolicyFailClosed,
+		maxAge:     cfg.MaxAge,
+		grp:        stop.New(),
+		lists:      make(map[string][]string),
+		streams:    make(map[string][]string),
+		protected:  make(map[string]bool),
+		fetched:    make(map[string]time.Time),
+	}
+	l.watcher = blocklist.NewWatcher(sources, l.update)
+	l.watcher.Failed = func(source blocklist.Source, _ error) {
+		metrics.ProtectedListFetchErrors.WithLabelValues(source.Name()).Inc()
+	}
+	return l, nil
+}
+
+// DefaultSources returns the sources used when none are configured: the Odysee list of protected streams
+func DefaultSources() []blocklist.Source {
+	return []blocklist.Source{blocklist.NewProtectedAPISource(blocklist.ProtectedAPIParams{Name: "odysee"})}
+}
+
+// Start starts syncing the list with its sources
+func (l *List) Start() {
+	l.watcher.Start()
+	l.grp.Add(1)
+	go func() {
+		defer l.grp.Done()
+		l.reportAge()
+	}()
+}
+
+// Shutdown stops syncing the list
+func (l *List) Shutdown() {
+	l.watcher.Shutdown()
+	l.grp.StopAndWait()
+}
+
+// IsProtected returns true if the hash is a protected sd hash or a content blob of a protected stream.
+// With the fail_closed policy, every hash is protected while a source is out of date. A nil List protects nothing.
+func (l *List) IsProtected(hash string) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.failClosed && l.stale() {
+		return true
+	}
+	return l.protected[hash]
+}
+
+// stale returns true if a source hasn't been fetched for longer than its max age. It must be called while holding mu.
+func (l *List) stale() bool {
+	for _, source := range l.sources {
+		fetched, ok := l.fetched[source.Name()]
+		if !ok || time.Since(fetched) > l.maxAgeOf(source) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *List) maxAgeOf(source blocklist.Source) time.Duration {
+	if l.maxAge > 0 {
+		return l.maxAge
+	}
+	return 3 * source.RefreshInterval()
+}
+
+func (l *List) update(source blocklist.Source, hashes []string) {
+	l.updateMu.Lock()
+	defer l.updateMu.Unlock()
+
+	l.lists[source.Name()] = hashes
+	for _, sdHash := range hashes {
+		l.resolve(sdHash)
+	}
+
+	protected := make(map[string]bool)
+	for _, list := range l.lists {
+		for _, hash := range list {
+			protected[hash] = true
+			for _, blobHash := range l.streams[hash] {
+				protected[blobHash] = true
+			}
+		}
+	}
+
+	l.resolver.Forget(func(sdHash string) bool { return protected[sdHash] })
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.protected = protected
+	l.fetched[source.Name()] = time.Now()
+}
+
+// resolve finds the content blobs of a protected stream. Streams whose sd blob can't be found are retried later.
+func (l *List) resolve(sdHash string) {
+	if _, ok := l.streams[sdHash]; ok {
+		return
+	}
+	blobHashes, err := l.resolver.ContentBlobs(sdHash)
+	if errors.Is(err, blocklist.ErrNotSDBlob) {
+		log.Warnf("protected content: %s", err)
+	} else if err != nil {
+		if !errors.Is(err, store.ErrBlobNotFound) {
+			log.Errorf("protected content: resolving stream %s: %s", sdHash, errors.FullTrace(err))
+		}
+		return
+	}
+	l.streams[sdHash] = blobHashes
+}
+
+// reportAge keeps the list age metric of every source up to date
+func (l *List) reportAge() {
+	t := time.NewTicker(15 * time.Second)
+	defer t.Stop()
+	for {
+		l.mu.RLock()
+		for _, source := range l.sources {
+			if fetched, ok := l.fetched[source.Name()]; ok {
+				metrics.ProtectedListAge.WithLabelValues(source.Name()).Set(time.Since(fetched).Seconds())
+			}
+		}
+		l.mu.RUnlock()
+		select {
+		case <-l.grp.Ch():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package protected
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lbryio/reflector.go/blocklist"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticSource []string
+
+func (s staticSource) Name() string                      { return "static" }
+func (s staticSource) Fetch(stop.Chan) ([]string, error) { return s, nil }
+func (s staticSource) RefreshInterval() time.Duration    { return time.Hour }
+
+func TestList_ProtectsStream(t *testing.T) {
+	data := make([]byte, 3*stream.MaxBlobSize)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	s, err := stream.New(bytes.NewReader(data))
+	require.NoError(t, err)
+	sdHash := s[0].HashHex()
+
+	origin := store.NewMemStore(store.MemParams{Name: "origin"})
+	for _, b := range s {
+		require.NoError(t, origin.Put(b.HashHex(), b))
+	}
+	cache := store.NewMemStore(store.MemParams{Name: "cache"})
+
+	source := staticSource{sdHash}
+	l, err := NewList(store.NewCachingStore(store.CachingParams{Name: "test", Origin: origin, Cache: cache}), []blocklist.Source{source}, Config{})
+	require.NoError(t, err)
+	assert.False(t, l.IsProtected(sdHash), "fail_open protects nothing before the first fetch")
+
+	l.update(source, source)
+	for _, b := range s {
+		assert.True(t, l.IsProtected(b.HashHex()), "every blob of a protected stream must be protected")
+	}
+	assert.False(t, l.IsProtected(strings.Repeat("a", 96)))
+	has, err := cache.Has(sdHash)
+	require.NoError(t, err)
+	assert.False(t, has, "resolving a protected stream must not cache its sd blob")
+
+	var nilList *List
+	assert.False(t, nilList.IsProtected(sdHash))
+}
+
+func TestList_FailClosed(t *testing.T) {
+	unlisted := strings.Repeat("a", 96)
+	source := staticSource{}
+	l, err := NewList(store.NewMemStore(store.MemParams{Name: "test"}), []blocklist.Source{source}, Config{Policy: PolicyFailClosed, MaxAge: time.Minute})
+	require.NoError(t, err)
+	assert.True(t, l.IsProtected(unlisted), "fail_closed protects everything before the first fetch")
+
+	l.update(source, source)
+	assert.False(t, l.IsProtected(unlisted))
+
+	l.mu.Lock()
+	l.fetched[source.Name()] = time.Now().Add(-2 * time.Minute)
+	l.mu.Unlock()
+	assert.True(t, l.IsProtected(unlisted), "fail_closed protects everything once the list is out of date")
+
+	_, err = NewList(nil, nil, Config{Policy: "fail_sideways"})
+	assert.Error(t, err)
+}
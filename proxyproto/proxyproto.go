@@ -0,0 +1,293 @@
+// Package proxyproto reads the PROXY protocol header (v1 and v2) that load balancers send at the start of a
+// connection, so servers behind them see the address of the client instead of the address of the load balancer.
+// See https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+)
+
+const (
+	// DefaultTimeout is how long a trusted proxy has to send its header
+	DefaultTimeout = 10 * time.Second
+	// v1MaxLength is the longest v1 header, CRLF included
+	v1MaxLength = 107
+)
+
+var (
+	ErrMissingHeader = errors.Base("connection from a trusted proxy has no PROXY protocol header")
+	ErrInvalidHeader = errors.Base("invalid PROXY protocol header")
+
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// Trusted is the set of proxies whose PROXY protocol headers are trusted. It can be updated while in use.
+type Trusted struct {
+	mu   sync.RWMutex
+	nets []*net.IPNet
+}
+
+// NewTrusted returns the set of proxies in the given ips and CIDRs
+func NewTrusted(cidrs []string) (*Trusted, error) {
+	t := &Trusted{}
+	err := t.Set(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Set replaces the trusted proxies with the given ips and CIDRs
+func (t *Trusted) Set(cidrs []string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, entry := range cidrs {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return errors.Prefix("trusted proxies", err)
+		}
+		nets = append(nets, ipNet)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nets = nets
+	return nil
+}
+
+// Empty returns true if no proxy is trusted. A nil Trusted trusts nothing.
+func (t *Trusted) Empty() bool {
+	if t == nil {
+		return true
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.nets) == 0
+}
+
+// Contains returns true if addr is a trusted proxy
+func (t *Trusted) Contains(addr net.Addr) bool {
+	if t == nil {
+		return false
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, ipNet := range t.nets {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Listener reads the PROXY protocol header of the connections coming from trusted proxies. Connections from other
+// addresses are returned as they are.
+type Listener struct {
+	net.Listener
+	Trusted *Trusted
+	Timeout time.Duration // how long a proxy has to send the header. DefaultTimeout if 0
+}
+
+// NewListener wraps l to read the PROXY protocol header of the connections from trusted proxies
+func NewListener(l net.Listener, trusted *Trusted) *Listener {
+	return &Listener{Listener: l, Trusted: trusted, Timeout: DefaultTimeout}
+}
+
+// Accept returns the next connection. The header is read on the first call to Read or RemoteAddr, so a slow
+// proxy doesn't hold up the other connections.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.Trusted.Contains(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	timeout := l.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &Conn{Conn: conn, r: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Conn is a connection from a trusted proxy. Its RemoteAddr is the client address sent in the header.
+type Conn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+
+	mu           sync.Mutex
+	readDeadline time.Time // deadline set by the user of the connection before the header was read
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+// RemoteAddr returns the address of the client. If the header is invalid, or the proxy sent a LOCAL command
+// like for its health checks, it returns the address of the proxy.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// readHeader reads the header within the timeout, then restores the deadline set by the user of the connection
+func (c *Conn) readHeader() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deadline := time.Now().Add(c.timeout)
+	if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+		deadline = c.readDeadline
+	}
+	_ = c.Conn.SetReadDeadline(deadline)
+	c.remote, c.err = ReadHeader(c.r)
+	_ = c.Conn.SetReadDeadline(c.readDeadline)
+}
+
+// ReadHeader reads a v1 or v2 header from r. It returns the source address it carries, or nil if the header
+// doesn't carry one (LOCAL command or unknown protocol).
+func ReadHeader(r *bufio.Reader) (net.Addr, error) {
+	// decide on the first byte, so a client talking right away isn't kept waiting for more bytes
+	first, err := r.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.Err(ErrMissingHeader)
+		}
+		return nil, errors.Err(err)
+	}
+	switch first[0] {
+	case v1Prefix[0]:
+		start, err := r.Peek(len(v1Prefix))
+		if err == nil && bytes.Equal(start, v1Prefix) {
+			return readV1(r)
+		}
+	case v2Signature[0]:
+		start, err := r.Peek(len(v2Signature))
+		if err == nil && bytes.Equal(start, v2Signature) {
+			return readV2(r)
+		}
+	}
+	return nil, errors.Err(ErrMissingHeader)
+}
+
+// readV1 reads a header like "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.Prefix("v1 header is not terminated", ErrInvalidHeader)
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.Prefix("v1 header: "+string(line[:len(line)-2]), ErrInvalidHeader)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, errors.Prefix("v1 header: "+string(line[:len(line)-2]), ErrInvalidHeader)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readV2 reads a binary header: the signature, the version and command, the family and protocol, the length
+// of the rest of the header, the addresses and optional TLVs, which are skipped
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(v2Signature)+4)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	versionCommand, family := header[12], header[13]
+	length := int(binary.BigEndian.Uint16(header[14:]))
+	if versionCommand>>4 != 2 {
+		return nil, errors.Prefix("unsupported version", ErrInvalidHeader)
+	}
+	rest := make([]byte, length)
+	_, err = io.ReadFull(r, rest)
+	if err != nil {
+		return nil, errors.Err(err)
+	}
+	switch versionCommand & 0xF {
+	case 0: // LOCAL: the proxy talks for itself
+		return nil, nil
+	case 1: // PROXY
+	default:
+		return nil, errors.Prefix("unsupported command", ErrInvalidHeader)
+	}
+
+	var ipLength int
+	switch family >> 4 {
+	case 1:
+		ipLength = net.IPv4len
+	case 2:
+		ipLength = net.IPv6len
+	default: // unspecified or unix sockets, which have no ip
+		return nil, nil
+	}
+	if family&0xF != 1 { // only stream connections
+		return nil, nil
+	}
+	if length < 2*ipLength+4 {
+		return nil, errors.Prefix("addresses are truncated", ErrInvalidHeader)
+	}
+	ip := net.IP(rest[:ipLength])
+	port := binary.BigEndian.Uint16(rest[2*ipLength:])
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,113 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func v2Header(command byte, family byte, addresses []byte) []byte {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestReadHeader(t *testing.T) {
+	v4 := append(append(net.ParseIP("192.0.2.1").To4(), net.ParseIP("198.51.100.1").To4()...), 0xDC, 0x04, 0x01, 0xBB)
+	v6 := append(append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...), 0xDC, 0x04, 0x01, 0xBB)
+	tlv := []byte{0x04, 0x00, 0x01, 0x00} // a NOOP TLV
+
+	tests := []struct {
+		name   string
+		header []byte
+		remote string
+		err    error
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"), "192.0.2.1:56324", nil},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), "[2001:db8::1]:56324", nil},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", nil},
+		{"v1 wrong family", []byte("PROXY TCP6 192.0.2.1 198.51.100.1 56324 443\r\n"), "", ErrInvalidHeader},
+		{"v1 unterminated", []byte("PROXY TCP4 " + strings.Repeat("1", 200)), "", ErrInvalidHeader},
+		{"v2 tcp4", v2Header(1, 0x11, v4), "192.0.2.1:56324", nil},
+		{"v2 tcp6 with tlv", v2Header(1, 0x21, append(v6, tlv...)), "[2001:db8::1]:56324", nil},
+		{"v2 local", v2Header(0, 0x00, nil), "", nil},
+		{"v2 truncated", v2Header(1, 0x21, v4), "", ErrInvalidHeader},
+		{"no header", []byte("{\"version\":1}"), "", ErrMissingHeader},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewReader(append(test.header, "data"...)))
+			addr, err := ReadHeader(r)
+			if test.err != nil {
+				assert.True(t, errors.Is(err, test.err), "got %v", err)
+				return
+			}
+			require.NoError(t, err)
+			if test.remote == "" {
+				assert.Nil(t, addr)
+			} else {
+				assert.Equal(t, test.remote, addr.String())
+			}
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "data", string(rest))
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	trusted, err := NewTrusted([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	pl := NewListener(l, trusted)
+
+	accept := func(send string) net.Conn {
+		client, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = client.Close() })
+		_, err = client.Write([]byte(send))
+		require.NoError(t, err)
+		conn, err := pl.Accept()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn
+	}
+
+	// connections from untrusted addresses are left alone, headers included
+	conn := accept("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n")
+	assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+
+	require.NoError(t, trusted.Set([]string{"127.0.0.1"}))
+	conn = accept("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello")
+	assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	conn = accept("hello")
+	_, err = conn.Read(buf)
+	assert.True(t, errors.Is(err, ErrMissingHeader))
+	assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+
+	// a proxy that sends nothing runs into the deadline set on the connection
+	conn = accept("")
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	start := time.Now()
+	_, err = conn.Read(buf)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), DefaultTimeout)
+}
@@ -204,17 +204,8 @@ func reflect(st stream.Stream, reflectorAddress string) error {
 	if err != nil {
 		return errors.Err(err)
 	}
-	for i, b := range st {
-		if i == 0 {
-			err = c.SendSDBlob(b)
-		} else {
-			err = c.SendBlob(b)
-		}
-		if err != nil {
-			return errors.Err(err)
-		}
-	}
-	return nil
+	_, err = c.SendStream(st)
+	return errors.Err(err)
 }
 
 func makeStream(path string) (stream.Stream, *pb.Stream, error) {
@@ -0,0 +1,336 @@
+// Package ratelimit limits the request rate and the bandwidth of each client of the servers. Clients are
+// identified by their mTLS identity, their token or their ip, in that order.
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// idleTimeout is how long the limits of a client are kept after its last request
+	idleTimeout = 10 * time.Minute
+	// minByteBurst lets small writes through without splitting them, even with very low bandwidth limits
+	minByteBurst = 32 * 1024
+	// maxClients caps the number of clients whose limits are kept, so that clients can't grow it without bound
+	maxClients = 100000
+
+	KindEdge  = "edge"
+	KindToken = "token"
+	KindIP    = "ip"
+)
+
+// Config sets the limits of each client. Zero values mean no limit.
+type Config struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	RequestBurst      int     `mapstructure:"request_burst"` // requests allowed at once. Defaults to one second of requests
+	BytesPerSecond    int     `mapstructure:"bytes_per_second"`
+	// Allowlist are the ips and CIDRs of trusted clients, like CDNs, which are never limited
+	Allowlist []string `mapstructure:"allowlist"`
+	// AllowedEdges are the mTLS identities of trusted clients, which are never limited
+	AllowedEdges []string `mapstructure:"allowed_edges"`
+}
+
+// Client identifies the client of a request
+type Client struct {
+	IP    string
+	Token string // edge or upload token, only once it has been checked against the configured ones
+	Edge  string // identity from the client certificate, if there is one
+}
+
+// key returns the kind of key the client is limited by, and the key
+func (c Client) key() (string, string) {
+	switch {
+	case c.Edge != "":
+		return KindEdge, KindEdge + ":" + c.Edge
+	case c.Token != "":
+		return KindToken, KindToken + ":" + c.Token
+	default:
+		return KindIP, KindIP + ":" + c.IP
+	}
+}
+
+// Limiter enforces the limits of a Config. A nil Limiter limits nothing.
+type Limiter struct {
+	mu         sync.Mutex
+	cfg        Config
+	allowNets  []*net.IPNet
+	allowEdges map[string]bool
+	clients    map[string]*limits
+	sweptAt    time.Time
+}
+
+type limits struct {
+	requests *rate.Limiter
+	bytes    *rate.Limiter
+	seenAt   time.Time
+}
+
+// NewLimiter returns a Limiter enforcing cfg
+func NewLimiter(cfg Config) (*Limiter, error) {
+	l := &Limiter{}
+	err := l.SetConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetConfig replaces the limits. Clients start over with the new limits.
+func (l *Limiter) SetConfig(cfg Config) error {
+	if cfg.RequestsPerSecond < 0 || cfg.RequestBurst < 0 || cfg.BytesPerSecond < 0 {
+		return errors.Err("rate limits can't be negative")
+	}
+	var nets []*net.IPNet
+	for _, entry := range cfg.Allowlist {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return errors.Prefix("rate limit allowlist", err)
+		}
+		nets = append(nets, ipNet)
+	}
+	edges := make(map[string]bool, len(cfg.AllowedEdges))
+	for _, edge := range cfg.AllowedEdges {
+		edges[edge] = true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg, l.allowNets, l.allowEdges = cfg, nets, edges
+	l.clients = make(map[string]*limits)
+	return nil
+}
+
+// Allow counts a request of the client, and returns false if the client is over its request rate
+func (l *Limiter) Allow(server string, c Client) bool {
+	lim, kind := l.limitsOf(c)
+	if lim == nil || lim.requests == nil || lim.requests.Allow() {
+		return true
+	}
+	metrics.ThrottledCount.WithLabelValues(server, "requests", kind).Inc()
+	return false
+}
+
+// WaitBytes waits until the client may transfer n more bytes
+func (l *Limiter) WaitBytes(ctx context.Context, server string, c Client, n int) error {
+	lim, kind := l.limitsOf(c)
+	if lim == nil || lim.bytes == nil {
+		return nil
+	}
+	throttled := false
+	for n > 0 {
+		chunk := n
+		if chunk > lim.bytes.Burst() {
+			chunk = lim.bytes.Burst()
+		}
+		r := lim.bytes.ReserveN(time.Now(), chunk)
+		if delay := r.Delay(); delay > 0 {
+			throttled = true
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				r.Cancel()
+				return errors.Err(ctx.Err())
+			}
+		}
+		n -= chunk
+	}
+	if throttled {
+		metrics.ThrottledCount.WithLabelValues(server, "bandwidth", kind).Inc()
+	}
+	return nil
+}
+
+// Writer returns a writer that writes to w within the bandwidth of the client
+func (l *Limiter) Writer(ctx context.Context, server string, c Client, w io.Writer) io.Writer {
+	if !l.limitsBandwidth(c) {
+		return w
+	}
+	return &writer{Writer: w, ctx: ctx, l: l, server: server, c: c}
+}
+
+// Reader returns a reader that reads from r within the bandwidth of the client
+func (l *Limiter) Reader(ctx context.Context, server string, c Client, r io.Reader) io.Reader {
+	if !l.limitsBandwidth(c) {
+		return r
+	}
+	return &reader{Reader: r, ctx: ctx, l: l, server: server, c: c}
+}
+
+// ResponseWriter returns a response writer that writes the body within the bandwidth of the client of r
+func (l *Limiter) ResponseWriter(server string, c Client, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if !l.limitsBandwidth(c) {
+		return w
+	}
+	return &responseWriter{ResponseWriter: w, writer: writer{Writer: w, ctx: r.Context(), l: l, server: server, c: c}}
+}
+
+// Conn returns a connection that reads and writes within the bandwidth of the client
+func (l *Limiter) Conn(server string, c Client, conn net.Conn) net.Conn {
+	if !l.limitsBandwidth(c) {
+		return conn
+	}
+	return &limitedConn{Conn: conn, l: l, server: server, c: c}
+}
+
+func (l *Limiter) limitsBandwidth(c Client) bool {
+	lim, _ := l.limitsOf(c)
+	return lim != nil && lim.bytes != nil
+}
+
+// limitsOf returns the limits of the client, or nil if it isn't limited
+func (l *Limiter) limitsOf(c Client) (*limits, string) {
+	if l == nil {
+		return nil, ""
+	}
+	kind, key := c.key()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if (l.cfg.RequestsPerSecond == 0 && l.cfg.BytesPerSecond == 0) || l.allowed(c) {
+		return nil, kind
+	}
+	now := time.Now()
+	if now.Sub(l.sweptAt) > idleTimeout {
+		for k, lim := range l.clients {
+			if now.Sub(lim.seenAt) > idleTimeout {
+				delete(l.clients, k)
+			}
+		}
+		l.sweptAt = now
+	}
+	lim, ok := l.clients[key]
+	if !ok {
+		if len(l.clients) >= maxClients {
+			// make room by forgetting any client, it starts over with full limits if it comes back
+			for k := range l.clients {
+				delete(l.clients, k)
+				break
+			}
+		}
+		lim = &limits{}
+		if l.cfg.RequestsPerSecond > 0 {
+			burst := l.cfg.RequestBurst
+			if burst == 0 {
+				burst = int(l.cfg.RequestsPerSecond + 0.999)
+			}
+			lim.requests = rate.NewLimiter(rate.Limit(l.cfg.RequestsPerSecond), burst)
+		}
+		if l.cfg.BytesPerSecond > 0 {
+			burst := l.cfg.BytesPerSecond
+			if burst < minByteBurst {
+				burst = minByteBurst
+			}
+			lim.bytes = rate.NewLimiter(rate.Limit(l.cfg.BytesPerSecond), burst)
+		}
+		l.clients[key] = lim
+	}
+	lim.seenAt = now
+	return lim, kind
+}
+
+func (l *Limiter) allowed(c Client) bool {
+	if c.Edge != "" && l.allowEdges[c.Edge] {
+		return true
+	}
+	if len(l.allowNets) == 0 {
+		return false
+	}
+	ip := net.ParseIP(c.IP)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range l.allowNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type writer struct {
+	io.Writer
+	ctx    context.Context
+	l      *Limiter
+	server string
+	c      Client
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	err := w.l.WaitBytes(w.ctx, w.server, w.c, len(p))
+	if err != nil {
+		return 0, err
+	}
+	return w.Writer.Write(p)
+}
+
+type reader struct {
+	io.Reader
+	ctx    context.Context
+	l      *Limiter
+	server string
+	c      Client
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		waitErr := r.l.WaitBytes(r.ctx, r.server, r.c, n)
+		if waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	writer writer
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+type limitedConn struct {
+	net.Conn
+	l      *Limiter
+	server string
+	c      Client
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		// the bytes are already read, waiting slows down the next read
+		_ = c.l.WaitBytes(context.Background(), c.server, c.c, n)
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	err := c.l.WaitBytes(context.Background(), c.server, c.c, len(p))
+	if err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(p)
+}
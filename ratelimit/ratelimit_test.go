@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l, err := NewLimiter(Config{
+		RequestsPerSecond: 0.001,
+		RequestBurst:      2,
+		Allowlist:         []string{"10.0.0.0/8", "2001:db8::1"},
+		AllowedEdges:      []string{"cdn"},
+	})
+	require.NoError(t, err)
+
+	client := Client{IP: "1.2.3.4"}
+	assert.True(t, l.Allow("test", client))
+	assert.True(t, l.Allow("test", client))
+	assert.False(t, l.Allow("test", client))
+
+	// a token or an identity is limited separately from the ip it connects from
+	assert.True(t, l.Allow("test", Client{IP: "1.2.3.4", Token: "abc"}))
+	assert.True(t, l.Allow("test", Client{IP: "1.2.3.4", Edge: "edge1"}))
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, l.Allow("test", Client{IP: "10.1.2.3"}))
+		assert.True(t, l.Allow("test", Client{IP: "2001:db8::1"}))
+		assert.True(t, l.Allow("test", Client{IP: "1.2.3.4", Edge: "cdn"}))
+	}
+
+	// new limits start every client over
+	require.NoError(t, l.SetConfig(Config{RequestsPerSecond: 0.001, RequestBurst: 1}))
+	assert.True(t, l.Allow("test", client))
+	assert.False(t, l.Allow("test", client))
+	assert.True(t, l.Allow("test", Client{IP: "10.1.2.3"}))
+	assert.False(t, l.Allow("test", Client{IP: "10.1.2.3"}))
+}
+
+func TestLimiter_Bandwidth(t *testing.T) {
+	l, err := NewLimiter(Config{BytesPerSecond: minByteBurst})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := l.Writer(context.Background(), "test", Client{IP: "1.2.3.4"}, &buf)
+	start := time.Now()
+	// the first burst goes through at once, the next half waits half a second
+	n, err := w.Write(make([]byte, minByteBurst+minByteBurst/2))
+	require.NoError(t, err)
+	assert.Equal(t, minByteBurst+minByteBurst/2, n)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = l.Writer(ctx, "test", Client{IP: "1.2.3.4"}, &buf).Write(make([]byte, minByteBurst))
+	assert.Error(t, err)
+}
+
+func TestLimiter_NoLimits(t *testing.T) {
+	var nilLimiter *Limiter
+	var buf bytes.Buffer
+	for _, l := range []*Limiter{nilLimiter, {}} {
+		assert.True(t, l.Allow("test", Client{IP: "1.2.3.4"}))
+		assert.Equal(t, &buf, l.Writer(context.Background(), "test", Client{IP: "1.2.3.4"}, &buf))
+	}
+
+	_, err := NewLimiter(Config{Allowlist: []string{"not an ip"}})
+	assert.Error(t, err)
+	_, err = NewLimiter(Config{RequestsPerSecond: -1})
+	assert.Error(t, err)
+}
+
+func TestLimiter_MaxClients(t *testing.T) {
+	l, err := NewLimiter(Config{RequestsPerSecond: 1})
+	require.NoError(t, err)
+	for i := 0; i <= maxClients; i++ {
+		l.Allow("test", Client{IP: "1.2.3.4", Token: strconv.Itoa(i)})
+	}
+	assert.Len(t, l.clients, maxClients)
+}
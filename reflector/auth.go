@@ -0,0 +1,310 @@
+package reflector
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lbryio/reflector.go/db"
+	"github.com/lbryio/reflector.go/internal/metrics"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrUnauthorized  = errors.Base("invalid upload token")
+	ErrQuotaExceeded = errors.Base("daily upload quota exceeded")
+)
+
+const (
+	// ErrorCodeUnauthorized is sent to clients with a missing or unknown upload token
+	ErrorCodeUnauthorized = "unauthorized"
+	// ErrorCodeQuotaExceeded is sent to clients that used up their daily quota. Quotas reset at midnight UTC.
+	ErrorCodeQuotaExceeded = "quota_exceeded"
+
+	defaultAuthRefreshInterval = 5 * time.Minute
+)
+
+// uploader is the client of a connection, as authenticated in the handshake. Both fields are empty when the
+// server doesn't need tokens.
+type uploader struct {
+	name, token string
+}
+
+// errorCode returns the code sent to the client for the error, or "" if the error isn't sent
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return ErrorCodeUnauthorized
+	case errors.Is(err, ErrQuotaExceeded):
+		return ErrorCodeQuotaExceeded
+	default:
+		return ""
+	}
+}
+
+// UploadToken lets an uploader upload, within its daily quotas
+type UploadToken struct {
+	Name       string `mapstructure:"name"`
+	Token      string `mapstructure:"token"`
+	DailyBytes int64  `mapstructure:"daily_bytes"` // 0 means no limit
+	DailyBlobs int64  `mapstructure:"daily_blobs"` // 0 means no limit
+}
+
+// TokenSource provides the upload tokens accepted by the server
+type TokenSource interface {
+	Tokens() ([]UploadToken, error)
+}
+
+// StaticTokens are the tokens listed in the config file
+type StaticTokens []UploadToken
+
+func (t StaticTokens) Tokens() ([]UploadToken, error) { return t, nil }
+
+type DBTokensParams struct {
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Database string `mapstructure:"database"`
+	Table    string `mapstructure:"table"` // upload_token by default, see the schema in the db package
+}
+
+// DBTokens reads the tokens from a table. It connects to the database on the first read.
+type DBTokens struct {
+	dsn   string
+	table string
+
+	db   *db.SQL
+	dbMu sync.Mutex
+}
+
+// NewDBTokens returns an initialized DBTokens pointer
+func NewDBTokens(params DBTokensParams) *DBTokens {
+	if params.Table == "" {
+		params.Table = "upload_token"
+	}
+	return &DBTokens{
+		dsn:   fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", params.User, params.Password, params.Host, params.Port, params.Database),
+		table: params.Table,
+	}
+}
+
+func (d *DBTokens) Tokens() ([]UploadToken, error) {
+	d.dbMu.Lock()
+	defer d.dbMu.Unlock()
+	if d.db == nil {
+		conn := &db.SQL{}
+		err := conn.Connect(d.dsn)
+		if err != nil {
+			return nil, err
+		}
+		d.db = conn
+	}
+	tokens, err := d.db.UploadTokens(d.table)
+	if err != nil {
+		return nil, err
+	}
+	uploadTokens := make([]UploadToken, len(tokens))
+	for i, t := range tokens {
+		uploadTokens[i] = UploadToken{Name: t.Name, Token: t.Token, DailyBytes: t.DailyBytes, DailyBlobs: t.DailyBlobs}
+	}
+	return uploadTokens, nil
+}
+
+// AuthConfig is the upload_auth section of a config file. The tokens are listed in it or kept in a table.
+type AuthConfig struct {
+	RefreshInterval time.Duration   `mapstructure:"refresh_interval"`
+	Tokens          []UploadToken   `mapstructure:"tokens"`
+	DB              *DBTokensParams `mapstructure:"db"`
+}
+
+// Source returns the source of the tokens
+func (c AuthConfig) Source() (TokenSource, error) {
+	switch {
+	case c.DB != nil && len(c.Tokens) > 0:
+		return nil, errors.Err("upload_auth takes either tokens or db, not both")
+	case c.DB != nil:
+		p := c.DB
+		if p.User == "" || p.Password == "" || p.Host == "" || p.Port == 0 || p.Database == "" {
+			return nil, errors.Err("upload_auth db requires user, password, host, port and database")
+		}
+		return NewDBTokens(*p), nil
+	case len(c.Tokens) > 0:
+		for _, t := range c.Tokens {
+			if t.Name == "" || t.Token == "" {
+				return nil, errors.Err("upload_auth tokens need a name and a token")
+			}
+		}
+		return StaticTokens(c.Tokens), nil
+	default:
+		return nil, errors.Err("upload_auth needs tokens or a db")
+	}
+}
+
+// Auth checks the upload tokens and enforces their daily quotas. Usage is kept in memory, so it
+// starts over when the process restarts.
+type Auth struct {
+	mu sync.Mutex
+	// loadMu is held while the source is read, outside of mu, so a slow source doesn't hold up quota checks
+	loadMu          sync.Mutex
+	source          TokenSource
+	sourceVersion   int // counts the sources set, so a read can tell the source was replaced meanwhile
+	refreshInterval time.Duration
+	byToken         map[[sha256.Size]byte]UploadToken
+	loadedAt        time.Time
+
+	day  string                       // usage is counted for this day, as YYYY-MM-DD in UTC
+	used map[[sha256.Size]byte]*usage // by token hash
+}
+
+type usage struct {
+	bytes, blobs int64
+}
+
+// NewAuth returns an Auth without a source. It allows everything until it gets one.
+func NewAuth() *Auth {
+	return &Auth{used: make(map[[sha256.Size]byte]*usage)}
+}
+
+// SetSource replaces the source of the tokens, which is read again every refreshInterval. A nil source turns
+// authentication off. Quota usage is kept.
+func (a *Auth) SetSource(source TokenSource, refreshInterval time.Duration) {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultAuthRefreshInterval
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.source = source
+	a.sourceVersion++
+	a.refreshInterval = refreshInterval
+	a.byToken = nil
+	a.loadedAt = time.Time{}
+}
+
+// Enabled returns true if uploads need a token. A nil Auth has no source.
+func (a *Auth) Enabled() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.source != nil
+}
+
+// Authenticate returns the name of the uploader the token belongs to
+func (a *Auth) Authenticate(token string) (string, error) {
+	a.refresh()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	uploader, ok := a.byToken[sha256.Sum256([]byte(token))]
+	if token == "" || !ok {
+		return "", errors.Err(ErrUnauthorized)
+	}
+	return uploader.Name, nil
+}
+
+// Reserve counts blobs and bytes against the daily quotas of the token, or returns ErrQuotaExceeded if they
+// don't fit. Uploads without a token have no quotas.
+func (a *Auth) Reserve(token string, blobs int, bytes int64) error {
+	if a == nil || token == "" {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := sha256.Sum256([]byte(token))
+	limits, ok := a.byToken[key]
+	if !ok {
+		return errors.Err(ErrUnauthorized)
+	}
+	u := a.usage(key)
+	if (limits.DailyBlobs > 0 && u.blobs+int64(blobs) > limits.DailyBlobs) ||
+		(limits.DailyBytes > 0 && u.bytes+bytes > limits.DailyBytes) {
+		metrics.UploaderQuotaExceeded.WithLabelValues(limits.Name).Inc()
+		return errors.Err(ErrQuotaExceeded)
+	}
+	u.blobs += int64(blobs)
+	u.bytes += bytes
+	return nil
+}
+
+// Release gives back what was reserved for blobs that weren't received
+func (a *Auth) Release(token string, blobs int, bytes int64) {
+	if a == nil || token == "" || (blobs == 0 && bytes == 0) {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u := a.usage(sha256.Sum256([]byte(token)))
+	u.blobs = max(u.blobs-int64(blobs), 0)
+	u.bytes = max(u.bytes-bytes, 0)
+}
+
+// usage returns today's usage of the token
+func (a *Auth) usage(key [sha256.Size]byte) *usage {
+	today := time.Now().UTC().Format(time.DateOnly)
+	if a.day != today {
+		a.day = today
+		a.used = make(map[[sha256.Size]byte]*usage)
+	}
+	u, ok := a.used[key]
+	if !ok {
+		u = &usage{}
+		a.used[key] = u
+	}
+	return u
+}
+
+// refresh reads the tokens again if they are older than the refresh interval. If the source fails, the tokens
+// read last are kept. While the source is read, the tokens read last are used, unless there are none yet.
+func (a *Auth) refresh() {
+	if !a.stale() {
+		return
+	}
+	a.mu.Lock()
+	loaded := a.byToken != nil
+	a.mu.Unlock()
+	if !loaded {
+		a.loadMu.Lock()
+	} else if !a.loadMu.TryLock() {
+		return // being read already
+	}
+	defer a.loadMu.Unlock()
+	if !a.stale() {
+		return // read while waiting
+	}
+
+	a.mu.Lock()
+	source, version := a.source, a.sourceVersion
+	a.mu.Unlock()
+	if source == nil {
+		return
+	}
+	tokens, err := source.Tokens()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sourceVersion != version {
+		return // replaced while it was read
+	}
+	a.loadedAt = time.Now()
+	if err != nil {
+		log.Errorln(errors.Prefix("loading upload tokens", err))
+		return
+	}
+	byToken := make(map[[sha256.Size]byte]UploadToken, len(tokens))
+	for _, t := range tokens {
+		byToken[sha256.Sum256([]byte(t.Token))] = t
+	}
+	a.byToken = byToken
+}
+
+// stale returns true if there is a source and its tokens are older than the refresh interval
+func (a *Auth) stale() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.source != nil && time.Since(a.loadedAt) >= a.refreshInterval
+}
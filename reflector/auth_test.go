@@ -0,0 +1,61 @@
+package reflector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowTokens blocks the second read until release is closed
+type slowTokens struct {
+	tokens  StaticTokens
+	reads   int
+	reading chan struct{} // closed when the second read starts
+	release chan struct{}
+}
+
+func (s *slowTokens) Tokens() ([]UploadToken, error) {
+	s.reads++
+	if s.reads == 2 {
+		close(s.reading)
+		<-s.release
+	}
+	return s.tokens, nil
+}
+
+func TestAuth_RefreshDoesNotBlockQuotas(t *testing.T) {
+	source := &slowTokens{tokens: StaticTokens{{Name: "uploader", Token: "secret", DailyBlobs: 10}}, reading: make(chan struct{}), release: make(chan struct{})}
+	a := NewAuth()
+	a.SetSource(source, time.Millisecond)
+	name, err := a.Authenticate("secret")
+	require.NoError(t, err)
+	assert.Equal(t, "uploader", name)
+
+	time.Sleep(2 * time.Millisecond)
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		_, _ = a.Authenticate("secret")
+	}()
+	<-source.reading
+
+	// while the source is being read, quotas are checked and the tokens read last are used
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, a.Reserve("secret", 1, 100))
+		a.Release("secret", 1, 100)
+		name, err := a.Authenticate("secret")
+		assert.NoError(t, err)
+		assert.Equal(t, "uploader", name)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("quota checks wait for the token source")
+	}
+	close(source.release)
+	<-refreshed
+}
@@ -0,0 +1,152 @@
+package reflector
+
+import (
+	"encoding/json"
+	"net"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Protocol v3 replaces the request and response per blob of v1 with batches:
+//
+//	client: {"blobs": [{"blob_hash": "...", "blob_size": 123, "is_sd_blob": true}, ...]}
+//	server: {"wanted_blobs": ["...", ...], "needed_blobs": ["...", ...]}
+//	client: the raw data of every wanted blob, back to back, in the order of wanted_blobs
+//	server: {"received_blobs": ["...", ...], "errors": {"<hash>": "..."}}
+//
+// needed_blobs lists the missing content blobs of the known streams whose sd blob was offered but not wanted.
+// A client may put the sd blob and all the content blobs of a stream in the same batch, with the sd blob first.
+
+// maxBatchSize is the most blobs a client can offer at once
+const maxBatchSize = 1000
+
+type offeredBlob struct {
+	Hash     string `json:"blob_hash"`
+	Size     int    `json:"blob_size"`
+	IsSDBlob bool   `json:"is_sd_blob,omitempty"`
+}
+
+type offerRequest struct {
+	Blobs []offeredBlob `json:"blobs"`
+}
+
+type offerResponse struct {
+	WantedBlobs []string `json:"wanted_blobs"`
+	NeededBlobs []string `json:"needed_blobs,omitempty"`
+}
+
+type batchTransferResponse struct {
+	ReceivedBlobs []string          `json:"received_blobs"`
+	Errors        map[string]string `json:"errors,omitempty"`
+}
+
+// receiveBatch answers an offer with the blobs the store wants, then reads and stores them. The wanted blobs
+// are counted against the quotas of the uploader as a whole: if they don't all fit, the offer is refused.
+func (s *Server) receiveBatch(conn net.Conn, up uploader) error {
+	var offer offerRequest
+	err := s.read(conn, &offer)
+	if err != nil {
+		return err
+	}
+	if len(offer.Blobs) == 0 {
+		return errors.Err("offer has no blobs")
+	}
+	if len(offer.Blobs) > maxBatchSize {
+		return errors.Err("offer has %d blobs, at most %d are allowed", len(offer.Blobs), maxBatchSize)
+	}
+
+	var response offerResponse
+	var wanted []offeredBlob
+	var wantedBytes int64
+	offered := make(map[string]bool, len(offer.Blobs))
+	for _, b := range offer.Blobs {
+		if b.Hash == "" {
+			return errors.Err("blob hash is empty")
+		}
+		if b.Size > maxBlobSize {
+			return errors.Prefix(b.Hash[:min(8, len(b.Hash))], ErrBlobTooBig)
+		}
+		if b.Size <= 0 {
+			return errors.Err("0-byte blob offered")
+		}
+		if offered[b.Hash] {
+			continue
+		}
+		offered[b.Hash] = true
+
+		wantsBlob, neededBlobs, err := s.wantsBlob(b.Hash, b.IsSDBlob)
+		if err != nil {
+			return err
+		}
+		response.NeededBlobs = append(response.NeededBlobs, neededBlobs...)
+		if wantsBlob {
+			wanted = append(wanted, b)
+			wantedBytes += int64(b.Size)
+			response.WantedBlobs = append(response.WantedBlobs, b.Hash)
+		}
+	}
+	err = s.Auth.Reserve(up.token, len(wanted), wantedBytes)
+	if err != nil {
+		return err
+	}
+	if response.WantedBlobs == nil {
+		response.WantedBlobs = []string{}
+	}
+	resp, err := json.Marshal(response)
+	if err != nil {
+		return errors.Err(err)
+	}
+	err = s.write(conn, resp)
+	if err != nil {
+		s.Auth.Release(up.token, len(wanted), wantedBytes)
+		return err
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	transfer := batchTransferResponse{ReceivedBlobs: []string{}}
+	for i, b := range wanted {
+		// the size was announced, so a bad blob doesn't desync the connection and the batch goes on
+		blob, err := s.readRawBlob(conn, b.Size)
+		if err != nil {
+			for _, unread := range wanted[i:] {
+				s.Auth.Release(up.token, 1, int64(unread.Size))
+			}
+			return errors.Prefix("error reading blob "+b.Hash[:min(8, len(b.Hash))], err)
+		}
+		if BlobHash(blob) != b.Hash {
+			s.Auth.Release(up.token, 1, int64(b.Size))
+			transfer.addError(b.Hash, errors.Err("hash of received blob data does not match hash from offer"))
+			continue
+		}
+		err = s.storeBlob(b.Hash, blob, b.IsSDBlob, up)
+		if err != nil {
+			s.Auth.Release(up.token, 1, int64(b.Size))
+			transfer.addError(b.Hash, err)
+			continue
+		}
+		log.Debugln("Got blob " + b.Hash[:8])
+		transfer.ReceivedBlobs = append(transfer.ReceivedBlobs, b.Hash)
+	}
+	resp, err = json.Marshal(transfer)
+	if err != nil {
+		return errors.Err(err)
+	}
+	return s.write(conn, resp)
+}
+
+// addError reports a blob of the batch that could not be received
+func (r *batchTransferResponse) addError(hash string, err error) {
+	if metrics.TrackError(metrics.DirectionUpload, err) {
+		log.Errorln(errors.FullTrace(err))
+	}
+	if r.Errors == nil {
+		r.Errors = make(map[string]string)
+	}
+	r.Errors[hash] = err.Error()
+}
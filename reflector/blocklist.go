@@ -1,159 +1,36 @@
 package reflector
 
 import (
-	"encoding/hex"
-	"encoding/json"
-	"net/http"
-	"strconv"
-	"strings"
-	"time"
-
-	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/blocklist"
 	"github.com/lbryio/reflector.go/store"
-	"github.com/lbryio/reflector.go/wallet"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
-	"github.com/lbryio/lbry.go/v2/extras/stop"
 
 	log "github.com/sirupsen/logrus"
 )
 
-const blocklistURL = "https://api.lbry.com/file/list_blocked"
-
+// enableBlocklist starts watching the blocklist sources and blocks every listed sd hash in the store
 func (s *Server) enableBlocklist(b store.Blocklister) {
-	walletServers := []string{
-		"a-hub1.odysee.com:50001",
-		"b-hub1.odysee.com:50001",
-		"c-hub1.odysee.com:50001",
-		"s-hub1.odysee.com:50001",
-	}
-
-	updateBlocklist(b, walletServers, s.grp.Ch())
-	t := time.NewTicker(12 * time.Hour)
-	for {
-		select {
-		case <-s.grp.Ch():
-			return
-		case <-t.C:
-			updateBlocklist(b, walletServers, s.grp.Ch())
-		}
-	}
-}
-
-func updateBlocklist(b store.Blocklister, walletServers []string, stopper stop.Chan) {
-	log.Debugf("blocklist update starting")
-	values, err := blockedSdHashes(walletServers, stopper)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-
-	for name, v := range values {
-		if v.Err != nil {
-			log.Error(errors.FullTrace(errors.Err("blocklist: %s: %s", name, v.Err)))
-			continue
-		}
-
-		err = b.Block(v.Value)
-		if err != nil {
-			log.Error(err)
-		}
-	}
-	log.Debugf("blocklist update done")
+	sources := s.BlocklistSources
+	if len(sources) == 0 {
+		sources = blocklist.DefaultSources()
+	}
+	s.blocklist = blocklist.NewWatcher(sources, func(source blocklist.Source, hashes []string) {
+		for _, hash := range hashes {
+			err := b.Block(hash, store.BlockInfo{Reason: "listed by blocklist", Source: source.Name()})
+			if err != nil {
+				log.Error(errors.Prefix("blocklist "+source.Name(), err))
+			}
+		}
+	})
+	s.blocklist.Start()
 }
 
-func blockedSdHashes(walletServers []string, stopper stop.Chan) (map[string]valOrErr, error) {
-	client := http.Client{Timeout: 1 * time.Second}
-	resp, err := client.Get(blocklistURL)
-	if err != nil {
-		return nil, errors.Err(err)
-	}
-	defer func() {
-		closeErr := resp.Body.Close()
-		if closeErr != nil {
-			log.Errorln(errors.Err(closeErr))
-		}
-	}()
-
-	var r struct {
-		Error string `json:"error"`
-		Data  struct {
-			Outpoints []string `json:"outpoints"`
-		} `json:"data"`
-		Success bool `json:"success"`
+// ReloadBlocklist triggers a blocklist update without waiting for the next scheduled one
+func (s *Server) ReloadBlocklist() error {
+	if s.blocklist == nil {
+		return errors.Err("blocklist is not enabled")
 	}
-
-	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
-		return nil, errors.Err(err)
-	}
-
-	if !r.Success {
-		return nil, errors.Prefix("list_blocked API call", r.Error)
-	}
-
-	return sdHashesForOutpoints(walletServers, r.Data.Outpoints, stopper)
-}
-
-type valOrErr struct {
-	Err   error
-	Value string
-}
-
-// sdHashesForOutpoints queries wallet server for the sd hashes in a given outpoints
-func sdHashesForOutpoints(walletServers, outpoints []string, stopper stop.Chan) (map[string]valOrErr, error) {
-	values := make(map[string]valOrErr)
-
-	node := wallet.NewNode()
-	err := node.Connect(walletServers, nil)
-	if err != nil {
-		return nil, errors.Err(err)
-	}
-
-	done := make(chan bool)
-	metrics.RoutinesQueue.WithLabelValues("reflector", "sdhashesforoutput").Inc()
-	go func() {
-		defer metrics.RoutinesQueue.WithLabelValues("reflector", "sdhashesforoutput").Dec()
-		select {
-		case <-done:
-		case <-stopper:
-		}
-		node.Shutdown()
-	}()
-
-OutpointLoop:
-	for _, outpoint := range outpoints {
-		select {
-		case <-stopper:
-			break OutpointLoop
-		default:
-		}
-
-		parts := strings.Split(outpoint, ":")
-		if len(parts) != 2 {
-			values[outpoint] = valOrErr{Err: errors.Err("invalid outpoint format")}
-			continue
-		}
-
-		nout, err := strconv.Atoi(parts[1])
-		if err != nil {
-			values[outpoint] = valOrErr{Err: errors.Prefix("invalid nout", err)}
-			continue
-		}
-
-		claim, err := node.GetClaimInTx(parts[0], nout)
-		if err != nil {
-			values[outpoint] = valOrErr{Err: err}
-			continue
-		}
-
-		hash := hex.EncodeToString(claim.GetStream().GetSource().GetSdHash())
-		values[outpoint] = valOrErr{Value: hash, Err: nil}
-	}
-
-	select {
-	case done <- true:
-	default: // in case of race where stopper got stopped right after loop finished
-	}
-
-	return values, nil
+	s.blocklist.Reload()
+	return nil
 }
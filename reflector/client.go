@@ -1,7 +1,9 @@
 package reflector
 
 import (
+	"bufio"
 	"encoding/json"
+	"io"
 	"log"
 	"net"
 
@@ -14,19 +16,36 @@ var ErrBlobExists = errors.Base("blob exists on server")
 
 // Client is an instance of a client connected to a server.
 type Client struct {
+	// Token is sent in the handshake, for servers that need an upload token
+	Token string
+
 	conn      net.Conn
+	r         *bufio.Reader
 	connected bool
+	version   int
 }
 
-// Connect connects to a specific clients and errors if it cannot be contacted.
+// Connect connects to a specific clients and errors if it cannot be contacted. It uses protocol v3 if the server
+// supports it, and v1 otherwise.
 func (c *Client) Connect(address string) error {
+	err := c.connect(address, protocolVersion3)
+	if errors.Is(err, io.EOF) {
+		// servers older than v3 close the connection when asked for a version they don't know
+		_ = c.Close()
+		err = c.connect(address, protocolVersion1)
+	}
+	return err
+}
+
+func (c *Client) connect(address string, version int) error {
 	var err error
 	c.conn, err = net.Dial(network, address)
 	if err != nil {
 		return err
 	}
+	c.r = bufio.NewReader(c.conn)
 	c.connected = true
-	return c.doHandshake(protocolVersion1)
+	return c.doHandshake(version)
 }
 
 // Close closes the connection with the client.
@@ -45,6 +64,38 @@ func (c *Client) SendSDBlob(blob stream.Blob) error {
 	return c.sendBlob(blob, true)
 }
 
+// SendStream sends the blobs of a stream the server doesn't have yet, the sd blob first, and returns how many
+// were sent. With protocol v3 the blobs are offered in batches and sent without waiting for each other.
+func (c *Client) SendStream(st stream.Stream) (int, error) {
+	if !c.connected {
+		return 0, errors.Err("not connected")
+	}
+	if c.version != protocolVersion3 {
+		sent := 0
+		for i, b := range st {
+			err := c.sendBlob(b, i == 0)
+			if errors.Is(err, ErrBlobExists) {
+				continue
+			} else if err != nil {
+				return sent, err
+			}
+			sent++
+		}
+		return sent, nil
+	}
+
+	sent := 0
+	for start := 0; start < len(st); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(st))
+		n, err := c.sendBatch(st[start:end], start == 0)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
 // sendBlob does the actual blob sending
 func (c *Client) sendBlob(blob stream.Blob, isSDBlob bool) error {
 	if !c.connected {
@@ -56,6 +107,17 @@ func (c *Client) sendBlob(blob stream.Blob, isSDBlob bool) error {
 	}
 
 	blobHash := blob.HashHex()
+	if c.version == protocolVersion3 {
+		sent, err := c.sendBatch([]stream.Blob{blob}, isSDBlob)
+		if err != nil {
+			return err
+		}
+		if sent == 0 {
+			return errors.Prefix(blobHash[:8], ErrBlobExists)
+		}
+		return nil
+	}
+
 	var req sendBlobRequest
 	if isSDBlob {
 		req.SdBlobSize = blob.Size()
@@ -74,11 +136,9 @@ func (c *Client) sendBlob(blob stream.Blob, isSDBlob bool) error {
 		return err
 	}
 
-	dec := json.NewDecoder(c.conn)
-
 	if isSDBlob {
 		var sendResp sendSdBlobResponse
-		err = dec.Decode(&sendResp)
+		err = c.read(&sendResp)
 		if err != nil {
 			return err
 		}
@@ -88,7 +148,7 @@ func (c *Client) sendBlob(blob stream.Blob, isSDBlob bool) error {
 		log.Println("Sending SD blob " + blobHash[:8])
 	} else {
 		var sendResp sendBlobResponse
-		err = dec.Decode(&sendResp)
+		err = c.read(&sendResp)
 		if err != nil {
 			return err
 		}
@@ -105,7 +165,7 @@ func (c *Client) sendBlob(blob stream.Blob, isSDBlob bool) error {
 
 	if isSDBlob {
 		var transferResp sdBlobTransferResponse
-		err = dec.Decode(&transferResp)
+		err = c.read(&transferResp)
 		if err != nil {
 			return err
 		}
@@ -114,7 +174,7 @@ func (c *Client) sendBlob(blob stream.Blob, isSDBlob bool) error {
 		}
 	} else {
 		var transferResp blobTransferResponse
-		err = dec.Decode(&transferResp)
+		err = c.read(&transferResp)
 		if err != nil {
 			return err
 		}
@@ -126,12 +186,92 @@ func (c *Client) sendBlob(blob stream.Blob, isSDBlob bool) error {
 	return nil
 }
 
+// sendBatch offers the blobs to the server and sends the ones it wants in one go. If firstIsSD is true, the
+// first blob is the sd blob of the stream. It returns how many blobs the server received.
+func (c *Client) sendBatch(blobs []stream.Blob, firstIsSD bool) (int, error) {
+	var offer offerRequest
+	byHash := make(map[string]stream.Blob, len(blobs))
+	for i, b := range blobs {
+		if err := b.ValidForSend(); err != nil {
+			return 0, errors.Err(err)
+		}
+		hash := b.HashHex()
+		byHash[hash] = b
+		offer.Blobs = append(offer.Blobs, offeredBlob{Hash: hash, Size: b.Size(), IsSDBlob: firstIsSD && i == 0})
+	}
+	request, err := json.Marshal(offer)
+	if err != nil {
+		return 0, errors.Err(err)
+	}
+	_, err = c.conn.Write(request)
+	if err != nil {
+		return 0, errors.Err(err)
+	}
+
+	var offerResp offerResponse
+	err = c.read(&offerResp)
+	if err != nil {
+		return 0, err
+	}
+	if len(offerResp.WantedBlobs) == 0 {
+		return 0, nil
+	}
+
+	w := bufio.NewWriter(c.conn)
+	for _, hash := range offerResp.WantedBlobs {
+		b, ok := byHash[hash]
+		if !ok {
+			return 0, errors.Err("server wants blob %s, which was not offered", hash)
+		}
+		_, err = w.Write(b)
+		if err != nil {
+			return 0, errors.Err(err)
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		return 0, errors.Err(err)
+	}
+	log.Printf("Sent %d of %d blobs", len(offerResp.WantedBlobs), len(blobs))
+
+	var transferResp batchTransferResponse
+	err = c.read(&transferResp)
+	if err != nil {
+		return 0, err
+	}
+	for hash, msg := range transferResp.Errors {
+		return len(transferResp.ReceivedBlobs), errors.Err("server did not receive blob %s: %s", hash[:8], msg)
+	}
+	return len(transferResp.ReceivedBlobs), nil
+}
+
+// read reads the next response of the server. Error responses are returned as ErrUnauthorized or
+// ErrQuotaExceeded.
+func (c *Client) read(v interface{}) error {
+	msg, err := readMessage(c.r)
+	if err != nil {
+		return err
+	}
+	var errResp errorResponse
+	if json.Unmarshal(msg, &errResp) == nil && errResp.Code != "" {
+		switch errResp.Code {
+		case ErrorCodeUnauthorized:
+			return errors.Err(ErrUnauthorized)
+		case ErrorCodeQuotaExceeded:
+			return errors.Err(ErrQuotaExceeded)
+		default:
+			return errors.Err("server error %s: %s", errResp.Code, errResp.Error)
+		}
+	}
+	return errors.Err(json.Unmarshal(msg, v))
+}
+
 func (c *Client) doHandshake(version int) error {
 	if !c.connected {
 		return errors.Err("not connected")
 	}
 
-	handshake, err := json.Marshal(handshakeRequestResponse{Version: &version})
+	handshake, err := json.Marshal(handshakeRequestResponse{Version: &version, Token: c.Token})
 	if err != nil {
 		return err
 	}
@@ -142,14 +282,15 @@ func (c *Client) doHandshake(version int) error {
 	}
 
 	var resp handshakeRequestResponse
-	err = json.NewDecoder(c.conn).Decode(&resp)
+	err = c.read(&resp)
 	if err != nil {
 		return err
 	} else if resp.Version == nil {
 		return errors.Err("invalid handshake")
-	} else if *resp.Version != version {
+	} else if *resp.Version > version || *resp.Version < protocolVersion1 {
 		return errors.Err("handshake version mismatch")
 	}
+	c.version = *resp.Version
 
 	return nil
 }
@@ -0,0 +1,180 @@
+package reflector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lbryio/reflector.go/events"
+	"github.com/lbryio/reflector.go/shared"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxPendingStreams is how many incomplete streams are followed at once. Streams above it get no event.
+	maxPendingStreams = 10000
+	// pendingStreamTTL is how long a stream is followed after its last blob arrived
+	pendingStreamTTL = time.Hour
+)
+
+// completions follows the streams whose missing blobs are being uploaded, so the server can tell when the
+// last one arrives
+type completions struct {
+	mu      sync.Mutex
+	streams map[string]*pendingStream // by sd hash
+	byBlob  map[string][]string       // the sd hashes of the pending streams that miss each blob
+}
+
+type pendingStream struct {
+	missing map[string]bool
+	expires time.Time
+}
+
+func newCompletions() *completions {
+	return &completions{streams: make(map[string]*pendingStream), byBlob: make(map[string][]string)}
+}
+
+// track follows a stream until its missing blobs are received
+func (c *completions) track(sdHash string, missing []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(sdHash)
+	if len(c.streams) >= maxPendingStreams {
+		c.expire()
+		if len(c.streams) >= maxPendingStreams {
+			log.Debugf("not following stream %s, %d streams are already pending", sdHash[:8], len(c.streams))
+			return
+		}
+	}
+	p := &pendingStream{missing: make(map[string]bool, len(missing)), expires: time.Now().Add(pendingStreamTTL)}
+	for _, hash := range missing {
+		p.missing[hash] = true
+		c.byBlob[hash] = append(c.byBlob[hash], sdHash)
+	}
+	c.streams[sdHash] = p
+}
+
+// received marks a blob as uploaded and returns the sd hashes of the streams it was the last missing blob of.
+// Those streams are no longer followed.
+func (c *completions) received(hash string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var done []string
+	for _, sdHash := range c.byBlob[hash] {
+		p := c.streams[sdHash]
+		delete(p.missing, hash)
+		p.expires = time.Now().Add(pendingStreamTTL)
+		if len(p.missing) == 0 {
+			done = append(done, sdHash)
+		}
+	}
+	delete(c.byBlob, hash)
+	for _, sdHash := range done {
+		delete(c.streams, sdHash)
+	}
+	return done
+}
+
+// remove stops following a stream. c.mu must be held.
+func (c *completions) remove(sdHash string) {
+	p, ok := c.streams[sdHash]
+	if !ok {
+		return
+	}
+	delete(c.streams, sdHash)
+	for hash := range p.missing {
+		sdHashes := c.byBlob[hash]
+		for i, s := range sdHashes {
+			if s == sdHash {
+				sdHashes = append(sdHashes[:i], sdHashes[i+1:]...)
+				break
+			}
+		}
+		if len(sdHashes) == 0 {
+			delete(c.byBlob, hash)
+		} else {
+			c.byBlob[hash] = sdHashes
+		}
+	}
+}
+
+// expire stops following the streams that got no blob for pendingStreamTTL. c.mu must be held.
+func (c *completions) expire() {
+	now := time.Now()
+	for sdHash, p := range c.streams {
+		if now.After(p.expires) {
+			c.remove(sdHash)
+		}
+	}
+}
+
+// trackStream follows a known stream with missing blobs, as told by the store
+func (s *Server) trackStream(sdHash string, missing []string) {
+	if !s.Events.Enabled() || len(missing) == 0 {
+		return
+	}
+	s.completions.track(sdHash, missing)
+}
+
+// blobStored checks whether a stored blob completes a stream, and emits a stream_completed event for each
+// stream it completes. Only stores that can list the missing blobs of a stream are followed.
+func (s *Server) blobStored(blobHash string, isSdBlob bool, up uploader) {
+	if !s.Events.Enabled() {
+		return
+	}
+	nbc, ok := s.store.(store.NeededBlobChecker)
+	if !ok {
+		return
+	}
+
+	sdHashes := s.completions.received(blobHash)
+	if isSdBlob {
+		sdHashes = append(sdHashes, blobHash)
+	}
+	for _, sdHash := range sdHashes {
+		missing, err := nbc.MissingBlobsForKnownStream(sdHash)
+		if errors.Is(err, shared.ErrNotImplemented) {
+			return
+		} else if err != nil {
+			log.Errorln(errors.Prefix("checking whether stream "+sdHash[:8]+" is complete", err))
+			continue
+		}
+		if len(missing) > 0 {
+			// blobs the server didn't know were missing, e.g. because they were deleted since
+			s.completions.track(sdHash, missing)
+			continue
+		}
+		err = s.emitStreamCompleted(sdHash, up)
+		if err != nil {
+			log.Errorln(errors.Prefix("stream_completed event for "+sdHash[:8], err))
+		}
+	}
+}
+
+// emitStreamCompleted sends the stream_completed event of a stream, with the size read from its sd blob
+func (s *Server) emitStreamCompleted(sdHash string, up uploader) error {
+	blob, _, err := s.store.Get(sdHash)
+	if err != nil {
+		return err
+	}
+	var sd stream.SDBlob
+	err = sd.FromBlob(blob)
+	if err != nil {
+		return errors.Err(err)
+	}
+	var blobCount int
+	var totalSize int64
+	for _, info := range sd.BlobInfos {
+		if info.Length > 0 {
+			blobCount++
+			totalSize += int64(info.Length)
+		}
+	}
+	log.Debugf("stream %s completed", sdHash[:8])
+	s.Events.Emit(events.NewStreamCompleted(sdHash, blobCount, totalSize, up.name))
+	return nil
+}
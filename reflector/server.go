@@ -9,7 +9,12 @@ import (
 	"net"
 	"time"
 
+	"github.com/lbryio/reflector.go/blocklist"
+	"github.com/lbryio/reflector.go/events"
 	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/proxyproto"
+	"github.com/lbryio/reflector.go/ratelimit"
+	"github.com/lbryio/reflector.go/shared"
 	"github.com/lbryio/reflector.go/store"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
@@ -25,10 +30,14 @@ const (
 	// DefaultTimeout is the default timeout to read or write the next message
 	DefaultTimeout = 5 * time.Second
 
-	network          = "tcp4"
+	network          = "tcp"
 	protocolVersion1 = 0
 	protocolVersion2 = 1
+	// protocolVersion3 offers blobs in batches and sends the wanted ones back to back, see batch.go
+	protocolVersion3 = 2
 	maxBlobSize      = stream.MaxBlobSize
+	// maxMessageSize bounds the json messages, large enough for an offer of maxBatchSize blobs
+	maxMessageSize = 1 << 20
 )
 
 var ErrBlobTooBig = errors.Base("blob must be at most %d bytes", maxBlobSize)
@@ -40,6 +49,16 @@ type Server struct {
 	Timeout time.Duration // timeout to read or write next message
 
 	EnableBlocklist bool // if true, blocklist checking and blob deletion will be enabled
+	MaxConnections  int  // connections above this limit are refused. 0 means no limit
+
+	BlocklistSources []blocklist.Source  // lists of sd hashes to block. blocklist.DefaultSources() are used if empty
+	RateLimit        *ratelimit.Limiter  // connection rate and upload bandwidth of each client. nil means no limits
+	Auth             *Auth               // uploads need a token it knows, within its quotas, once it has a source. nil means no tokens
+	ProxyProtocol    *proxyproto.Trusted // read the PROXY protocol header of connections from these proxies. nil means none
+	Events           *events.Emitter     // gets a stream_completed event when the last missing blob of a stream arrives. nil means no events
+
+	blocklist   *blocklist.Watcher
+	completions *completions
 
 	//underlyingStore store.BlobStore
 	//outerStore      store.BlobStore
@@ -47,9 +66,10 @@ type Server struct {
 
 func NewIngestionServer(store store.BlobStore) *Server {
 	return &Server{
-		Timeout: DefaultTimeout,
-		store:   store,
-		grp:     stop.New(),
+		Timeout:     DefaultTimeout,
+		store:       store,
+		grp:         stop.New(),
+		completions: newCompletions(),
 	}
 }
 
@@ -57,15 +77,24 @@ func NewIngestionServer(store store.BlobStore) *Server {
 func (s *Server) Shutdown() {
 	log.Println("shutting down reflector server...")
 	s.grp.StopAndWait()
+	if s.blocklist != nil {
+		s.blocklist.Shutdown()
+	}
 	log.Println("reflector server stopped")
 }
 
 // Start starts the server to handle connections.
 func (s *Server) Start(address string) error {
+	if s.EnableBlocklist && !store.CanBlock(s.store) {
+		return errors.Err("blocklist is enabled but blob store does not support blocklisting")
+	}
 	l, err := net.Listen(network, address)
 	if err != nil {
 		return errors.Err(err)
 	}
+	if s.ProxyProtocol != nil {
+		l = proxyproto.NewListener(l, s.ProxyProtocol)
+	}
 	log.Println("reflector listening on " + address)
 	s.grp.Add(1)
 	metrics.RoutinesQueue.WithLabelValues("reflector", "listener").Inc()
@@ -88,24 +117,17 @@ func (s *Server) Start(address string) error {
 	}()
 
 	if s.EnableBlocklist {
-		if b, ok := s.store.(store.Blocklister); ok {
-			s.grp.Add(1)
-			metrics.RoutinesQueue.WithLabelValues("reflector", "enableblocklist").Inc()
-			go func() {
-				defer metrics.RoutinesQueue.WithLabelValues("reflector", "enableblocklist").Dec()
-				s.enableBlocklist(b)
-				s.grp.Done()
-			}()
-		} else {
-			//s.Shutdown()
-			return errors.Err("blocklist is enabled but blob store does not support blocklisting")
-		}
+		s.enableBlocklist(s.store.(store.Blocklister))
 	}
 
 	return nil
 }
 
 func (s *Server) listenAndServe(listener net.Listener) {
+	var slots chan struct{}
+	if s.MaxConnections > 0 {
+		slots = make(chan struct{}, s.MaxConnections)
+	}
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -114,17 +136,44 @@ func (s *Server) listenAndServe(listener net.Listener) {
 			}
 			log.Error(err)
 		} else {
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+				default:
+					log.Warnf("refusing connection from %s: max connections (%d) reached", conn.RemoteAddr(), s.MaxConnections)
+					_ = conn.Close()
+					continue
+				}
+			}
 			s.grp.Add(1)
 			metrics.RoutinesQueue.WithLabelValues("reflector", "server-listenandserve").Inc()
 			go func() {
 				defer metrics.RoutinesQueue.WithLabelValues("reflector", "server-listenandserve").Dec()
-				s.handleConn(conn)
+				// the address is only known once the PROXY protocol header is read, so this isn't done in the accept loop
+				client := ratelimit.Client{IP: remoteIP(conn)}
+				if s.RateLimit.Allow("reflector", client) {
+					s.handleConn(s.RateLimit.Conn("reflector", client, conn))
+				} else {
+					log.Debugf("refusing connection from %s: too many connections", conn.RemoteAddr())
+					_ = conn.Close()
+				}
+				if slots != nil {
+					<-slots
+				}
 				s.grp.Done()
 			}()
 		}
 	}
 }
 
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
 func (s *Server) handleConn(conn net.Conn) {
 	// all this stuff is to close the connections correctly when we're shutting down the server
 	connNeedsClosing := make(chan struct{})
@@ -146,25 +195,34 @@ func (s *Server) handleConn(conn net.Conn) {
 		}
 	}()
 
-	err := s.doHandshake(conn)
+	// messages are read from a buffer that is kept for the whole connection, since v3 clients send blobs right
+	// after their offer
+	conn = &bufferedConn{Conn: conn, r: bufio.NewReader(conn)}
+	version, up, err := s.doHandshake(conn)
+	// error responses are only understood by clients that know about upload tokens, older ones are hung up on
+	sendErrors := version == protocolVersion3 || up.token != ""
 	if err != nil {
 		if errors.Is(err, io.EOF) || s.quitting() {
 			return
 		}
-		err = s.doError(conn, err)
+		err = s.doError(conn, err, sendErrors)
 		if err != nil {
 			log.Error(errors.Prefix("sending handshake error", err))
 		}
 		return
 	}
 
+	receive := s.receiveBlob
+	if version == protocolVersion3 {
+		receive = s.receiveBatch
+	}
 	for {
-		err = s.receiveBlob(conn)
+		err = receive(conn, up)
 		if err != nil {
 			if errors.Is(err, io.EOF) || s.quitting() {
 				return
 			}
-			err = s.doError(conn, err)
+			err = s.doError(conn, err, sendErrors)
 			if err != nil {
 				log.Error(errors.Prefix("sending blob receive error", err))
 			}
@@ -173,7 +231,8 @@ func (s *Server) handleConn(conn net.Conn) {
 	}
 }
 
-func (s *Server) doError(conn net.Conn, err error) error {
+// doError logs the error and, if sendErrors is set, sends the client the errors it can act on
+func (s *Server) doError(conn net.Conn, err error, sendErrors bool) error {
 	if err == nil {
 		return nil
 	}
@@ -184,50 +243,33 @@ func (s *Server) doError(conn net.Conn, err error) error {
 	if e2, ok := err.(*json.SyntaxError); ok {
 		log.Errorf("syntax error at byte offset %d", e2.Offset)
 	}
-	//resp, err := json.Marshal(errorResponse{Error: err.Error()})
-	//if err != nil {
-	//	return err
-	//}
-	//return s.write(conn, resp)
-	return nil
+	code := errorCode(err)
+	if code == "" || !sendErrors {
+		return nil
+	}
+	resp, err := json.Marshal(errorResponse{Error: err.Error(), Code: code})
+	if err != nil {
+		return errors.Err(err)
+	}
+	return s.write(conn, resp)
 }
 
-func (s *Server) receiveBlob(conn net.Conn) error {
+func (s *Server) receiveBlob(conn net.Conn, up uploader) error {
 	blobSize, blobHash, isSdBlob, err := s.readBlobRequest(conn)
 	if err != nil {
 		return err
 	}
 
-	var wantsBlob bool
-	if bl, ok := s.store.(store.Blocklister); ok {
-		wantsBlob, err = bl.Wants(blobHash)
-		if err != nil {
-			return err
-		}
-	} else {
-		var blobExists bool
-		blobExists, err = s.store.Has(blobHash)
+	wantsBlob, neededBlobs, err := s.wantsBlob(blobHash, isSdBlob)
+	if err != nil {
+		return err
+	}
+	if wantsBlob {
+		err = s.Auth.Reserve(up.token, 1, int64(blobSize))
 		if err != nil {
 			return err
 		}
-		wantsBlob = !blobExists
 	}
-
-	var neededBlobs []string
-
-	if isSdBlob && !wantsBlob {
-		if nbc, ok := s.store.(store.NeededBlobChecker); ok {
-			neededBlobs, err = nbc.MissingBlobsForKnownStream(blobHash)
-			if err != nil {
-				return err
-			}
-		} else {
-			// if we can't check for blobs in a stream, we have to say that the sd blob is
-			// missing. if we say we have the sd blob, they won't try to send any content blobs
-			wantsBlob = true
-		}
-	}
-
 	err = s.sendBlobResponse(conn, wantsBlob, isSdBlob, neededBlobs)
 	if err != nil {
 		return err
@@ -239,6 +281,7 @@ func (s *Server) receiveBlob(conn net.Conn) error {
 
 	blob, err := s.readRawBlob(conn, blobSize)
 	if err != nil {
+		s.Auth.Release(up.token, 1, int64(blobSize))
 		sendErr := s.sendTransferResponse(conn, false, isSdBlob)
 		if sendErr != nil {
 			return sendErr
@@ -248,6 +291,7 @@ func (s *Server) receiveBlob(conn net.Conn) error {
 
 	receivedBlobHash := BlobHash(blob)
 	if blobHash != receivedBlobHash {
+		s.Auth.Release(up.token, 1, int64(blobSize))
 		sendErr := s.sendTransferResponse(conn, false, isSdBlob)
 		if sendErr != nil {
 			return sendErr
@@ -258,7 +302,69 @@ func (s *Server) receiveBlob(conn net.Conn) error {
 
 	log.Debugln("Got blob " + blobHash[:8])
 
+	err = s.storeBlob(blobHash, blob, isSdBlob, up)
+	if err != nil {
+		s.Auth.Release(up.token, 1, int64(blobSize))
+		if errors.Is(err, shared.ErrInvalidSDBlob) {
+			sendErr := s.sendTransferResponse(conn, false, isSdBlob)
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+		return err
+	}
+	return s.sendTransferResponse(conn, true, isSdBlob)
+}
+
+// wantsBlob returns whether the store wants the blob. For an sd blob it doesn't want, it also returns the
+// content blobs of the stream that are still missing.
+func (s *Server) wantsBlob(blobHash string, isSdBlob bool) (bool, []string, error) {
+	var wantsBlob bool
+	var err error
+	if bl, ok := s.store.(store.Blocklister); ok {
+		wantsBlob, err = bl.Wants(blobHash)
+		if err != nil {
+			return false, nil, err
+		}
+	} else {
+		var blobExists bool
+		blobExists, err = s.store.Has(blobHash)
+		if err != nil {
+			return false, nil, err
+		}
+		wantsBlob = !blobExists
+	}
+
+	var neededBlobs []string
+
+	if isSdBlob && !wantsBlob {
+		if nbc, ok := s.store.(store.NeededBlobChecker); ok {
+			neededBlobs, err = nbc.MissingBlobsForKnownStream(blobHash)
+			if errors.Is(err, shared.ErrNotImplemented) {
+				// same as below, the wrapped store can't tell us which blobs are missing
+				wantsBlob = true
+			} else if err != nil {
+				return false, nil, err
+			} else {
+				s.trackStream(blobHash, neededBlobs)
+			}
+		} else {
+			// if we can't check for blobs in a stream, we have to say that the sd blob is
+			// missing. if we say we have the sd blob, they won't try to send any content blobs
+			wantsBlob = true
+		}
+	}
+	return wantsBlob, neededBlobs, nil
+}
+
+// storeBlob puts a blob received from the uploader in the store. Sd blobs must describe a valid stream.
+func (s *Server) storeBlob(blobHash string, blob []byte, isSdBlob bool, up uploader) error {
+	var err error
 	if isSdBlob {
+		err = shared.ValidateSDBlob(blob)
+		if err != nil {
+			return err
+		}
 		err = s.store.PutSD(blobHash, blob)
 	} else {
 		err = s.store.Put(blobHash, blob)
@@ -271,26 +377,48 @@ func (s *Server) receiveBlob(conn net.Conn) error {
 	if isSdBlob {
 		metrics.SDBlobUploadCount.Inc()
 	}
-	return s.sendTransferResponse(conn, true, isSdBlob)
+	if up.name != "" {
+		metrics.UploaderBlobCount.WithLabelValues(up.name).Inc()
+		metrics.UploaderInBytes.WithLabelValues(up.name).Add(float64(len(blob)))
+	}
+	s.blobStored(blobHash, isSdBlob, up)
+	return nil
 }
 
-func (s *Server) doHandshake(conn net.Conn) error {
+// doHandshake agrees on the protocol version with the client. Clients asking for a version newer than the
+// server knows get the newest one the server has, and may go on with it. If the server needs upload tokens,
+// the client must send a valid one along with its version. When the token is refused, the version and the
+// token the client sent are returned along with the error.
+func (s *Server) doHandshake(conn net.Conn) (int, uploader, error) {
 	var handshake handshakeRequestResponse
 	err := s.read(conn, &handshake)
 	if err != nil {
-		return err
+		return 0, uploader{}, err
 	} else if handshake.Version == nil {
-		return errors.Err("handshake is missing protocol version")
-	} else if *handshake.Version != protocolVersion1 && *handshake.Version != protocolVersion2 {
-		return errors.Err("protocol version not supported")
+		return 0, uploader{}, errors.Err("handshake is missing protocol version")
+	} else if *handshake.Version < protocolVersion1 {
+		return 0, uploader{}, errors.Err("protocol version not supported")
+	}
+	version := *handshake.Version
+	if version > protocolVersion3 {
+		version = protocolVersion3
 	}
 
-	resp, err := json.Marshal(handshakeRequestResponse{Version: handshake.Version})
+	var up uploader
+	if s.Auth.Enabled() {
+		up.token = handshake.Token
+		up.name, err = s.Auth.Authenticate(handshake.Token)
+		if err != nil {
+			return version, up, err
+		}
+	}
+
+	resp, err := json.Marshal(handshakeRequestResponse{Version: &version})
 	if err != nil {
-		return err
+		return 0, uploader{}, err
 	}
 
-	return s.write(conn, resp)
+	return version, up, s.write(conn, resp)
 }
 
 func (s *Server) readBlobRequest(conn net.Conn) (int, string, bool, error) {
@@ -363,14 +491,17 @@ func (s *Server) read(conn net.Conn, v interface{}) error {
 		return errors.Err(err)
 	}
 
-	dec := json.NewDecoder(conn)
-	err = dec.Decode(v)
+	r, ok := conn.(io.ByteReader)
+	if !ok {
+		r = bufio.NewReader(conn) // only safe when nothing follows the message
+	}
+	msg, err := readMessage(r)
 	if err != nil {
-		data, _ := io.ReadAll(dec.Buffered())
-		if len(data) > 0 {
-			return errors.Err("%s. Data: %s", err.Error(), hex.EncodeToString(data))
-		}
-		return errors.Err(err)
+		return err
+	}
+	err = json.Unmarshal(msg, v)
+	if err != nil {
+		return errors.Err("%s. Data: %s", err.Error(), hex.EncodeToString(msg))
 	}
 	return nil
 }
@@ -382,7 +513,7 @@ func (s *Server) readRawBlob(conn net.Conn, blobSize int) ([]byte, error) {
 	}
 
 	blob := make([]byte, blobSize)
-	_, err = io.ReadFull(bufio.NewReader(conn), blob)
+	_, err = io.ReadFull(conn, blob)
 	return blob, errors.Err(err)
 }
 
@@ -414,17 +545,82 @@ func BlobHash(blob []byte) string {
 	return hex.EncodeToString(hashBytes[:])
 }
 
+// bufferedConn reads a connection through a buffer, so messages can be read byte by byte
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *bufferedConn) ReadByte() (byte, error) {
+	return c.r.ReadByte()
+}
+
+// readMessage reads one json object from r without reading past its end, so the raw blob sent right after
+// a message is left for the next read
+func readMessage(r io.ByteReader) ([]byte, error) {
+	var msg []byte
+	depth := 0
+	inString, escaped := false, false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(msg) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, errors.Err(err)
+		}
+		if len(msg) == 0 {
+			if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+				continue
+			}
+			if b != '{' {
+				return nil, errors.Err("expected a json object, got %q", b)
+			}
+		}
+		msg = append(msg, b)
+		if len(msg) > maxMessageSize {
+			return nil, errors.Err("message is larger than %d bytes", maxMessageSize)
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			if b == '\\' {
+				escaped = true
+			} else if b == '"' {
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '{' || b == '[':
+			depth++
+		case b == '}' || b == ']':
+			depth--
+			if depth == 0 {
+				return msg, nil
+			}
+		}
+	}
+}
+
 func IsValidJSON(b []byte) bool {
 	var r json.RawMessage
 	return json.Unmarshal(b, &r) == nil
 }
 
-//type errorResponse struct {
-//	Error string `json:"error"`
-//}
+// errorResponse is sent before closing the connection, for the errors listed in errorCode
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"error_code"`
+}
 
 type handshakeRequestResponse struct {
-	Version *int `json:"version"`
+	Version *int   `json:"version"`
+	Token   string `json:"token,omitempty"`
 }
 
 type sendBlobRequest struct {
@@ -1,17 +1,25 @@
 package reflector
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"io"
+	"net"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/lbryio/reflector.go/events"
 	"github.com/lbryio/reflector.go/store"
 
 	"github.com/lbryio/lbry.go/v2/dht/bits"
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/stream"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/phayes/freeport"
@@ -110,6 +118,22 @@ func TestServer_TooBigBlob(t *testing.T) {
 	}
 }
 
+func TestServer_StartWithoutBlocklister(t *testing.T) {
+	port, err := freeport.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a reloadable store implements Blocklister, but the store it forwards to can't block
+	srv := NewIngestionServer(store.NewReloadableStore(store.NewMemStore(store.MemParams{Name: "test"})))
+	srv.EnableBlocklist = true
+	err = srv.Start("127.0.0.1:" + strconv.Itoa(port))
+	if err == nil {
+		srv.Shutdown()
+		t.Fatal("expected the server to refuse a blocklist it can't enforce")
+	}
+}
+
 func TestServer_Timeout(t *testing.T) {
 	t.Skip("server and client have no way to detect errors right now")
 
@@ -145,6 +169,35 @@ func TestServer_Timeout(t *testing.T) {
 	}
 }
 
+func TestServer_MaxConnections(t *testing.T) {
+	port, err := freeport.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewIngestionServer(store.NewMemStore(store.MemParams{Name: "test"}))
+	srv.MaxConnections = 1
+	err = srv.Start("127.0.0.1:" + strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown()
+
+	c := Client{}
+	err = c.Connect(":" + strconv.Itoa(port))
+	if err != nil {
+		t.Fatal("error connecting client to server", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	c2 := Client{}
+	err = c2.Connect(":" + strconv.Itoa(port))
+	if err == nil {
+		_ = c2.Close()
+		t.Error("server should refuse connections above the limit")
+	}
+}
+
 //func TestServer_InvalidJSONHandshake(t *testing.T) {
 //	srv, port := startServerOnRandomPort(t)
 //	defer srv.Shutdown()
@@ -199,7 +252,7 @@ func TestServer_PartialUpload(t *testing.T) {
 	defer srv.Shutdown()
 
 	c := Client{}
-	err = c.Connect(":" + strconv.Itoa(port))
+	err = c.connect(":"+strconv.Itoa(port), protocolVersion2)
 	if err != nil {
 		t.Fatal("error connecting client to server", err)
 	}
@@ -241,6 +294,275 @@ func TestServer_PartialUpload(t *testing.T) {
 	}
 }
 
+func TestServer_Batch(t *testing.T) {
+	srv, port := startServerOnRandomPort(t)
+	defer srv.Shutdown()
+
+	c := Client{}
+	err := c.Connect(":" + strconv.Itoa(port))
+	if err != nil {
+		t.Fatal("error connecting client to server", err)
+	}
+	defer func() { _ = c.Close() }()
+	if c.version != protocolVersion3 {
+		t.Fatalf("expected protocol v3, got %d", c.version)
+	}
+
+	// an sd blob and four content blobs
+	st, err := stream.New(bytes.NewReader(randBlob(3*maxBlobSize + 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SendBlob(st[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := c.SendStream(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != len(st)-1 {
+		t.Errorf("expected %d blobs to be sent, got %d", len(st)-1, sent)
+	}
+	for _, b := range st {
+		has, err := srv.store.Has(b.HashHex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			t.Errorf("blob %s was not stored", b.HashHex()[:8])
+		}
+	}
+
+	sent, err = c.SendStream(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the mem store can't tell which blobs of a known stream are missing, so it always wants the sd blob
+	if sent != 1 {
+		t.Errorf("expected only the sd blob to be sent again, got %d", sent)
+	}
+	err = c.SendBlob(st[0])
+	if !errors.Is(err, ErrBlobExists) {
+		t.Errorf("expected ErrBlobExists, got %v", err)
+	}
+}
+
+func TestServer_UploadAuth(t *testing.T) {
+	srv, port := startServerOnRandomPort(t)
+	defer srv.Shutdown()
+	srv.Auth = NewAuth()
+	srv.Auth.SetSource(StaticTokens{
+		{Name: "v1 uploader", Token: "secret1", DailyBlobs: 2},
+		{Name: "v3 uploader", Token: "secret3", DailyBlobs: 2},
+	}, 0)
+
+	c := Client{Token: "wrong"}
+	err := c.Connect(":" + strconv.Itoa(port))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+
+	// a v1 client without a token doesn't know about error responses, so it is hung up on
+	conn, err := net.Dial("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, err = conn.Write([]byte(`{"version": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response) > 0 {
+		t.Errorf("expected the connection to be closed without a response, got %s", response)
+	}
+
+	for _, version := range []int{protocolVersion1, protocolVersion3} {
+		// each version has its own token, so it starts with a full quota
+		c = Client{Token: "secret" + strconv.Itoa(version+1)}
+		err = c.connect(":"+strconv.Itoa(port), version)
+		if err != nil {
+			t.Fatal("error connecting client to server", err)
+		}
+		for i := 0; i < 2; i++ {
+			err = c.SendBlob(randBlob(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = c.SendBlob(randBlob(100))
+		if !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("v%d: expected ErrQuotaExceeded, got %v", version, err)
+		}
+		_ = c.Close()
+	}
+}
+
+// streamStore knows which blobs of its streams are missing, like a db backed store
+type streamStore struct {
+	*store.MemStore
+}
+
+func (s streamStore) MissingBlobsForKnownStream(sdHash string) ([]string, error) {
+	blob, _, err := s.Get(sdHash)
+	if err != nil {
+		return nil, err
+	}
+	var sd stream.SDBlob
+	err = sd.FromBlob(blob)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, info := range sd.BlobInfos {
+		if info.Length == 0 {
+			continue
+		}
+		has, err := s.Has(hex.EncodeToString(info.BlobHash))
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			missing = append(missing, hex.EncodeToString(info.BlobHash))
+		}
+	}
+	return missing, nil
+}
+
+func TestServer_StreamCompleted(t *testing.T) {
+	port, err := freeport.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewIngestionServer(streamStore{MemStore: store.NewMemStore(store.MemParams{Name: "test"})})
+	completed := events.NewChannel(10)
+	srv.Events = events.NewEmitter(completed)
+	defer srv.Events.Shutdown()
+	srv.Auth = NewAuth()
+	srv.Auth.SetSource(StaticTokens{{Name: "uploader", Token: "secret"}}, 0)
+	err = srv.Start("127.0.0.1:" + strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown()
+
+	data := randBlob(2*maxBlobSize + 1000)
+	st, err := stream.New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []int{protocolVersion1, protocolVersion3} {
+		c := Client{Token: "secret"}
+		err = c.connect(":"+strconv.Itoa(port), version)
+		if err != nil {
+			t.Fatal("error connecting client to server", err)
+		}
+		// the sd blob and the first content blob, then the rest of the stream
+		err = c.SendSDBlob(st[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.SendBlob(st[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case e := <-completed.C():
+			t.Fatalf("v%d: stream completed with missing blobs: %+v", version, e)
+		default:
+		}
+		_, err = c.SendStream(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = c.Close()
+
+		select {
+		case e := <-completed.C():
+			if e.SDHash != st[0].HashHex() || e.BlobCount != len(st)-1 || e.Uploader != "uploader" {
+				t.Errorf("v%d: unexpected event %+v", version, e)
+			}
+			var size int64
+			for _, b := range st[1:] {
+				size += int64(b.Size())
+			}
+			if e.TotalSize != size {
+				t.Errorf("v%d: expected a total size of %d, got %d", version, size, e.TotalSize)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("v%d: no stream_completed event", version)
+		}
+
+		select {
+		case e := <-completed.C():
+			t.Errorf("v%d: stream completed twice: %+v", version, e)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		// the next version uploads the stream again
+		for _, b := range st {
+			err = srv.store.Delete(b.HashHex())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestClient_FallbackToV1(t *testing.T) {
+	// a server that only knows v0 and v1, and hangs up on anything else
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var handshake handshakeRequestResponse
+			err = json.NewDecoder(conn).Decode(&handshake)
+			if err == nil && handshake.Version != nil && *handshake.Version <= protocolVersion2 {
+				resp, _ := json.Marshal(handshake)
+				_, _ = conn.Write(resp)
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	c := Client{}
+	err = c.Connect(l.Addr().String())
+	if err != nil {
+		t.Fatal("error connecting client to server", err)
+	}
+	if c.version != protocolVersion1 {
+		t.Errorf("expected protocol v1, got %d", c.version)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader(` {"a":"}{\"","b":[{}]}rawdata`))
+	msg, err := readMessage(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != `{"a":"}{\"","b":[{}]}` {
+		t.Errorf("unexpected message %s", msg)
+	}
+	rest, _ := io.ReadAll(r)
+	if string(rest) != "rawdata" {
+		t.Errorf("message read too far, left %q", rest)
+	}
+}
+
 func randBlob(size int) []byte {
 	//if size > maxBlobSize {
 	//	panic("blob size too big")
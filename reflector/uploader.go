@@ -8,6 +8,7 @@ import (
 
 	"github.com/lbryio/reflector.go/db"
 	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/shared"
 	"github.com/lbryio/reflector.go/store"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
@@ -175,6 +176,10 @@ func (u *Uploader) uploadBlob(filepath string) (err error) {
 
 	if IsValidJSON(blob) {
 		log.Debugf("uploading SD blob %s", hash)
+		err = shared.ValidateSDBlob(blob)
+		if err != nil {
+			return errors.Prefix("uploading SD blob "+hash, err)
+		}
 		err = u.store.PutSD(hash, blob)
 		if err != nil {
 			return errors.Prefix("uploading SD blob "+hash, err)
@@ -0,0 +1,275 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lbryio/reflector.go/shared"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Config is the admin section of a config file
+type Config struct {
+	Address string `mapstructure:"address"`
+	Port    int    `mapstructure:"port"`
+	Token   string `mapstructure:"token"`
+}
+
+// Node is the running node the admin server operates on
+type Node interface {
+	// Store returns the root of the current store tree
+	Store() store.BlobStore
+	// ReloadBlocklists triggers a blocklist update
+	ReloadBlocklists() error
+}
+
+// Server is an authenticated HTTP server that lets operators inspect and act on a running node.
+// Every request must carry the configured token as a bearer token.
+type Server struct {
+	srv   *http.Server
+	node  Node
+	token string
+	stop  *stop.Stopper
+}
+
+// NewServer returns an initialized admin Server pointer.
+func NewServer(node Node, cfg Config) *Server {
+	s := &Server{
+		node:  node,
+		token: cfg.Token,
+		stop:  stop.New(),
+	}
+
+	h := http.NewServeMux()
+	h.HandleFunc("GET /blob/{hash}", s.getBlob)
+	h.HandleFunc("GET /blob/{hash}/has", s.hasBlob)
+	h.HandleFunc("GET /blob/{hash}/trace", s.traceBlob)
+	h.HandleFunc("DELETE /blob/{hash}", s.deleteBlob)
+	h.HandleFunc("POST /blob/{hash}/block", s.blockBlob)
+	h.HandleFunc("POST /blob/{hash}/unblock", s.unblockBlob)
+	h.HandleFunc("POST /clean", s.clean)
+	h.HandleFunc("GET /caches", s.caches)
+	h.HandleFunc("POST /blocklist/reload", s.reloadBlocklists)
+	h.HandleFunc("GET /topology", s.topology)
+
+	s.srv = &http.Server{
+		Addr:         net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port)),
+		Handler:      s.authenticate(h),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 60 * time.Second, // cleaning a large store can take a while
+		IdleTimeout:  120 * time.Second,
+	}
+	return s
+}
+
+// Start starts listening for admin requests
+func (s *Server) Start() {
+	log.Println("admin server listening on " + s.srv.Addr)
+	s.stop.Add(1)
+	go func() {
+		defer s.stop.Done()
+		err := s.srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Error(err)
+		}
+	}()
+}
+
+// Shutdown gracefully shuts down the admin server
+func (s *Server) Shutdown() {
+	_ = s.srv.Shutdown(context.Background())
+	s.stop.StopAndWait()
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) getBlob(w http.ResponseWriter, r *http.Request) {
+	blob, trace, err := s.node.Store().Get(r.PathValue("hash"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Via", strings.ReplaceAll(trace.String(), "\n", "; "))
+	_, _ = w.Write(blob)
+}
+
+func (s *Server) hasBlob(w http.ResponseWriter, r *http.Request) {
+	has, err := s.node.Store().Has(r.PathValue("hash"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]bool{"has": has})
+}
+
+func (s *Server) traceBlob(w http.ResponseWriter, r *http.Request) {
+	// peeking keeps the trace from pulling the blob into the caches it goes through
+	_, trace, err := store.Peek(s.node.Store(), r.PathValue("hash"))
+	if err != nil && !errors.Is(err, store.ErrBlobNotFound) {
+		writeError(w, err)
+		return
+	}
+	// the trace of a miss is still useful, it shows every store that was asked
+	writeJSON(w, struct {
+		Found bool `json:"found"`
+		shared.BlobTrace
+	}{Found: err == nil, BlobTrace: trace})
+}
+
+func (s *Server) deleteBlob(w http.ResponseWriter, r *http.Request) {
+	err := s.node.Store().Delete(r.PathValue("hash"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) blockBlob(w http.ResponseWriter, r *http.Request) {
+	bl, ok := s.node.Store().(store.Blocklister)
+	if !ok {
+		writeError(w, errors.Err(shared.ErrNotImplemented))
+		return
+	}
+	err := bl.Block(r.PathValue("hash"), blockInfo(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) unblockBlob(w http.ResponseWriter, r *http.Request) {
+	bl, ok := s.node.Store().(store.Blocklister)
+	if !ok {
+		writeError(w, errors.Err(shared.ErrNotImplemented))
+		return
+	}
+	err := bl.Unblock(r.PathValue("hash"), blockInfo(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// blockInfo reads the reason and source of a block or unblock from the query string
+func blockInfo(r *http.Request) store.BlockInfo {
+	info := store.BlockInfo{Reason: r.URL.Query().Get("reason"), Source: r.URL.Query().Get("source")}
+	if info.Source == "" {
+		info.Source = "admin"
+	}
+	return info
+}
+
+func (s *Server) clean(w http.ResponseWriter, r *http.Request) {
+	results := make(map[string]string)
+	eachDistinct(s.node.Store(), func(bs store.BlobStore) {
+		c, ok := bs.(store.Cleaner)
+		if !ok {
+			return
+		}
+		result := "ok"
+		if err := c.Clean(); err != nil {
+			log.Errorf("admin: cleaning %s: %s", bs.Name(), errors.FullTrace(err))
+			result = err.Error()
+		}
+		results[bs.Name()] = result
+	})
+	writeJSON(w, results)
+}
+
+type cacheSize struct {
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	Capacity int    `json:"capacity,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (s *Server) caches(w http.ResponseWriter, r *http.Request) {
+	sizes := []cacheSize{}
+	eachDistinct(s.node.Store(), func(bs store.BlobStore) {
+		sz, ok := bs.(store.Sizer)
+		if !ok {
+			return
+		}
+		size := cacheSize{Name: bs.Name()}
+		count, capacity, err := sz.Size()
+		if err != nil {
+			size.Error = err.Error()
+		} else {
+			size.Count, size.Capacity = count, capacity
+		}
+		sizes = append(sizes, size)
+	})
+	writeJSON(w, sizes)
+}
+
+func (s *Server) reloadBlocklists(w http.ResponseWriter, r *http.Request) {
+	err := s.node.ReloadBlocklists()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) topology(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	store.Walk(s.node.Store(), func(bs store.BlobStore, depth int) {
+		_, _ = fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", depth), bs.Name())
+	})
+}
+
+// eachDistinct calls fn once for every store in the tree, even if it is shared by several parents. fn runs while
+// the tree is walked, so a concurrent reload doesn't shut the stores down under it.
+func eachDistinct(root store.BlobStore, fn func(bs store.BlobStore)) {
+	seen := make(map[store.BlobStore]bool)
+	store.Walk(root, func(bs store.BlobStore, _ int) {
+		if !seen[bs] {
+			seen[bs] = true
+			fn(bs)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Errorln(errors.Err(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, store.ErrBlobNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, shared.ErrNotImplemented):
+		status = http.StatusNotImplemented
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "secret"
+
+type testNode struct {
+	store   store.BlobStore
+	reloads int
+}
+
+func (n *testNode) Store() store.BlobStore { return n.store }
+
+func (n *testNode) ReloadBlocklists() error {
+	n.reloads++
+	return nil
+}
+
+// testStore is a mem store that can block and clean
+type testStore struct {
+	*store.MemStore
+	blocked map[string]store.BlockInfo
+	cleaned int
+}
+
+func newTestStore(name string) *testStore {
+	return &testStore{MemStore: store.NewMemStore(store.MemParams{Name: name}), blocked: make(map[string]store.BlockInfo)}
+}
+
+func (s *testStore) Block(hash string, info store.BlockInfo) error {
+	s.blocked[hash] = info
+	return s.Delete(hash)
+}
+
+func (s *testStore) Unblock(hash string, _ store.BlockInfo) error {
+	delete(s.blocked, hash)
+	return nil
+}
+
+func (s *testStore) Wants(hash string) (bool, error) {
+	if _, ok := s.blocked[hash]; ok {
+		return false, nil
+	}
+	has, err := s.Has(hash)
+	return !has, err
+}
+
+func (s *testStore) Clean() error {
+	s.cleaned++
+	return nil
+}
+
+func do(t *testing.T, s *Server, method, target, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServer_Authentication(t *testing.T) {
+	node := &testNode{store: newTestStore("root")}
+	s := NewServer(node, Config{Token: testToken})
+	for _, token := range []string{"", "wrong"} {
+		rec := do(t, s, http.MethodGet, "/topology", token)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, token)
+	}
+	assert.Equal(t, http.StatusOK, do(t, s, http.MethodGet, "/topology", testToken).Code)
+
+	// without a configured token nothing is allowed
+	s = NewServer(node, Config{})
+	assert.Equal(t, http.StatusUnauthorized, do(t, s, http.MethodGet, "/topology", "").Code)
+}
+
+func TestServer_BlockUnblock(t *testing.T) {
+	root := newTestStore("root")
+	require.NoError(t, root.Put("hash", []byte("blob")))
+	s := NewServer(&testNode{store: store.NewReloadableStore(root)}, Config{Token: testToken})
+
+	rec := do(t, s, http.MethodPost, "/blob/hash/block?reason=dmca", testToken)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.Equal(t, store.BlockInfo{Reason: "dmca", Source: "admin"}, root.blocked["hash"])
+	rec = do(t, s, http.MethodGet, "/blob/hash/has", testToken)
+	assert.JSONEq(t, `{"has":false}`, rec.Body.String())
+
+	rec = do(t, s, http.MethodPost, "/blob/hash/unblock", testToken)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.Empty(t, root.blocked)
+
+	// stores without a blocklist can't block anything
+	s = NewServer(&testNode{store: store.NewMemStore(store.MemParams{Name: "mem"})}, Config{Token: testToken})
+	assert.Equal(t, http.StatusNotImplemented, do(t, s, http.MethodPost, "/blob/hash/block", testToken).Code)
+}
+
+func newTestTree() (*testStore, *store.MemStore, store.BlobStore) {
+	origin := newTestStore("origin")
+	cache := store.NewMemStore(store.MemParams{Name: "cache"})
+	root := store.NewReloadableStore(store.NewCachingStore(store.CachingParams{Name: "caching", Origin: origin, Cache: cache}))
+	return origin, cache, root
+}
+
+func TestServer_Clean(t *testing.T) {
+	origin, _, root := newTestTree()
+	s := NewServer(&testNode{store: root}, Config{Token: testToken})
+
+	rec := do(t, s, http.MethodPost, "/clean", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"mem-origin":"ok"}`, rec.Body.String())
+	assert.Equal(t, 1, origin.cleaned)
+}
+
+func TestServer_Caches(t *testing.T) {
+	origin, cache, root := newTestTree()
+	require.NoError(t, origin.Put("a", []byte("blob")))
+	require.NoError(t, cache.Put("a", []byte("blob")))
+	require.NoError(t, cache.Put("b", []byte("blob")))
+	s := NewServer(&testNode{store: root}, Config{Token: testToken})
+
+	rec := do(t, s, http.MethodGet, "/caches", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var sizes []cacheSize
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sizes))
+	assert.ElementsMatch(t, []cacheSize{{Name: "mem-origin", Count: 1}, {Name: "mem-cache", Count: 2}}, sizes)
+}
+
+func TestServer_Topology(t *testing.T) {
+	_, _, root := newTestTree()
+	s := NewServer(&testNode{store: root}, Config{Token: testToken})
+
+	rec := do(t, s, http.MethodGet, "/topology", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "caching\n  mem-origin\n  mem-cache\n", rec.Body.String())
+}
+
+func TestServer_TraceDoesNotCache(t *testing.T) {
+	origin, cache, root := newTestTree()
+	require.NoError(t, origin.Put("hash", []byte("blob")))
+	s := NewServer(&testNode{store: root}, Config{Token: testToken})
+
+	rec := do(t, s, http.MethodGet, "/blob/hash/trace", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var trace struct {
+		Found bool `json:"found"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &trace))
+	assert.True(t, trace.Found)
+	has, err := cache.Has("hash")
+	require.NoError(t, err)
+	assert.False(t, has, "tracing a blob must not pull it into the caches")
+
+	rec = do(t, s, http.MethodGet, "/blob/missing/trace", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"found":false`)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"github.com/lbryio/reflector.go/blocklist"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/stream"
+)
+
+const (
+	// MaxAvailabilityHashes is the largest number of hashes a single availability request may check
+	MaxAvailabilityHashes = 1000
+	// MaxAvailabilityRequestSize is the largest body accepted for an availability request
+	MaxAvailabilityRequestSize = 1 << 20
+)
+
+var ErrTooManyHashes = errors.Base("too many hashes in one request")
+
+// AvailabilityRequest asks which of the hashes a server has. If SDHash is set, the sd blob and the content blobs
+// of its stream are checked too.
+type AvailabilityRequest struct {
+	Hashes []string `json:"hashes"`
+	SDHash string   `json:"sd_hash,omitempty"`
+}
+
+// AvailabilityResponse has an entry for every hash that was checked
+type AvailabilityResponse struct {
+	Available map[string]bool `json:"available"`
+}
+
+// CheckAvailability checks all the hashes of the request against the store at once. Blocked hashes are reported
+// as unavailable. It returns ErrUnknownStream if the request has an sd hash the store doesn't have.
+func CheckAvailability(s store.BlobStore, filter *blocklist.Filter, request AvailabilityRequest) (AvailabilityResponse, error) {
+	hashes := request.Hashes
+	if request.SDHash != "" {
+		if filter.IsBlocked(request.SDHash) {
+			hashes = append(hashes, request.SDHash)
+		} else {
+			blobs, err := blocklist.ContentBlobs(s, request.SDHash)
+			if errors.Is(err, store.ErrBlobNotFound) {
+				return AvailabilityResponse{}, errors.Err(ErrUnknownStream)
+			} else if errors.Is(err, blocklist.ErrNotSDBlob) {
+				return AvailabilityResponse{}, errors.Err(ErrInvalidHash)
+			} else if err != nil {
+				return AvailabilityResponse{}, err
+			}
+			hashes = append(append(hashes, request.SDHash), blobs...)
+		}
+	}
+	if len(hashes) > MaxAvailabilityHashes {
+		return AvailabilityResponse{}, errors.Err(ErrTooManyHashes)
+	}
+
+	available := make(map[string]bool, len(hashes))
+	var toCheck []string
+	for _, hash := range hashes {
+		if len(hash) != stream.BlobHashHexLength {
+			return AvailabilityResponse{}, errors.Err(ErrInvalidHash)
+		}
+		available[hash] = false
+		if !filter.IsBlocked(hash) {
+			toCheck = append(toCheck, hash)
+		}
+	}
+	if len(toCheck) == 0 {
+		return AvailabilityResponse{Available: available}, nil
+	}
+	found, err := store.HasBlobs(s, toCheck)
+	if err != nil {
+		return AvailabilityResponse{}, err
+	}
+	for hash, has := range found {
+		if _, ok := available[hash]; ok {
+			available[hash] = has
+		}
+	}
+	return AvailabilityResponse{Available: available}, nil
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Blobs are content-addressed, so a blob never changes and responses can be cached forever
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	// Protected blobs are only served to authorized requests, so shared caches must not keep them
+	privateCacheControl = "private, no-store"
+)
+
+// NotModified answers 304 if the If-None-Match header of the request matches the blob hash, and reports whether
+// it did. It lets servers skip fetching blobs the client already has.
+func NotModified(w http.ResponseWriter, r *http.Request, hash string) bool {
+	if !etagMatches(r.Header.Get("If-None-Match"), hash) {
+		return false
+	}
+	setCacheHeaders(w, hash)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// ServeBlob writes the blob as the response to r, with the hash as its ETag and immutable caching headers.
+// It handles If-None-Match, and single and multipart Range requests. It returns the number of body bytes written.
+func ServeBlob(w http.ResponseWriter, r *http.Request, hash string, blob []byte) int64 {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "filename="+hash)
+	return ServeImmutable(w, r, hash, bytes.NewReader(blob))
+}
+
+// ServeImmutable writes content that never changes as the response to r, with hash as its ETag and immutable
+// caching headers. The Content-Type header must be set by the caller. It returns the number of body bytes written.
+func ServeImmutable(w http.ResponseWriter, r *http.Request, hash string, content io.ReadSeeker) int64 {
+	setCacheHeaders(w, hash)
+	cw := &countingWriter{ResponseWriter: w}
+	http.ServeContent(cw, r, "", time.Time{}, content)
+	return cw.written
+}
+
+// ServeProtectedBlob writes a protected blob as the response to r. Unlike ServeBlob, the response must not be
+// cached, and it has no ETag so that every request goes through authorization. It handles Range requests.
+func ServeProtectedBlob(w http.ResponseWriter, r *http.Request, hash string, blob []byte) int64 {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "filename="+hash)
+	return ServeProtected(w, r, bytes.NewReader(blob))
+}
+
+// ServeProtected writes protected content as the response to r, with headers that keep caches from storing it.
+// The Content-Type header must be set by the caller. It returns the number of body bytes written.
+func ServeProtected(w http.ResponseWriter, r *http.Request, content io.ReadSeeker) int64 {
+	w.Header().Set("Cache-Control", privateCacheControl)
+	// without an ETag, If-None-Match: * would still get a 304
+	r = r.Clone(r.Context())
+	r.Header.Del("If-None-Match")
+	cw := &countingWriter{ResponseWriter: w}
+	http.ServeContent(cw, r, "", time.Time{}, content)
+	return cw.written
+}
+
+func setCacheHeaders(w http.ResponseWriter, hash string) {
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Header().Set("Cache-Control", immutableCacheControl)
+}
+
+// etagMatches returns true if an If-None-Match header value matches the ETag of the blob
+func etagMatches(ifNoneMatch, hash string) bool {
+	for _, etag := range strings.Split(ifNoneMatch, ",") {
+		etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+		if etag == "*" || etag == `"`+hash+`"` {
+			return true
+		}
+	}
+	return false
+}
+
+// countingWriter counts the body bytes written to a response
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeBlob(t *testing.T) {
+	hash := strings.Repeat("a", 96)
+	blob := []byte("0123456789")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if NotModified(w, r, hash) {
+			return
+		}
+		ServeBlob(w, r, hash, blob)
+	})
+
+	tests := map[string]struct {
+		header      map[string]string
+		status      int
+		body        string
+		contentType string
+	}{
+		"full":                {status: http.StatusOK, body: string(blob)},
+		"etag match":          {header: map[string]string{"If-None-Match": `"x", W/"` + hash + `"`}, status: http.StatusNotModified},
+		"etag mismatch":       {header: map[string]string{"If-None-Match": `"x"`}, status: http.StatusOK, body: string(blob)},
+		"single range":        {header: map[string]string{"Range": "bytes=2-4"}, status: http.StatusPartialContent, body: "234"},
+		"suffix range":        {header: map[string]string{"Range": "bytes=-3"}, status: http.StatusPartialContent, body: "789"},
+		"multi range":         {header: map[string]string{"Range": "bytes=0-1,8-9"}, status: http.StatusPartialContent, contentType: "multipart/byteranges"},
+		"unsatisfiable range": {header: map[string]string{"Range": "bytes=20-30"}, status: http.StatusRequestedRangeNotSatisfiable},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/blob?hash="+hash, nil)
+			for k, v := range test.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.status, rec.Code)
+			if test.status == http.StatusRequestedRangeNotSatisfiable {
+				return
+			}
+			assert.Equal(t, `"`+hash+`"`, rec.Header().Get("ETag"))
+			assert.Equal(t, "public, max-age=31536000, immutable", rec.Header().Get("Cache-Control"))
+			if test.body != "" {
+				assert.Equal(t, test.body, rec.Body.String())
+				assert.Equal(t, len(test.body), int(rec.Result().ContentLength))
+			}
+			if test.contentType != "" {
+				assert.Contains(t, rec.Header().Get("Content-Type"), test.contentType)
+				assert.Contains(t, rec.Body.String(), "01")
+				assert.Contains(t, rec.Body.String(), "89")
+			}
+		})
+	}
+}
+
+func TestServeProtectedBlob(t *testing.T) {
+	hash := strings.Repeat("a", 96)
+	blob := []byte("0123456789")
+
+	for _, ifNoneMatch := range []string{"", `"` + hash + `"`, "*"} {
+		req := httptest.NewRequest(http.MethodGet, "/blob?hash="+hash, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		ServeProtectedBlob(rec, req, hash, blob)
+
+		assert.Equal(t, http.StatusOK, rec.Code, ifNoneMatch)
+		assert.Equal(t, string(blob), rec.Body.String())
+		assert.Equal(t, "private, no-store", rec.Header().Get("Cache-Control"))
+		assert.Empty(t, rec.Header().Get("ETag"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/blob?hash="+hash, nil)
+	req.Header.Set("Range", "bytes=2-4")
+	rec := httptest.NewRecorder()
+	ServeProtectedBlob(rec, req, hash, blob)
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "234", rec.Body.String())
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/signing"
+	"github.com/lbryio/reflector.go/tlsconfig"
+)
+
+// EdgeIdentity returns the identity of the edge making the request, from its verified client certificate.
+// It returns an empty string if the request wasn't made with a client certificate.
+func EdgeIdentity(r *http.Request) string {
+	return tlsconfig.Identity(r.TLS)
+}
+
+// AuthorizeProtected checks that r may download a protected blob: it comes from an identified edge, carries the
+// edge token of the server, or is signed with one of the keys of signatures. edgeToken is empty if the server has
+// none. clientIP is the address of the client, which signed URLs may be bound to.
+func AuthorizeProtected(r *http.Request, hash, edgeToken string, signatures *signing.Keyring, clientIP string) error {
+	if EdgeIdentity(r) != "" {
+		return nil
+	}
+	if TokenMatches(r.URL.Query().Get("edge_token"), edgeToken) {
+		return nil
+	}
+	return signatures.Verify(hash, r.URL.Query(), clientIP)
+}
+
+// TrackEdgeDownload counts a blob sent by serverType to an identified edge
+func TrackEdgeDownload(edge, serverType string, written int64) {
+	if edge == "" {
+		return
+	}
+	metrics.EdgeDownloadCount.WithLabelValues(edge, serverType).Inc()
+	metrics.EdgeOutBytes.WithLabelValues(edge, serverType).Add(float64(written))
+}
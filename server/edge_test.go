@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lbryio/reflector.go/signing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizeProtected(t *testing.T) {
+	hash := "abc"
+	key := signing.Key{ID: "k1", Secret: "0123456789abcdef0123456789abcdef"}
+	keys, err := signing.NewKeyring([]signing.Key{key})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/blob?hash=abc&edge_token=edge", nil)
+	assert.NoError(t, AuthorizeProtected(r, hash, "edge", nil, "1.2.3.4"))
+	assert.Error(t, AuthorizeProtected(r, hash, "other", keys, "1.2.3.4"))
+
+	// without an edge token or keys nothing is authorized
+	r = httptest.NewRequest("GET", "/blob?hash=abc", nil)
+	assert.Error(t, AuthorizeProtected(r, hash, "", nil, "1.2.3.4"))
+	assert.Error(t, AuthorizeProtected(r, hash, "", &signing.Keyring{}, "1.2.3.4"))
+
+	r = httptest.NewRequest("GET", "/blob?hash=abc&"+signing.Sign(key, hash, time.Now().Add(time.Minute), "").Encode(), nil)
+	assert.NoError(t, AuthorizeProtected(r, hash, "", keys, "1.2.3.4"))
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_CheckAvailability(t *testing.T) {
+	s, err := stream.New(bytes.NewReader(bytes.Repeat([]byte{1}, stream.MaxBlobSize+10)))
+	require.NoError(t, err)
+	sdHash := s[0].HashHex()
+	missing := s[2].HashHex()
+
+	st := store.NewMemStore(store.MemParams{Name: "test"})
+	require.NoError(t, st.Put(sdHash, s[0]))
+	require.NoError(t, st.Put(s[1].HashHex(), s[1]))
+	srv := NewServer(st, 1, "", "")
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/has", srv.checkAvailability)
+
+	tests := map[string]struct {
+		request   server.AvailabilityRequest
+		status    int
+		available map[string]bool
+	}{
+		"hashes": {
+			request:   server.AvailabilityRequest{Hashes: []string{sdHash, missing}},
+			status:    http.StatusOK,
+			available: map[string]bool{sdHash: true, missing: false},
+		},
+		"stream": {
+			request:   server.AvailabilityRequest{SDHash: sdHash},
+			status:    http.StatusOK,
+			available: map[string]bool{sdHash: true, s[1].HashHex(): true, missing: false},
+		},
+		"unknown stream": {
+			request: server.AvailabilityRequest{SDHash: missing},
+			status:  http.StatusNotFound,
+		},
+		"invalid hash": {
+			request: server.AvailabilityRequest{Hashes: []string{"abc"}},
+			status:  http.StatusBadRequest,
+		},
+		"too many hashes": {
+			request: server.AvailabilityRequest{Hashes: strings.Split(strings.Repeat(missing+",", server.MaxAvailabilityHashes), ",")},
+			status:  http.StatusBadRequest,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(test.request)
+			require.NoError(t, err)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/has", bytes.NewReader(body)))
+
+			require.Equal(t, test.status, rec.Code, rec.Body.String())
+			if test.available != nil {
+				var response server.AvailabilityResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				assert.Equal(t, test.available, response.Available)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingStore is a mem store that lists a fixed blocklist
+type blockingStore struct {
+	*store.MemStore
+}
+
+func (b blockingStore) Blocked() ([]string, error) { return []string{"blocked"}, nil }
+
+func TestServer_GetBlocklist(t *testing.T) {
+	st := blockingStore{MemStore: store.NewMemStore(store.MemParams{Name: "test"})}
+	gin.SetMode(gin.TestMode)
+
+	tests := map[string]struct {
+		edgeToken     string
+		authorization string
+		status        int
+	}{
+		"valid token":      {edgeToken: "secret", authorization: "Bearer secret", status: http.StatusOK},
+		"wrong token":      {edgeToken: "secret", authorization: "Bearer wrong", status: http.StatusForbidden},
+		"missing token":    {edgeToken: "secret", status: http.StatusForbidden},
+		"no token to send": {authorization: "Bearer ", status: http.StatusForbidden},
+		"no token at all":  {status: http.StatusForbidden},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/blocklist", NewServer(st, 1, test.edgeToken, "").getBlocklist)
+			req := httptest.NewRequest(http.MethodGet, "/blocklist", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.status, rec.Code)
+			if test.status == http.StatusOK {
+				assert.JSONEq(t, `["blocked"]`, rec.Body.String())
+			}
+		})
+	}
+}
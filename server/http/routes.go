@@ -2,12 +2,10 @@ package http
 
 import (
 	"net/http"
-	"strconv"
-	"sync"
 	"time"
 
 	"github.com/lbryio/reflector.go/internal/metrics"
-	"github.com/lbryio/reflector.go/reflector"
+	"github.com/lbryio/reflector.go/server"
 	"github.com/lbryio/reflector.go/shared"
 	"github.com/lbryio/reflector.go/store"
 
@@ -17,11 +15,13 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// getBlob serves the blob from a worker of the request queue, or refuses the request if the queue is saturated
 func (s *Server) getBlob(c *gin.Context) {
-	waiter := &sync.WaitGroup{}
-	waiter.Add(1)
-	enqueue(&blobRequest{c: c, finished: waiter})
-	waiter.Wait()
+	priority := s.priorities.Of(c.Query("hash"))
+	err := s.queue.Do(c.Request.Context(), server.ClientKey(c.Request), priority, func() { s.HandleGetBlob(c) })
+	if err != nil {
+		server.RejectQueued(c.Writer, s.queue, err)
+	}
 }
 
 func (s *Server) HandleGetBlob(c *gin.Context) {
@@ -32,11 +32,22 @@ func (s *Server) HandleGetBlob(c *gin.Context) {
 	}()
 	start := time.Now()
 	hash := c.Query("hash")
-	edgeToken := c.Query("edge_token")
 
-	if reflector.IsProtected(hash) && edgeToken != s.edgeToken {
-		_ = c.Error(errors.Err("requested blob is protected"))
-		c.String(http.StatusForbidden, "requested blob is protected")
+	protected := s.Protected.IsProtected(hash)
+	if protected {
+		err := s.authorizeProtected(c, hash)
+		if err != nil {
+			_ = c.Error(errors.Prefix("requested blob is protected", err))
+			c.String(http.StatusForbidden, "requested blob is protected")
+			return
+		}
+	}
+	if s.Blocklist.IsBlocked(hash) {
+		_ = c.Error(errors.Err("requested blob is blocked"))
+		c.String(http.StatusUnavailableForLegalReasons, "requested blob is blocked")
+		return
+	}
+	if !protected && server.NotModified(c.Writer, c.Request, hash) {
 		return
 	}
 	if s.missesCache.Has(hash) {
@@ -75,17 +86,31 @@ func (s *Server) HandleGetBlob(c *gin.Context) {
 		c.String(http.StatusInternalServerError, err.Error())
 		return
 	}
-	metrics.MtrOutBytesHttp.Add(float64(len(blob)))
+	c.Header("Via", serialized)
+	s.priorities.Learn(hash, blob)
+	var written int64
+	if protected {
+		written = server.ServeProtectedBlob(c.Writer, c.Request, hash, blob)
+	} else {
+		written = server.ServeBlob(c.Writer, c.Request, hash, blob)
+	}
+	metrics.MtrOutBytesHttp.Add(float64(written))
+	server.TrackEdgeDownload(server.EdgeIdentity(c.Request), "http", written)
 	metrics.BlobDownloadCount.Inc()
 	metrics.HttpDownloadCount.Inc()
-	c.Header("Via", serialized)
-	c.Header("Content-Disposition", "filename="+hash)
-	c.Header("Content-Length", strconv.Itoa(len(blob)))
-	c.Data(http.StatusOK, "application/octet-stream", blob)
+}
+
+// authorizeProtected checks that the request may download a protected blob, see server.AuthorizeProtected
+func (s *Server) authorizeProtected(c *gin.Context, hash string) error {
+	return server.AuthorizeProtected(c.Request, hash, s.edgeToken, s.Signatures, c.RemoteIP())
 }
 
 func (s *Server) hasBlob(c *gin.Context) {
 	hash := c.Query("hash")
+	if s.Blocklist.IsBlocked(hash) {
+		c.Status(http.StatusUnavailableForLegalReasons)
+		return
+	}
 	has, err := s.store.Has(hash)
 	if err != nil {
 		_ = c.Error(err)
@@ -99,6 +124,53 @@ func (s *Server) hasBlob(c *gin.Context) {
 	c.Status(http.StatusNotFound)
 }
 
+// checkAvailability answers which of a list of hashes, or of the blobs of a stream, the store has
+func (s *Server) checkAvailability(c *gin.Context) {
+	var request server.AvailabilityRequest
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, server.MaxAvailabilityRequestSize)
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	response, err := server.CheckAvailability(s.store, s.Blocklist, request)
+	if err != nil {
+		_ = c.Error(err)
+		c.JSON(server.ErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// getBlocklist lists every hash blocked by the store, so edges can sync their blocklist from this server.
+// It requires the edge token as a bearer token, and is refused if the server has none.
+func (s *Server) getBlocklist(c *gin.Context) {
+	if s.edgeToken == "" {
+		c.String(http.StatusForbidden, "the blocklist is only served when an edge_token is configured")
+		return
+	}
+	if !server.Authorized(c.Request, s.edgeToken) {
+		c.String(http.StatusForbidden, "invalid edge token")
+		return
+	}
+	bl, ok := s.store.(store.BlockedLister)
+	if !ok {
+		c.String(http.StatusNotImplemented, "store does not keep a blocklist")
+		return
+	}
+	hashes, err := bl.Blocked()
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, shared.ErrNotImplemented) {
+			status = http.StatusNotImplemented
+		}
+		_ = c.Error(err)
+		c.String(status, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, hashes)
+}
+
 func (s *Server) recoveryHandler(c *gin.Context, err interface{}) {
 	c.JSON(500, gin.H{
 		"title": "Error",
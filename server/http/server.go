@@ -2,11 +2,22 @@ package http
 
 import (
 	"context"
+	"io"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/lbryio/reflector.go/blocklist"
+	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/protected"
+	"github.com/lbryio/reflector.go/proxyproto"
+	"github.com/lbryio/reflector.go/ratelimit"
+	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/signing"
 	"github.com/lbryio/reflector.go/store"
+	"github.com/lbryio/reflector.go/tlsconfig"
 
+	"github.com/lbryio/lbry.go/v2/extras/errors"
 	"github.com/lbryio/lbry.go/v2/extras/stop"
 
 	"github.com/bluele/gcache"
@@ -20,9 +31,22 @@ type Server struct {
 	store              store.BlobStore
 	grp                *stop.Group
 	missesCache        gcache.Cache
+	streamSizes        gcache.Cache // decrypted size of each blob of the recently served streams
 	edgeToken          string
 	address            string
 	concurrentRequests int
+	queue              *server.Queue
+	priorities         *server.Priorities
+
+	Blocklist     *blocklist.Filter      // blobs blocked by the filter are refused. nil means no filtering
+	Protected     *protected.List        // blobs on the list are only served to authorized requests. nil protects nothing
+	Signatures    *signing.Keyring       // protected blobs are served to URLs signed with one of its keys. Without keys only the edge token is checked
+	EnableStreams bool                   // serve the decrypted content of streams at /stream/{sd_hash}
+	UploadToken   string                 // bearer token accepted by the upload routes. Uploads are disabled if empty
+	TLS           tlsconfig.ServerConfig // serve HTTPS with this certificate. Plain HTTP if it isn't set
+	Queue         server.QueueConfig     // bounds of the queue of blob requests waiting for a worker
+	RateLimit     *ratelimit.Limiter     // request rate and bandwidth of each client. nil means no limits
+	ProxyProtocol *proxyproto.Trusted    // read the PROXY protocol header of connections from these proxies. nil means none
 }
 
 // NewServer returns an initialized Server pointer.
@@ -32,6 +56,8 @@ func NewServer(store store.BlobStore, requestQueueSize int, edgeToken string, ad
 		grp:                stop.New(),
 		concurrentRequests: requestQueueSize,
 		missesCache:        gcache.New(2000).Expiration(5 * time.Minute).ARC().Build(),
+		streamSizes:        gcache.New(1000).LRU().Build(),
+		priorities:         server.NewPriorities(10000),
 		edgeToken:          edgeToken,
 		address:            address,
 	}
@@ -44,28 +70,87 @@ func (s *Server) Shutdown() {
 	log.Debug("HTTP server stopped")
 }
 
+// rateLimit refuses the requests of clients over their request rate, and sends responses within their bandwidth
+func (s *Server) rateLimit(c *gin.Context) {
+	if !server.RateLimit(s.RateLimit, "http", c.Writer, c.Request, s.edgeToken, s.UploadToken) {
+		c.Abort()
+		return
+	}
+	w := s.RateLimit.Writer(c.Request.Context(), "http", server.RateLimitClient(c.Request, s.edgeToken, s.UploadToken), c.Writer)
+	if w != io.Writer(c.Writer) {
+		c.Writer = &limitedWriter{ResponseWriter: c.Writer, w: w}
+	}
+	c.Next()
+}
+
+// limitedWriter writes the response body through a bandwidth limited writer
+type limitedWriter struct {
+	gin.ResponseWriter
+	w io.Writer
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+func (w *limitedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
 // Start starts the server listener to handle connections.
 func (s *Server) Start() error {
+	tlsConfig, err := s.TLS.TLSConfig()
+	if err != nil {
+		return err
+	}
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	router.Use(gin.Logger())
 	// Install nice.Recovery, passing the handler to call after recovery
 	router.Use(nice.Recovery(s.recoveryHandler))
+	router.Use(s.rateLimit)
 	router.GET("/blob", s.getBlob)
 	router.HEAD("/blob", s.hasBlob)
+	router.POST("/has", s.checkAvailability)
+	router.GET("/blocklist", s.getBlocklist)
+	if s.EnableStreams {
+		router.GET("/stream/:sd_hash", s.getStream)
+		router.HEAD("/stream/:sd_hash", s.getStream)
+	}
+	if s.UploadToken != "" {
+		router.PUT("/blob/:hash", s.requireUploadToken, s.putBlob)
+		router.PUT("/sd/:hash", s.requireUploadToken, s.putSDBlob)
+		router.GET("/stream/:sd_hash/missing", s.requireUploadToken, s.getMissingBlobs)
+	}
 	srv := &http.Server{
-		Addr:    s.address,
-		Handler: router,
+		Addr:      s.address,
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+	l, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return errors.Err(err)
+	}
+	if s.ProxyProtocol != nil {
+		l = proxyproto.NewListener(l, s.ProxyProtocol)
 	}
 	go s.listenForShutdown(srv)
-	go InitWorkers(s, s.concurrentRequests)
+	s.queue = server.NewQueue("http", s.concurrentRequests, s.Queue, metrics.HttpBlobReqQueue)
+	s.queue.Start(s.grp)
 	// Initializing the server in a goroutine so that
 	// it won't block the graceful shutdown handling below
 	s.grp.Add(1)
 	go func() {
 		defer s.grp.Done()
 		log.Println("HTTP server listening on " + s.address)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			// the certificate comes from the TLS config
+			err = srv.ServeTLS(l, "", "")
+		} else {
+			err = srv.Serve(l)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("listen: %s\n", err)
 		}
 	}()
@@ -0,0 +1,232 @@
+package http
+
+import (
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// getStream serves the decrypted content of a stream, so players can use the server as a media origin.
+// Range requests only fetch and decrypt the blobs they cover. Every blob is fetched through the request queue,
+// so streams are shed and shared between clients along with blob requests.
+func (s *Server) getStream(c *gin.Context) {
+	sdHash := c.Param("sd_hash")
+	if len(sdHash) != stream.BlobHashHexLength {
+		c.String(http.StatusBadRequest, "invalid sd hash")
+		return
+	}
+	protected := s.Protected.IsProtected(sdHash)
+	if protected {
+		err := s.authorizeProtected(c, sdHash)
+		if err != nil {
+			_ = c.Error(errors.Prefix("requested stream is protected", err))
+			c.String(http.StatusForbidden, "requested stream is protected")
+			return
+		}
+	}
+	if s.Blocklist.IsBlocked(sdHash) {
+		_ = c.Error(errors.Err("requested stream is blocked"))
+		c.String(http.StatusUnavailableForLegalReasons, "requested stream is blocked")
+		return
+	}
+	if !protected && server.NotModified(c.Writer, c.Request, sdHash) {
+		return
+	}
+
+	sdBlob, err := s.queuedGet(c, sdHash)
+	if err != nil {
+		if errors.Is(err, store.ErrBlobNotFound) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		if server.QueueRejected(err) {
+			server.RejectQueued(c.Writer, s.queue, err)
+			return
+		}
+		_ = c.Error(err)
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	var sd stream.SDBlob
+	err = sd.FromBlob(sdBlob)
+	if err != nil {
+		c.String(http.StatusBadRequest, "not an sd blob")
+		return
+	}
+
+	s.priorities.Learn(sdHash, sdBlob)
+
+	r, err := s.newStreamReader(c, sdHash, sd)
+	if err != nil {
+		if server.QueueRejected(err) {
+			server.RejectQueued(c.Writer, s.queue, err)
+			return
+		}
+		_ = c.Error(err)
+		c.String(http.StatusBadGateway, err.Error())
+		return
+	}
+
+	filename := sd.SuggestedFileName
+	if filename == "" {
+		filename = sd.StreamName
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	if filename != "" {
+		c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	}
+	var written int64
+	if protected {
+		written = server.ServeProtected(c.Writer, c.Request, r)
+	} else {
+		written = server.ServeImmutable(c.Writer, c.Request, sdHash, r)
+	}
+	if r.err != nil {
+		log.Errorf("serving stream %s: %s", sdHash, errors.FullTrace(r.err))
+	}
+	metrics.MtrOutBytesHttp.Add(float64(written))
+}
+
+// queuedGet gets the blob from a worker of the request queue, on behalf of the client of c
+func (s *Server) queuedGet(c *gin.Context, hash string) (stream.Blob, error) {
+	var blob stream.Blob
+	var err error
+	queueErr := s.queue.Do(c.Request.Context(), server.ClientKey(c.Request), s.priorities.Of(hash), func() {
+		blob, _, err = s.store.Get(hash)
+	})
+	if queueErr != nil {
+		return nil, queueErr
+	}
+	return blob, err
+}
+
+// streamReader reads the decrypted content of a stream, fetching and decrypting blobs as they are needed
+type streamReader struct {
+	s      *Server
+	c      *gin.Context // request the blobs are fetched for
+	sd     stream.SDBlob
+	blobs  []stream.BlobInfo // content blobs, without the terminator
+	starts []int64           // offset of the first byte of each blob in the decrypted stream
+	size   int64
+	pos    int64
+
+	current   int    // index of the blob in plaintext, -1 if none
+	plaintext []byte // decrypted content of the current blob
+	err       error  // first error, logged after the response
+}
+
+// newStreamReader returns a reader for the stream. Finding the decrypted size of the stream may require
+// decrypting some blobs, the sizes are cached so it is only done once per stream.
+func (s *Server) newStreamReader(c *gin.Context, sdHash string, sd stream.SDBlob) (*streamReader, error) {
+	r := &streamReader{s: s, c: c, sd: sd, current: -1}
+	for _, info := range sd.BlobInfos {
+		if info.Length > 0 {
+			r.blobs = append(r.blobs, info)
+		}
+	}
+
+	sizes, err := s.streamSizes.Get(sdHash)
+	if err != nil {
+		sizes, err = r.plaintextSizes()
+		if err != nil {
+			return nil, err
+		}
+		_ = s.streamSizes.Set(sdHash, sizes)
+	}
+	for _, size := range sizes.([]int64) {
+		r.starts = append(r.starts, r.size)
+		r.size += size
+	}
+	return r, nil
+}
+
+// plaintextSizes returns the decrypted size of each blob. Encoders fill every blob but the last one with
+// MaxBlobSize-1 bytes, which encrypt to exactly MaxBlobSize. Any other blob is decrypted to find its size.
+func (r *streamReader) plaintextSizes() ([]int64, error) {
+	sizes := make([]int64, len(r.blobs))
+	for i, info := range r.blobs {
+		if info.Length == stream.MaxBlobSize && i < len(r.blobs)-1 {
+			sizes[i] = stream.MaxBlobSize - 1
+			continue
+		}
+		plaintext, err := r.decrypt(i)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = int64(len(plaintext))
+	}
+	return sizes, nil
+}
+
+func (r *streamReader) decrypt(i int) ([]byte, error) {
+	hash := hex.EncodeToString(r.blobs[i].BlobHash)
+	if r.s.Blocklist.IsBlocked(hash) {
+		return nil, errors.Err("blob %s of the stream is blocked", hash)
+	}
+	blob, err := r.s.queuedGet(r.c, hash)
+	if err != nil {
+		return nil, errors.Prefix("blob "+hash, err)
+	}
+	plaintext, err := blob.Plaintext(r.sd.Key, r.blobs[i].IV)
+	if err != nil {
+		return nil, errors.Prefix("decrypting blob "+hash, err)
+	}
+	return plaintext, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	// the blob containing pos is the last one starting at or before it
+	i := sort.Search(len(r.starts), func(i int) bool { return r.starts[i] > r.pos }) - 1
+	if i != r.current {
+		plaintext, err := r.decrypt(i)
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		if r.starts[i]+int64(len(plaintext)) > r.size || (i+1 < len(r.starts) && r.starts[i]+int64(len(plaintext)) != r.starts[i+1]) {
+			r.err = errors.Err("blob %d of the stream does not have the expected size", i)
+			return 0, r.err
+		}
+		r.current, r.plaintext = i, plaintext
+	}
+	n := copy(p, r.plaintext[r.pos-r.starts[i]:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+func (r *streamReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.Err("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.Err("negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
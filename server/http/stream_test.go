@@ -0,0 +1,89 @@
+package http
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_GetStream(t *testing.T) {
+	data := make([]byte, 2*stream.MaxBlobSize+1000)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	s, err := stream.New(bytes.NewReader(data))
+	require.NoError(t, err)
+	sdHash := s[0].HashHex()
+
+	st := store.NewMemStore(store.MemParams{Name: "test"})
+	for _, b := range s {
+		require.NoError(t, st.Put(b.HashHex(), b))
+	}
+	srv := NewServer(st, 1, "", "")
+	srv.queue = server.NewQueue("test", 1, server.QueueConfig{}, metrics.HttpBlobReqQueue)
+	srv.queue.Start(srv.grp)
+	defer srv.Shutdown()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/stream/:sd_hash", srv.getStream)
+
+	boundary := int64(stream.MaxBlobSize - 1) // the first byte of the second blob
+	tests := map[string]struct {
+		rangeHeader string
+		status      int
+		body        []byte
+	}{
+		"whole stream":       {status: http.StatusOK, body: data},
+		"across blobs":       {rangeHeader: "bytes=2097140-2097160", status: http.StatusPartialContent, body: data[boundary-11 : boundary+10]},
+		"end of stream":      {rangeHeader: "bytes=-10", status: http.StatusPartialContent, body: data[len(data)-10:]},
+		"inside second blob": {rangeHeader: "bytes=3000000-3000009", status: http.StatusPartialContent, body: data[3000000:3000010]},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/stream/"+sdHash, nil)
+			if test.rangeHeader != "" {
+				req.Header.Set("Range", test.rangeHeader)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			require.Equal(t, test.status, rec.Code, rec.Body.String())
+			assert.Equal(t, len(test.body), int(rec.Result().ContentLength))
+			assert.True(t, bytes.Equal(test.body, rec.Body.Bytes()), "body mismatch")
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/stream/"+s[1].HashHex(), nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "content blobs are not streams")
+}
+
+func TestServer_GetStreamQueued(t *testing.T) {
+	st := store.NewMemStore(store.MemParams{Name: "test"})
+	srv := NewServer(st, 1, "", "")
+	// nothing serves the queue, so the request waits until it is shed
+	srv.queue = server.NewQueue("test", 1, server.QueueConfig{MaxWait: 10 * time.Millisecond}, metrics.HttpBlobReqQueue)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/stream/:sd_hash", srv.getStream)
+
+	req := httptest.NewRequest(http.MethodGet, "/stream/"+strings.Repeat("a", stream.BlobHashHexLength), nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
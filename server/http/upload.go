@@ -0,0 +1,58 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/server"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireUploadToken refuses requests that don't carry the upload token as a bearer token
+func (s *Server) requireUploadToken(c *gin.Context) {
+	if !server.Authorized(c.Request, s.UploadToken) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid upload token"})
+	}
+}
+
+func (s *Server) putBlob(c *gin.Context) {
+	s.receiveBlob(c, false)
+}
+
+func (s *Server) putSDBlob(c *gin.Context) {
+	s.receiveBlob(c, true)
+}
+
+func (s *Server) receiveBlob(c *gin.Context, isSD bool) {
+	hash := c.Param("hash")
+	if s.Blocklist.IsBlocked(hash) {
+		c.JSON(http.StatusUnavailableForLegalReasons, gin.H{"error": "blob is blocked"})
+		return
+	}
+	result, received, err := server.ReceiveBlob(s.store, hash, isSD, c.Request.Body)
+	metrics.MtrInBytesHttp.Add(float64(received))
+	if err != nil {
+		_ = c.Error(errors.Prefix("receiving blob "+hash, err))
+		c.JSON(server.ErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if result.Received {
+		status = http.StatusCreated
+	}
+	c.JSON(status, result)
+}
+
+// getMissingBlobs lists the content blobs of a known stream that still have to be uploaded
+func (s *Server) getMissingBlobs(c *gin.Context) {
+	missing, err := server.MissingBlobs(s.store, c.Param("sd_hash"))
+	if err != nil {
+		_ = c.Error(err)
+		c.JSON(server.ErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"missing": missing})
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_PutBlob(t *testing.T) {
+	blob := stream.Blob("some blob content")
+	hash := blob.HashHex()
+	other := stream.Blob("other blob content").HashHex()
+
+	st := store.NewMemStore(store.MemParams{Name: "test"})
+	srv := NewServer(st, 1, "", "")
+	srv.UploadToken = "secret"
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/blob/:hash", srv.requireUploadToken, srv.putBlob)
+
+	tests := []struct {
+		name     string
+		hash     string
+		token    string
+		status   int
+		received bool
+	}{
+		{name: "no token", hash: hash, status: http.StatusUnauthorized},
+		{name: "wrong token", hash: hash, token: "wrong", status: http.StatusUnauthorized},
+		{name: "hash mismatch", hash: other, token: "secret", status: http.StatusBadRequest},
+		{name: "invalid hash", hash: "abc", token: "secret", status: http.StatusBadRequest},
+		{name: "upload", hash: hash, token: "secret", status: http.StatusCreated, received: true},
+		{name: "already stored", hash: hash, token: "secret", status: http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/blob/"+test.hash, bytes.NewReader(blob))
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, test.status, rec.Code, "%s: %s", test.name, rec.Body.String())
+		if test.status == http.StatusOK || test.status == http.StatusCreated {
+			var result server.UploadResult
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+			assert.Equal(t, test.received, result.Received, test.name)
+		}
+	}
+
+	stored, _, err := st.Get(hash)
+	require.NoError(t, err)
+	assert.Equal(t, blob, stored)
+	has, err := st.Has(other)
+	require.NoError(t, err)
+	assert.False(t, has)
+}
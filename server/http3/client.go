@@ -2,6 +2,7 @@ package http3
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"github.com/lbryio/reflector.go/internal/metrics"
 	"github.com/lbryio/reflector.go/shared"
 	"github.com/lbryio/reflector.go/store"
+	"github.com/lbryio/reflector.go/tlsconfig"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
 	"github.com/lbryio/lbry.go/v2/stream"
@@ -28,6 +30,22 @@ type Client struct {
 	Timeout      time.Duration
 }
 
+// NewClient returns a client for the server at address (host:port). The certificate of the server is verified
+// as configured by tlsConf, or not at all if it is nil.
+func NewClient(address string, timeout time.Duration, tlsConf *tlsconfig.ClientConfig) *Client {
+	tlsConfig := tlsConf.TLSConfig()
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	roundTripper := &http3.Transport{TLSClientConfig: tlsConfig}
+	return &Client{
+		conn:         &http.Client{Transport: roundTripper, Timeout: timeout},
+		roundTripper: roundTripper,
+		ServerAddr:   address,
+		Timeout:      timeout,
+	}
+}
+
 // Close closes the connection with the client.
 func (c *Client) Close() error {
 	c.conn.CloseIdleConnections()
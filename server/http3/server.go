@@ -1,23 +1,28 @@
 package http3
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"math/big"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/lbryio/reflector.go/blocklist"
 	"github.com/lbryio/reflector.go/internal/metrics"
-	"github.com/lbryio/reflector.go/reflector"
+	"github.com/lbryio/reflector.go/protected"
+	"github.com/lbryio/reflector.go/ratelimit"
+	"github.com/lbryio/reflector.go/server"
+	"github.com/lbryio/reflector.go/signing"
 	"github.com/lbryio/reflector.go/store"
+	"github.com/lbryio/reflector.go/tlsconfig"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
 	"github.com/lbryio/lbry.go/v2/extras/stop"
@@ -34,6 +39,16 @@ type Server struct {
 	grp                *stop.Group
 	address            string
 	concurrentRequests int
+	queue              *server.Queue
+	priorities         *server.Priorities
+
+	Blocklist   *blocklist.Filter      // blobs blocked by the filter are refused. nil means no filtering
+	Protected   *protected.List        // blobs on the list are only served to authorized requests. nil protects nothing
+	Signatures  *signing.Keyring       // protected blobs are served to URLs signed with one of its keys. Without keys they are refused
+	UploadToken string                 // bearer token accepted by the upload routes. Uploads are disabled if empty
+	TLS         tlsconfig.ServerConfig // certificate of the server. A self-signed one is generated if it isn't set
+	Queue       server.QueueConfig     // bounds of the queue of blob requests waiting for a worker
+	RateLimit   *ratelimit.Limiter     // request rate and bandwidth of each client. nil means no limits
 }
 
 // NewServer returns an initialized Server pointer.
@@ -42,6 +57,7 @@ func NewServer(store store.BlobStore, requestQueueSize int, address string) *Ser
 		store:              store,
 		grp:                stop.New(),
 		concurrentRequests: requestQueueSize,
+		priorities:         server.NewPriorities(10000),
 		address:            address,
 	}
 }
@@ -68,8 +84,24 @@ type availabilityResponse struct {
 	IsAvailable    bool   `json:"is_available"`
 }
 
+// rateLimit refuses the requests of clients over their request rate, and sends responses within their bandwidth
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !server.RateLimit(s.RateLimit, "http3", w, r, s.UploadToken) {
+			return
+		}
+		next.ServeHTTP(s.RateLimit.ResponseWriter("http3", server.RateLimitClient(r, s.UploadToken), w, r), r)
+	})
+}
+
 // Start starts the server listener to handle connections.
 func (s *Server) Start() error {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	s.queue = server.NewQueue("http3", s.concurrentRequests, s.Queue, metrics.Http3BlobReqQueue)
+	s.queue.Start(s.grp)
 	log.Println("HTTP3 peer listening on " + s.address)
 	window500M := 500 * 1 << 20
 
@@ -81,15 +113,22 @@ func (s *Server) Start() error {
 		MaxIdleTimeout:             20 * time.Second,
 	}
 	r := mux.NewRouter()
+	r.Use(s.rateLimit)
 	r.HandleFunc("/get/{hash}", func(w http.ResponseWriter, r *http.Request) {
-		waiter := &sync.WaitGroup{}
-		waiter.Add(1)
-		enqueue(&blobRequest{request: r, reply: w, finished: waiter})
-		waiter.Wait()
+		priority := s.priorities.Of(mux.Vars(r)["hash"])
+		err := s.queue.Do(r.Context(), server.ClientKey(r), priority, func() { s.HandleGetBlob(w, r) })
+		if err != nil {
+			server.RejectQueued(w, s.queue, err)
+		}
 	})
+	r.HandleFunc("/has", s.handleCheckAvailability).Methods(http.MethodPost)
 	r.HandleFunc("/has/{hash}", func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		requestedBlob := vars["hash"]
+		if s.Blocklist.IsBlocked(requestedBlob) {
+			http.Error(w, "requested blob is blocked", http.StatusUnavailableForLegalReasons)
+			return
+		}
 		blobExists, err := s.store.Has(requestedBlob)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -115,13 +154,17 @@ func (s *Server) Start() error {
 			s.logError(err)
 		}
 	})
+	if s.UploadToken != "" {
+		r.HandleFunc("/blob/{hash}", s.requireUploadToken(s.handlePutBlob)).Methods(http.MethodPut)
+		r.HandleFunc("/sd/{hash}", s.requireUploadToken(s.handlePutSDBlob)).Methods(http.MethodPut)
+		r.HandleFunc("/stream/{sd_hash}/missing", s.requireUploadToken(s.handleMissingBlobs)).Methods(http.MethodGet)
+	}
 	server := http3.Server{
 		Addr:       s.address,
 		Handler:    r,
-		TLSConfig:  generateTLSConfig(),
+		TLSConfig:  tlsConfig,
 		QUICConfig: quicConf,
 	}
-	go InitWorkers(s, s.concurrentRequests)
 	go s.listenForShutdown(&server)
 	s.grp.Add(1)
 	go func() {
@@ -132,28 +175,41 @@ func (s *Server) Start() error {
 	return nil
 }
 
-// Setup a bare-bones TLS config for the server
-func generateTLSConfig() *tls.Config {
-	key, err := rsa.GenerateKey(rand.Reader, 1024)
+// tlsConfig returns the TLS config of the server, with the configured certificate if there is one
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	tlsConfig, err := s.TLS.TLSConfig()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	template := x509.Certificate{SerialNumber: big.NewInt(1)}
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
-	if err != nil {
-		panic(err)
+	if tlsConfig == nil {
+		log.Warnln("no tls certificate configured for the http3 server, using a self-signed one. Clients will not be able to verify it")
+		tlsConfig, err = generateTLSConfig()
+		if err != nil {
+			return nil, err
+		}
 	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	tlsConfig.NextProtos = []string{"http3-reflector-server"}
+	return tlsConfig, nil
+}
 
-	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+// generateTLSConfig sets up a TLS config with a self-signed certificate
+func generateTLSConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		panic(err)
+		return nil, errors.Err(err)
 	}
-	return &tls.Config{
-		Certificates: []tls.Certificate{tlsCert},
-		NextProtos:   []string{"http3-reflector-server"},
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, errors.Err(err)
 	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{certDER}, PrivateKey: key}},
+	}, nil
 }
 
 func (s *Server) listenAndServe(server *http3.Server) {
@@ -171,6 +227,32 @@ func (s *Server) listenForShutdown(listener *http3.Server) {
 	}
 }
 
+// handleCheckAvailability answers which of a list of hashes, or of the blobs of a stream, the store has
+func (s *Server) handleCheckAvailability(w http.ResponseWriter, r *http.Request) {
+	var request server.AvailabilityRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, server.MaxAvailabilityRequestSize)).Decode(&request)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	response, err := server.CheckAvailability(s.store, s.Blocklist, request)
+	if err != nil {
+		s.logError(err)
+		writeJSON(w, server.ErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// remoteIP returns the ip of a host:port address
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
 func (s *Server) HandleGetBlob(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	requestedBlob := vars["hash"]
@@ -183,8 +265,21 @@ func (s *Server) HandleGetBlob(w http.ResponseWriter, r *http.Request) {
 			wantsTrace = false
 		}
 	}
-	if reflector.IsProtected(requestedBlob) {
-		http.Error(w, "requested blob is protected", http.StatusForbidden)
+	protected := s.Protected.IsProtected(requestedBlob)
+	if protected {
+		// the HTTP3 server has no edge token, edges identify with client certificates
+		err = server.AuthorizeProtected(r, requestedBlob, "", s.Signatures, remoteIP(r.RemoteAddr))
+		if err != nil {
+			log.Debugln(errors.Prefix("requested blob is protected", err))
+			http.Error(w, "requested blob is protected", http.StatusForbidden)
+			return
+		}
+	}
+	if s.Blocklist.IsBlocked(requestedBlob) {
+		http.Error(w, "requested blob is blocked", http.StatusUnavailableForLegalReasons)
+		return
+	}
+	if !protected && server.NotModified(w, r, requestedBlob) {
 		return
 	}
 	blob, trace, err := s.store.Get(requestedBlob)
@@ -210,11 +305,15 @@ func (s *Server) HandleGetBlob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = w.Write(blob)
-	if err != nil {
-		s.logError(err)
+	s.priorities.Learn(requestedBlob, blob)
+	var written int64
+	if protected {
+		written = server.ServeProtectedBlob(w, r, requestedBlob, blob)
+	} else {
+		written = server.ServeBlob(w, r, requestedBlob, blob)
 	}
-	metrics.MtrOutBytesUdp.Add(float64(len(blob)))
+	metrics.MtrOutBytesUdp.Add(float64(written))
+	server.TrackEdgeDownload(server.EdgeIdentity(r), "http3", written)
 	metrics.BlobDownloadCount.Inc()
 	metrics.Http3DownloadCount.Inc()
 }
@@ -0,0 +1,73 @@
+package http3
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/server"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// requireUploadToken refuses requests that don't carry the upload token as a bearer token
+func (s *Server) requireUploadToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !server.Authorized(r, s.UploadToken) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid upload token"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handlePutBlob(w http.ResponseWriter, r *http.Request) {
+	s.receiveBlob(w, r, false)
+}
+
+func (s *Server) handlePutSDBlob(w http.ResponseWriter, r *http.Request) {
+	s.receiveBlob(w, r, true)
+}
+
+func (s *Server) receiveBlob(w http.ResponseWriter, r *http.Request, isSD bool) {
+	hash := mux.Vars(r)["hash"]
+	if s.Blocklist.IsBlocked(hash) {
+		writeJSON(w, http.StatusUnavailableForLegalReasons, map[string]string{"error": "blob is blocked"})
+		return
+	}
+	result, received, err := server.ReceiveBlob(s.store, hash, isSD, r.Body)
+	metrics.MtrInBytesUdp.Add(float64(received))
+	if err != nil {
+		log.Debugln(errors.Prefix("receiving blob "+hash, err))
+		writeJSON(w, server.ErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if result.Received {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, result)
+}
+
+// handleMissingBlobs lists the content blobs of a known stream that still have to be uploaded
+func (s *Server) handleMissingBlobs(w http.ResponseWriter, r *http.Request) {
+	missing, err := server.MissingBlobs(s.store, mux.Vars(r)["sd_hash"])
+	if err != nil {
+		s.logError(err)
+		writeJSON(w, server.ErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"missing": missing})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Errorln(errors.FullTrace(err))
+	}
+}
@@ -2,6 +2,7 @@ package peer
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"io"
@@ -23,6 +24,7 @@ type Client struct {
 	conn      net.Conn
 	buf       *bufio.Reader
 	Timeout   time.Duration
+	TLSConfig *tls.Config // connect with TLS if set
 	connected bool
 }
 
@@ -32,7 +34,11 @@ func (c *Client) Connect(address string) error {
 	if c.Timeout == 0 {
 		c.Timeout = 5 * time.Second
 	}
-	c.conn, err = net.Dial("tcp4", address)
+	if c.TLSConfig != nil {
+		c.conn, err = tls.Dial("tcp", address, c.TLSConfig)
+	} else {
+		c.conn, err = net.Dial("tcp", address)
+	}
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,108 @@
+package peer
+
+import (
+	"net"
+	"time"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultIdleTimeout is how long a connection may wait for its next request
+	DefaultIdleTimeout = 1 * time.Minute
+	// DefaultDrainTimeout is how long Shutdown waits for the requests in progress
+	DefaultDrainTimeout = 10 * time.Second
+)
+
+// admit registers a new connection, or returns false if the server is shutting down or the connection is over
+// the connection limits
+func (s *Server) admit(conn net.Conn, ip string) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	reason := ""
+	switch {
+	case s.draining:
+		reason = "shutdown"
+	case s.MaxConnections > 0 && len(s.conns) >= s.MaxConnections:
+		reason = "max_connections"
+	case s.MaxConnectionsPerIP > 0 && s.connsPerIP[ip] >= s.MaxConnectionsPerIP:
+		reason = "max_connections_per_ip"
+	}
+	if reason != "" {
+		metrics.ConnectionsRejected.WithLabelValues("peer", reason).Inc()
+		log.Debugf("refusing peer conn from %s: %s", ip, reason)
+		return false
+	}
+	s.conns[conn] = false
+	s.connsPerIP[ip]++
+	metrics.ActiveConnections.WithLabelValues("peer").Inc()
+	return true
+}
+
+// release unregisters a closed connection
+func (s *Server) release(conn net.Conn, ip string) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if busy := s.conns[conn]; busy {
+		metrics.ActiveRequests.WithLabelValues("peer").Dec()
+	}
+	delete(s.conns, conn)
+	s.connsPerIP[ip]--
+	if s.connsPerIP[ip] <= 0 {
+		delete(s.connsPerIP, ip)
+	}
+	metrics.ActiveConnections.WithLabelValues("peer").Dec()
+}
+
+// setBusy marks whether the connection is handling a request. Marking it idle returns false if the server is
+// shutting down, in which case the connection should be closed.
+func (s *Server) setBusy(conn net.Conn, busy bool) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.conns[conn] != busy {
+		if busy {
+			metrics.ActiveRequests.WithLabelValues("peer").Inc()
+		} else {
+			metrics.ActiveRequests.WithLabelValues("peer").Dec()
+		}
+	}
+	s.conns[conn] = busy
+	return busy || !s.draining
+}
+
+// drain closes the idle connections, lets the others finish their request, and closes whatever is left after
+// the drain timeout. The group must be stopped first.
+func (s *Server) drain() {
+	s.connsMu.Lock()
+	s.draining = true
+	for conn, busy := range s.conns {
+		if !busy {
+			_ = conn.Close()
+		}
+	}
+	s.connsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.grp.Wait()
+		close(done)
+	}()
+	timeout := s.DrainTimeout
+	if timeout == 0 {
+		timeout = DefaultDrainTimeout
+	}
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+	s.connsMu.Lock()
+	log.Warnf("closing %d peer connections still busy after %s", len(s.conns), timeout)
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.connsMu.Unlock()
+	<-done
+}
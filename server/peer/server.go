@@ -2,18 +2,28 @@ package peer
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	ee "errors"
 	"io"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/lbryio/reflector.go/blocklist"
 	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/protected"
+	"github.com/lbryio/reflector.go/proxyproto"
+	"github.com/lbryio/reflector.go/ratelimit"
 	"github.com/lbryio/reflector.go/reflector"
+	"github.com/lbryio/reflector.go/server"
 	"github.com/lbryio/reflector.go/shared"
+	"github.com/lbryio/reflector.go/signing"
 	"github.com/lbryio/reflector.go/store"
+	"github.com/lbryio/reflector.go/tlsconfig"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
 	"github.com/lbryio/lbry.go/v2/extras/stop"
@@ -34,32 +44,63 @@ type Server struct {
 	store   store.BlobStore
 	grp     *stop.Group
 	address string
-	closed  bool
+
+	connsMu    sync.Mutex
+	conns      map[net.Conn]bool // open connections, and whether they are handling a request
+	connsPerIP map[string]int
+	draining   bool
+
+	Blocklist     *blocklist.Filter      // blobs blocked by the filter are refused. nil means no filtering
+	Protected     *protected.List        // blobs on the list are only served to authorized requests. nil protects nothing
+	Signatures    *signing.Keyring       // protected blobs are served to requests signed with one of its keys. Without keys they are refused
+	TLS           tlsconfig.ServerConfig // accept TLS connections with this certificate. Plain TCP if it isn't set
+	RateLimit     *ratelimit.Limiter     // request rate and bandwidth of each client. nil means no limits
+	ProxyProtocol *proxyproto.Trusted    // read the PROXY protocol header of connections from these proxies. nil means none
+
+	MaxConnections      int           // connections above this limit are refused. 0 means no limit
+	MaxConnectionsPerIP int           // connections from one ip above this limit are refused. 0 means no limit
+	IdleTimeout         time.Duration // connections waiting longer than this for a request are closed
+	DrainTimeout        time.Duration // how long Shutdown lets the requests in progress finish
 }
 
 // NewServer returns an initialized Server pointer.
 func NewServer(store store.BlobStore, address string) *Server {
 	return &Server{
-		store:   store,
-		grp:     stop.New(),
-		address: address,
+		store:        store,
+		grp:          stop.New(),
+		address:      address,
+		conns:        make(map[net.Conn]bool),
+		connsPerIP:   make(map[string]int),
+		IdleTimeout:  DefaultIdleTimeout,
+		DrainTimeout: DefaultDrainTimeout,
 	}
 }
 
-// Shutdown gracefully shuts down the peer server.
+// Shutdown stops accepting connections, closes the idle ones and waits for the requests in progress to finish.
 func (s *Server) Shutdown() {
 	log.Debug("shutting down peer server")
-	s.grp.StopAndWait()
+	s.grp.Stop()
+	s.drain()
 	log.Debug("peer server stopped")
 }
 
 // Start starts the server listener to handle connections.
 func (s *Server) Start() error {
+	tlsConfig, err := s.TLS.TLSConfig()
+	if err != nil {
+		return err
+	}
 	log.Println("peer listening on " + s.address)
-	l, err := net.Listen("tcp4", s.address)
+	l, err := net.Listen("tcp", s.address)
 	if err != nil {
 		return err
 	}
+	if s.ProxyProtocol != nil {
+		l = proxyproto.NewListener(l, s.ProxyProtocol)
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
 
 	go s.listenForShutdown(l)
 	s.grp.Add(1)
@@ -73,7 +114,6 @@ func (s *Server) Start() error {
 
 func (s *Server) listenForShutdown(listener net.Listener) {
 	<-s.grp.Ch()
-	s.closed = true
 	err := listener.Close()
 	if err != nil {
 		log.Error("error closing listener for peer server - ", err)
@@ -84,7 +124,7 @@ func (s *Server) listenAndServe(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			if s.closed {
+			if s.quitting() {
 				return
 			}
 			log.Error(errors.Prefix("accepting conn", err))
@@ -100,39 +140,71 @@ func (s *Server) listenAndServe(listener net.Listener) {
 	}
 }
 
+func (s *Server) quitting() bool {
+	select {
+	case <-s.grp.Ch():
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *Server) handleConnection(conn net.Conn) {
 	defer func() {
-		if err := conn.Close(); err != nil {
+		if err := conn.Close(); err != nil && !s.quitting() {
 			log.Error(errors.Prefix("closing peer conn", err))
 		}
 	}()
+	ip := remoteIP(conn)
+	if !s.admit(conn, ip) {
+		return
+	}
+	defer s.release(conn, ip)
 
 	timeoutDuration := 1 * time.Minute
+	idleTimeout := s.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	edge, err := handshake(conn, timeoutDuration)
+	if err != nil {
+		s.logError(err)
+		return
+	}
+	client := ratelimit.Client{IP: ip, Edge: edge}
 	buf := bufio.NewReader(conn)
+	w := s.RateLimit.Writer(context.Background(), "peer", client, conn)
 
 	for {
 		var request []byte
 		var response []byte
 
-		err := conn.SetReadDeadline(time.Now().Add(timeoutDuration))
+		err := conn.SetReadDeadline(time.Now().Add(idleTimeout))
 		if err != nil {
 			log.Error(errors.FullTrace(err))
 		}
 
 		request, err = readNextMessage(buf)
 		if err != nil {
-			if err != io.EOF {
+			if err != io.EOF && !s.quitting() {
 				s.logError(err)
 			}
 			return
 		}
+		s.setBusy(conn, true)
 
 		err = conn.SetReadDeadline(time.Time{})
 		if err != nil {
 			log.Error(errors.FullTrace(err))
 		}
 
-		response, err = s.handleCompositeRequest(request)
+		// the protocol has no way to tell the client to slow down, so clients over their rate are disconnected
+		if !s.RateLimit.Allow("peer", client) {
+			log.Debugf("closing peer conn of %s: too many requests", client.IP)
+			return
+		}
+
+		response, err = s.handleCompositeRequest(request, ip, edge)
 		if err != nil {
 			log.Error(errors.FullTrace(err))
 			return
@@ -143,7 +215,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 			log.Error(errors.FullTrace(err))
 		}
 
-		n, err := conn.Write(response)
+		n, err := w.Write(response)
 		if err != nil {
 			if !strings.Contains(err.Error(), "connection reset by peer") { // means the other side closed the connection using TCP reset
 				s.logError(err)
@@ -158,6 +230,9 @@ func (s *Server) handleConnection(conn net.Conn) {
 		if err != nil {
 			log.Error(errors.FullTrace(err))
 		}
+		if !s.setBusy(conn, false) {
+			return
+		}
 	}
 }
 
@@ -168,13 +243,13 @@ func (s *Server) handleAvailabilityRequest(data []byte) ([]byte, error) {
 		return nil, errors.Err(err)
 	}
 
+	found, err := store.HasBlobs(s.store, request.RequestedBlobs)
+	if err != nil {
+		return nil, err
+	}
 	availableBlobs := []string{}
 	for _, blobHash := range request.RequestedBlobs {
-		exists, err := s.store.Has(blobHash)
-		if err != nil {
-			return nil, err
-		}
-		if exists {
+		if found[blobHash] {
 			availableBlobs = append(availableBlobs, blobHash)
 		}
 	}
@@ -222,7 +297,48 @@ func (s *Server) handleAvailabilityRequest(data []byte) ([]byte, error) {
 //	return append(response, blob...), nil
 //}
 
-func (s *Server) handleCompositeRequest(data []byte) ([]byte, error) {
+// remoteIP returns the ip of the other end of the connection
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// handshake completes the TLS handshake of a TLS connection, and returns the identity of the edge if the client
+// has a certificate. It does nothing on plain connections.
+func handshake(conn net.Conn, timeout time.Duration) (string, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+	err := tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return "", errors.Err(err)
+	}
+	err = tlsConn.Handshake()
+	if err != nil {
+		return "", errors.Prefix("tls handshake", err)
+	}
+	state := tlsConn.ConnectionState()
+	return tlsconfig.Identity(&state), errors.Err(tlsConn.SetDeadline(time.Time{}))
+}
+
+// checkProtected refuses protected blobs unless they are requested by an identified edge or the request carries
+// a valid signature for them
+func (s *Server) checkProtected(request compositeRequest, blobHash, clientIP, edge string) error {
+	if !s.Protected.IsProtected(blobHash) || edge != "" {
+		return nil
+	}
+	err := s.Signatures.VerifyQuery(blobHash, request.Signatures[blobHash], clientIP)
+	if err != nil {
+		return errors.Prefix("requested blob is protected", err)
+	}
+	return nil
+}
+
+func (s *Server) handleCompositeRequest(data []byte, clientIP, edge string) ([]byte, error) {
 	var request compositeRequest
 	err := json.Unmarshal(data, &request)
 	if err != nil {
@@ -240,8 +356,12 @@ func (s *Server) handleCompositeRequest(data []byte) ([]byte, error) {
 
 	if len(request.RequestedBlobs) > 0 {
 		for _, blobHash := range request.RequestedBlobs {
-			if reflector.IsProtected(blobHash) {
-				return nil, errors.Err("requested blob is protected")
+			err = s.checkProtected(request, blobHash, clientIP, edge)
+			if err != nil {
+				return nil, err
+			}
+			if s.Blocklist.IsBlocked(blobHash) {
+				return nil, errors.Err("requested blob is blocked")
 			}
 			var exists bool
 			exists, err = s.store.Has(blobHash)
@@ -267,6 +387,13 @@ func (s *Server) handleCompositeRequest(data []byte) ([]byte, error) {
 		if len(request.RequestedBlob) != stream.BlobHashHexLength {
 			return nil, errors.Err("Invalid blob hash length")
 		}
+		err = s.checkProtected(request, request.RequestedBlob, clientIP, edge)
+		if err != nil {
+			return nil, err
+		}
+		if s.Blocklist.IsBlocked(request.RequestedBlob) {
+			return nil, errors.Err("requested blob is blocked")
+		}
 
 		log.Debugln("Sending blob " + request.RequestedBlob[:8])
 
@@ -286,6 +413,7 @@ func (s *Server) handleCompositeRequest(data []byte) ([]byte, error) {
 			metrics.MtrOutBytesTcp.Add(float64(len(blob)))
 			metrics.BlobDownloadCount.Inc()
 			metrics.PeerDownloadCount.Inc()
+			server.TrackEdgeDownload(edge, "peer", int64(len(blob)))
 		}
 	}
 
@@ -412,6 +540,8 @@ type compositeRequest struct {
 	RequestedBlob       string   `json:"requested_blob"`
 	RequestedBlobs      []string `json:"requested_blobs"`
 	LbrycrdAddress      bool     `json:"lbrycrd_address"`
+	// Signatures holds the signed URL query string (see the signing package) of each requested protected blob
+	Signatures map[string]string `json:"signatures,omitempty"`
 }
 
 type compositeResponse struct {
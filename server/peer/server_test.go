@@ -139,3 +139,75 @@ func TestInvalidData(t *testing.T) {
 	}
 	println(response)
 }
+
+func TestConnectionLimits(t *testing.T) {
+	s := getServer(t, true)
+	s.MaxConnectionsPerIP = 1
+	err := s.Start()
+	if err != nil {
+		t.Fatal("error starting server", err)
+	}
+	defer s.Shutdown()
+
+	request := availabilityRequests[0]
+	first, err := net.Dial("tcp", "127.0.0.1:50505")
+	if err != nil {
+		t.Fatal("error opening connection", err)
+	}
+	defer func() { _ = first.Close() }()
+	_, err = first.Write(request.request)
+	if err != nil {
+		t.Fatal("error writing", err)
+	}
+	response := make([]byte, 8192)
+	_, err = first.Read(response)
+	if err != nil {
+		t.Fatal("error reading", err)
+	}
+
+	second, err := net.Dial("tcp", "127.0.0.1:50505")
+	if err != nil {
+		t.Fatal("error opening connection", err)
+	}
+	defer func() { _ = second.Close() }()
+	_ = second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = second.Read(response)
+	if err != io.EOF {
+		t.Errorf("expected the second connection from the same ip to be closed, got %v", err)
+	}
+}
+
+func TestShutdownClosesIdleConnections(t *testing.T) {
+	s := getServer(t, true)
+	s.IdleTimeout = time.Hour
+	err := s.Start()
+	if err != nil {
+		t.Fatal("error starting server", err)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:50505")
+	if err != nil {
+		t.Fatal("error opening connection", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_, err = conn.Write(availabilityRequests[0].request)
+	if err != nil {
+		t.Fatal("error writing", err)
+	}
+	response := make([]byte, 8192)
+	_, err = conn.Read(response)
+	if err != nil {
+		t.Fatal("error reading", err)
+	}
+
+	start := time.Now()
+	s.Shutdown()
+	if time.Since(start) > time.Second {
+		t.Errorf("shutdown waited %s for an idle connection", time.Since(start))
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(response)
+	if err != io.EOF {
+		t.Errorf("expected the idle connection to be closed, got %v", err)
+	}
+}
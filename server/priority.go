@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/hex"
+
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	"github.com/bluele/gcache"
+)
+
+// firstBlobs is the number of content blobs at the start of a stream that are served with high priority
+const firstBlobs = 2
+
+// Priorities remembers the sd blobs and the first blobs of the streams a server has served, so requests for
+// them, which playback is waiting for, can skip ahead in the queue. Unknown hashes have normal priority.
+type Priorities struct {
+	high gcache.Cache
+}
+
+// NewPriorities returns a Priorities remembering the hashes of the last size streams
+func NewPriorities(size int) *Priorities {
+	return &Priorities{high: gcache.New(size * (firstBlobs + 1)).LRU().Build()}
+}
+
+// Of returns the priority of a request for the hash
+func (p *Priorities) Of(hash string) Priority {
+	if p != nil && p.high.Has(hash) {
+		return PriorityHigh
+	}
+	return PriorityNormal
+}
+
+// Learn checks whether a served blob is an sd blob, and if so remembers it and the first blobs of its stream
+func (p *Priorities) Learn(hash string, blob []byte) {
+	// sd blobs are json objects, which is much cheaper to check than parsing every blob
+	if p == nil || len(blob) == 0 || blob[0] != '{' {
+		return
+	}
+	var sd stream.SDBlob
+	if sd.FromBlob(blob) != nil {
+		return
+	}
+	_ = p.high.Set(hash, true)
+	for i, info := range sd.BlobInfos {
+		if i >= firstBlobs {
+			break
+		}
+		if info.Length > 0 {
+			_ = p.high.Set(hex.EncodeToString(info.BlobHash), true)
+		}
+	}
+}
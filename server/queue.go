@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ErrQueueFull means the server is saturated and can't take more requests
+	ErrQueueFull = errors.Base("request queue is full")
+	// ErrClientQueueFull means the client has too many requests waiting already
+	ErrClientQueueFull = errors.Base("too many queued requests from this client")
+	// ErrQueueTimeout means the request waited too long for a worker
+	ErrQueueTimeout = errors.Base("timed out waiting in the request queue")
+)
+
+// Priority orders the requests of a queue. Lower values are served first.
+type Priority int
+
+const (
+	// PriorityHigh is for sd blobs and the first blobs of streams, which playback is waiting for
+	PriorityHigh Priority = iota
+	PriorityNormal
+	numPriorities
+)
+
+const (
+	defaultMaxQueueLength = 20000
+	defaultMaxQueueWait   = 30 * time.Second
+)
+
+// QueueConfig bounds a request queue
+type QueueConfig struct {
+	MaxLength    int           // requests waiting at most. Default 20000
+	MaxWait      time.Duration // time a request waits for a worker at most. Default 30s
+	MaxPerClient int           // requests a single client may have waiting. 0 means no limit
+}
+
+// Queue is a bounded queue of requests served by a pool of workers. Requests are served by priority, then
+// in turns between clients, so a client sending many requests can't starve the others.
+type Queue struct {
+	name    string
+	workers int
+	cfg     QueueConfig
+	length  prometheus.Gauge
+	ready   chan struct{}
+
+	mu       sync.Mutex
+	waiting  int
+	levels   [numPriorities]fairQueue
+	byClient map[string]int
+}
+
+// fairQueue holds the requests of one priority, with the clients taking turns
+type fairQueue struct {
+	jobs  map[string][]*job
+	turns []string // clients with requests waiting, in the order they are served
+}
+
+type job struct {
+	client string
+	fn     func()
+	done   chan struct{}
+}
+
+// NewQueue returns a queue named after the server using it, to be served by the given number of workers.
+// length is updated with the number of requests waiting.
+func NewQueue(name string, workers int, cfg QueueConfig, length prometheus.Gauge) *Queue {
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = defaultMaxQueueLength
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = defaultMaxQueueWait
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	q := &Queue{
+		name:     name,
+		workers:  workers,
+		cfg:      cfg,
+		length:   length,
+		ready:    make(chan struct{}, cfg.MaxLength),
+		byClient: make(map[string]int),
+	}
+	for i := range q.levels {
+		q.levels[i].jobs = make(map[string][]*job)
+	}
+	return q
+}
+
+// Start starts the workers. They stop with the group.
+func (q *Queue) Start(grp *stop.Group) {
+	for i := 0; i < q.workers; i++ {
+		metrics.RoutinesQueue.WithLabelValues(q.name, "worker").Inc()
+		grp.Add(1)
+		go func() {
+			defer grp.Done()
+			defer metrics.RoutinesQueue.WithLabelValues(q.name, "worker").Dec()
+			for {
+				select {
+				case <-grp.Ch():
+					return
+				case <-q.ready:
+					for j := q.pop(); j != nil; j = q.pop() {
+						j.fn()
+						close(j.done)
+					}
+				}
+			}
+		}()
+	}
+}
+
+// Do runs fn on a worker and waits for it to finish. It returns an error without running fn if the queue
+// or the queue of the client is full, or if no worker picked the request up within the max wait or before ctx ended.
+func (q *Queue) Do(ctx context.Context, client string, priority Priority, fn func()) error {
+	j := &job{client: client, fn: fn, done: make(chan struct{})}
+	err := q.push(j, priority)
+	if err != nil {
+		metrics.QueueRejectedCount.WithLabelValues(q.name, rejectReason(err)).Inc()
+		return err
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default: // enough workers are being woken up already
+	}
+
+	timer := time.NewTimer(q.cfg.MaxWait)
+	defer timer.Stop()
+	select {
+	case <-j.done:
+		return nil
+	case <-timer.C:
+		err = errors.Err(ErrQueueTimeout)
+	case <-ctx.Done():
+		err = errors.Err(ctx.Err())
+	}
+	if !q.remove(j, priority) {
+		// a worker has it already
+		<-j.done
+		return nil
+	}
+	metrics.QueueRejectedCount.WithLabelValues(q.name, rejectReason(err)).Inc()
+	return err
+}
+
+// RetryAfter is how long clients refused by the queue should wait before retrying
+func (q *Queue) RetryAfter() time.Duration {
+	return q.cfg.MaxWait
+}
+
+func (q *Queue) push(j *job, priority Priority) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.waiting >= q.cfg.MaxLength {
+		return errors.Err(ErrQueueFull)
+	}
+	if q.cfg.MaxPerClient > 0 && q.byClient[j.client] >= q.cfg.MaxPerClient {
+		return errors.Err(ErrClientQueueFull)
+	}
+	level := &q.levels[priority]
+	if len(level.jobs[j.client]) == 0 {
+		level.turns = append(level.turns, j.client)
+	}
+	level.jobs[j.client] = append(level.jobs[j.client], j)
+	q.added(j.client, 1)
+	return nil
+}
+
+// pop returns the next request to serve, or nil if none is waiting
+func (q *Queue) pop() *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.levels {
+		level := &q.levels[i]
+		if len(level.turns) == 0 {
+			continue
+		}
+		client := level.turns[0]
+		level.turns = level.turns[1:]
+		jobs := level.jobs[client]
+		j := jobs[0]
+		if len(jobs) > 1 {
+			level.jobs[client] = jobs[1:]
+			level.turns = append(level.turns, client)
+		} else {
+			delete(level.jobs, client)
+		}
+		q.added(client, -1)
+		return j
+	}
+	return nil
+}
+
+// remove takes a request out of the queue. It returns false if the request was already picked up by a worker.
+func (q *Queue) remove(j *job, priority Priority) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	level := &q.levels[priority]
+	jobs := level.jobs[j.client]
+	for i := range jobs {
+		if jobs[i] != j {
+			continue
+		}
+		if len(jobs) > 1 {
+			level.jobs[j.client] = append(jobs[:i:i], jobs[i+1:]...)
+		} else {
+			delete(level.jobs, j.client)
+			for t, client := range level.turns {
+				if client == j.client {
+					level.turns = append(level.turns[:t:t], level.turns[t+1:]...)
+					break
+				}
+			}
+		}
+		q.added(j.client, -1)
+		return true
+	}
+	return false
+}
+
+// added updates the counts after n requests of the client were added to the queue, or removed if n is negative
+func (q *Queue) added(client string, n int) {
+	q.waiting += n
+	q.byClient[client] += n
+	if q.byClient[client] == 0 {
+		delete(q.byClient, client)
+	}
+	if q.length != nil {
+		q.length.Add(float64(n))
+	}
+}
+
+func rejectReason(err error) string {
+	switch {
+	case errors.Is(err, ErrQueueFull):
+		return "queue_full"
+	case errors.Is(err, ErrClientQueueFull):
+		return "client_queue_full"
+	case errors.Is(err, ErrQueueTimeout):
+		return "timeout"
+	default:
+		return "canceled"
+	}
+}
+
+// ClientKey identifies the client of a request for fairness between clients: the edge identity from its client
+// certificate, or its ip
+func ClientKey(r *http.Request) string {
+	if edge := EdgeIdentity(r); edge != "" {
+		return edge
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// QueueRejected returns true if err is the queue refusing a request, because it is full or the request waited too long
+func QueueRejected(err error) bool {
+	return errors.Is(err, ErrQueueFull) || errors.Is(err, ErrClientQueueFull) || errors.Is(err, ErrQueueTimeout)
+}
+
+// RejectQueued answers a request the queue refused with err. Clients over their share get 429, everyone gets 503
+// when the server is saturated, both with a Retry-After header.
+func RejectQueued(w http.ResponseWriter, q *Queue, err error) {
+	if !QueueRejected(err) {
+		return // the client went away
+	}
+	status := http.StatusServiceUnavailable
+	if errors.Is(err, ErrClientQueueFull) {
+		status = http.StatusTooManyRequests
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(q.RetryAfter().Seconds()))))
+	http.Error(w, err.Error(), status)
+}
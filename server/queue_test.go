@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/extras/stop"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (q *Queue) waitingCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting
+}
+
+func TestQueue_Order(t *testing.T) {
+	q := NewQueue("test", 1, QueueConfig{}, nil)
+	grp := stop.New()
+	defer grp.StopAndWait()
+	q.Start(grp)
+
+	// keep the only worker busy while the requests are queued
+	block := make(chan struct{})
+	started := make(chan struct{})
+	go func() { _ = q.Do(context.Background(), "blocker", PriorityNormal, func() { close(started); <-block }) }()
+	<-started
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	push := func(client, name string, priority Priority) {
+		waiting := q.waitingCount()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, q.Do(context.Background(), client, priority, func() {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+			}))
+		}()
+		require.Eventually(t, func() bool { return q.waitingCount() == waiting+1 }, time.Second, time.Millisecond)
+	}
+	push("greedy", "greedy-1", PriorityNormal)
+	push("greedy", "greedy-2", PriorityNormal)
+	push("greedy", "greedy-3", PriorityNormal)
+	push("polite", "polite-1", PriorityNormal)
+	push("player", "sd", PriorityHigh)
+	close(block)
+	wg.Wait()
+
+	assert.Equal(t, []string{"sd", "greedy-1", "polite-1", "greedy-2", "greedy-3"}, order)
+}
+
+func TestQueue_Limits(t *testing.T) {
+	q := NewQueue("test", 1, QueueConfig{MaxLength: 2, MaxWait: 50 * time.Millisecond, MaxPerClient: 1}, nil)
+	// no workers, so requests wait until they time out
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, client := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(i int, client string) {
+			defer wg.Done()
+			errs[i] = q.Do(context.Background(), client, PriorityNormal, func() {})
+		}(i, client)
+	}
+	require.Eventually(t, func() bool { return q.waitingCount() == 2 }, time.Second, time.Millisecond)
+
+	err := q.Do(context.Background(), "c", PriorityNormal, func() {})
+	assert.True(t, errors.Is(err, ErrQueueFull), err)
+	err = q.Do(context.Background(), "a", PriorityNormal, func() {})
+	assert.True(t, errors.Is(err, ErrQueueFull), err)
+
+	wg.Wait()
+	for _, err := range errs {
+		assert.True(t, errors.Is(err, ErrQueueTimeout), err)
+	}
+	assert.Equal(t, 0, q.waitingCount())
+
+	// the client limit applies once the queue has room
+	go func() { _ = q.Do(context.Background(), "a", PriorityNormal, func() {}) }()
+	require.Eventually(t, func() bool { return q.waitingCount() == 1 }, time.Second, time.Millisecond)
+	err = q.Do(context.Background(), "a", PriorityNormal, func() {})
+	assert.True(t, errors.Is(err, ErrClientQueueFull), err)
+
+	rec := httptest.NewRecorder()
+	RejectQueued(rec, q, err)
+	assert.Equal(t, 429, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/lbryio/reflector.go/ratelimit"
+)
+
+// RateLimitClient identifies the client of r for the rate limits, by its client certificate, its token or its ip.
+// The token only identifies the client if it is one of tokens, otherwise anyone could get new limits by
+// sending random tokens.
+func RateLimitClient(r *http.Request, tokens ...string) ratelimit.Client {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	given := r.URL.Query().Get("edge_token")
+	if auth := r.Header.Get("Authorization"); given == "" && strings.HasPrefix(auth, "Bearer ") {
+		given = strings.TrimPrefix(auth, "Bearer ")
+	}
+	client := ratelimit.Client{IP: host, Edge: EdgeIdentity(r)}
+	for _, token := range tokens {
+		if TokenMatches(given, token) {
+			client.Token = token
+			break
+		}
+	}
+	return client
+}
+
+// RateLimit counts the request against the limits of its client. If the client is over its request rate, it
+// answers 429 and returns false. Otherwise the request body is read within the bandwidth of the client.
+// tokens are the tokens the server accepts, see RateLimitClient.
+func RateLimit(l *ratelimit.Limiter, serverType string, w http.ResponseWriter, r *http.Request, tokens ...string) bool {
+	client := RateLimitClient(r, tokens...)
+	if !l.Allow(serverType, client) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return false
+	}
+	if r.Body != nil {
+		r.Body = readCloser{Reader: l.Reader(r.Context(), serverType, client, r.Body), Closer: r.Body}
+	}
+	return true
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
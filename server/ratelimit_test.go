@@ -0,0 +1,24 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitClient(t *testing.T) {
+	r := httptest.NewRequest("GET", "/blob/abc?edge_token=edge", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	assert.Equal(t, "edge", RateLimitClient(r, "edge", "upload").Token)
+	assert.Equal(t, "1.2.3.4", RateLimitClient(r, "edge", "upload").IP)
+
+	r = httptest.NewRequest("GET", "/blob/abc", nil)
+	r.Header.Set("Authorization", "Bearer upload")
+	assert.Equal(t, "upload", RateLimitClient(r, "edge", "upload").Token)
+
+	// a token the server doesn't know doesn't get its own limits
+	r = httptest.NewRequest("GET", "/blob/abc?edge_token=random", nil)
+	assert.Empty(t, RateLimitClient(r, "edge", "upload").Token)
+	assert.Empty(t, RateLimitClient(r, "", "").Token)
+}
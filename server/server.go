@@ -1,5 +1,11 @@
 package server
 
+import (
+	"time"
+
+	"github.com/lbryio/reflector.go/tlsconfig"
+)
+
 // BlobServer defines the common interface for all blob server implementations
 type BlobServer interface {
 	Start() error
@@ -7,8 +13,26 @@ type BlobServer interface {
 }
 
 type BlobServerConfig struct {
-	Address               string `mapstructure:"address"`
-	EdgeToken             string `mapstructure:"edge_token"`
-	Port                  int    `mapstructure:"port"`
-	MaxConcurrentRequests int    `mapstructure:"max_concurrent_requests"`
+	Address               string                 `mapstructure:"address"`
+	EdgeToken             string                 `mapstructure:"edge_token"`
+	Port                  int                    `mapstructure:"port"`
+	MaxConcurrentRequests int                    `mapstructure:"max_concurrent_requests"`
+	Timeout               time.Duration          `mapstructure:"timeout"`
+	MaxConnections        int                    `mapstructure:"max_connections"`
+	EnableBlocklist       bool                   `mapstructure:"enable_blocklist"`
+	EnableStreams         bool                   `mapstructure:"enable_streams"`
+	UploadToken           string                 `mapstructure:"upload_token"`
+	TLS                   tlsconfig.ServerConfig `mapstructure:"tls"`
+	MaxQueueLength        int                    `mapstructure:"max_queue_length"`
+	MaxQueueWait          time.Duration          `mapstructure:"max_queue_wait"`
+	MaxQueuedPerClient    int                    `mapstructure:"max_queued_per_client"`
+	ProxyProtocol         bool                   `mapstructure:"proxy_protocol"`
+	MaxConnectionsPerIP   int                    `mapstructure:"max_connections_per_ip"`
+	IdleTimeout           time.Duration          `mapstructure:"idle_timeout"`
+	DrainTimeout          time.Duration          `mapstructure:"drain_timeout"`
+}
+
+// QueueConfig returns the bounds of the request queue of the server
+func (c BlobServerConfig) QueueConfig() QueueConfig {
+	return QueueConfig{MaxLength: c.MaxQueueLength, MaxWait: c.MaxQueueWait, MaxPerClient: c.MaxQueuedPerClient}
 }
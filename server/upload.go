@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/lbryio/reflector.go/internal/metrics"
+	"github.com/lbryio/reflector.go/shared"
+	"github.com/lbryio/reflector.go/store"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/stream"
+)
+
+var (
+	ErrHashMismatch   = errors.Base("blob data does not match the hash")
+	ErrInvalidHash    = errors.Base("invalid blob hash")
+	ErrUnknownStream  = errors.Base("stream is not known")
+	ErrUploadTooLarge = errors.Base("blob is larger than the maximum blob size")
+)
+
+// UploadResult tells an uploader what happened to a blob it sent
+type UploadResult struct {
+	// Received is false if the store didn't want the blob, because it already has it or it is blocked
+	Received bool `json:"received"`
+	// NeededBlobs are the content blobs still missing from a stream whose sd blob was not wanted
+	NeededBlobs []string `json:"needed_blobs,omitempty"`
+}
+
+// Authorized returns true if the request carries token as a bearer token
+func Authorized(r *http.Request, token string) bool {
+	return TokenMatches(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), token)
+}
+
+// TokenMatches compares given with token in constant time. An empty token matches nothing.
+func TokenMatches(given, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// ReceiveBlob stores a blob uploaded over HTTP if the store wants it, the same way the reflector server
+// does. The body is only read if the blob is wanted. It returns the number of bytes received.
+func ReceiveBlob(s store.BlobStore, hash string, isSD bool, body io.Reader) (UploadResult, int, error) {
+	if len(hash) != stream.BlobHashHexLength {
+		return UploadResult{}, 0, errors.Err(ErrInvalidHash)
+	}
+	wants, err := wantsBlob(s, hash)
+	if err != nil {
+		return UploadResult{}, 0, err
+	}
+	if isSD && !wants {
+		var needed []string
+		needed, err = MissingBlobs(s, hash)
+		if errors.Is(err, shared.ErrNotImplemented) {
+			// if we can't tell which blobs are missing, the sd blob has to be taken again, like the reflector server does
+			wants = true
+		} else if err != nil {
+			return UploadResult{}, 0, err
+		} else {
+			return UploadResult{NeededBlobs: needed}, 0, nil
+		}
+	}
+	if !wants {
+		return UploadResult{}, 0, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, stream.MaxBlobSize+1))
+	if err != nil {
+		return UploadResult{}, 0, errors.Err(err)
+	}
+	if len(data) > stream.MaxBlobSize {
+		return UploadResult{}, len(data), errors.Err(ErrUploadTooLarge)
+	}
+	blob := stream.Blob(data)
+	if blob.HashHex() != hash {
+		return UploadResult{}, len(data), errors.Err(ErrHashMismatch)
+	}
+
+	if isSD {
+		err = shared.ValidateSDBlob(blob)
+		if err != nil {
+			return UploadResult{}, len(data), err
+		}
+		err = s.PutSD(hash, blob)
+	} else {
+		err = s.Put(hash, blob)
+	}
+	if err != nil {
+		return UploadResult{}, len(data), err
+	}
+	metrics.BlobUploadCount.Inc()
+	if isSD {
+		metrics.SDBlobUploadCount.Inc()
+	}
+	return UploadResult{Received: true}, len(data), nil
+}
+
+// MissingBlobs returns the content blobs of a stream known to the store that are not stored yet.
+// It returns ErrUnknownStream if the store doesn't have the sd blob.
+func MissingBlobs(s store.BlobStore, sdHash string) ([]string, error) {
+	nbc, ok := s.(store.NeededBlobChecker)
+	if !ok {
+		return nil, errors.Err(shared.ErrNotImplemented)
+	}
+	has, err := s.Has(sdHash)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, errors.Err(ErrUnknownStream)
+	}
+	missing, err := nbc.MissingBlobsForKnownStream(sdHash)
+	if err != nil {
+		return nil, err
+	}
+	if missing == nil {
+		missing = []string{}
+	}
+	return missing, nil
+}
+
+// ErrorStatus returns the HTTP status for an error returned by ReceiveBlob, MissingBlobs or CheckAvailability
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrHashMismatch), errors.Is(err, ErrInvalidHash), errors.Is(err, ErrTooManyHashes), errors.Is(err, shared.ErrInvalidSDBlob):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnknownStream):
+		return http.StatusNotFound
+	case errors.Is(err, shared.ErrNotImplemented):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// wantsBlob returns true if the store wants the blob: it doesn't have it and, for Blocklisters, it isn't blocked
+func wantsBlob(s store.BlobStore, hash string) (bool, error) {
+	if bl, ok := s.(store.Blocklister); ok {
+		return bl.Wants(hash)
+	}
+	has, err := s.Has(hash)
+	return !has, err
+}
@@ -0,0 +1,123 @@
+package shared
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/stream"
+)
+
+// ErrInvalidSDBlob is returned for sd blobs that don't describe a valid stream
+var ErrInvalidSDBlob = errors.Base("invalid sd blob")
+
+const streamTypeLBRYFile = "lbryfile"
+
+// sdBlobSchema has a pointer for every required field, to tell missing fields from empty ones
+type sdBlobSchema struct {
+	StreamName        *string          `json:"stream_name"`
+	StreamType        *string          `json:"stream_type"`
+	Key               *string          `json:"key"`
+	SuggestedFileName *string          `json:"suggested_file_name"`
+	StreamHash        *string          `json:"stream_hash"`
+	Blobs             []blobInfoSchema `json:"blobs"`
+}
+
+type blobInfoSchema struct {
+	BlobHash *string `json:"blob_hash"`
+	IV       *string `json:"iv"`
+	Length   *int    `json:"length"`
+	BlobNum  *int    `json:"blob_num"`
+}
+
+// ValidateSDBlob checks that an sd blob describes a valid stream, as defined by the LBRY stream spec:
+//   - every field is present, with the right type, and hex where the spec says so
+//   - the key and the IVs are AES blocks
+//   - the blobs are numbered from 0, in order, each at most stream.MaxBlobSize bytes
+//   - the stream ends with a zero-length blob without a hash
+//   - stream_hash is the hash of the rest of the sd blob
+//
+// The error wraps ErrInvalidSDBlob and says what is wrong.
+func ValidateSDBlob(blob []byte) error {
+	var sd sdBlobSchema
+	err := json.Unmarshal(blob, &sd)
+	if err != nil {
+		return invalidSDBlob("%s", err.Error())
+	}
+	fields := []struct {
+		name  string
+		value *string
+		isHex bool
+	}{
+		{"stream_name", sd.StreamName, true},
+		{"stream_type", sd.StreamType, false},
+		{"key", sd.Key, true},
+		{"suggested_file_name", sd.SuggestedFileName, true},
+		{"stream_hash", sd.StreamHash, true},
+	}
+	for _, f := range fields {
+		if f.value == nil {
+			return invalidSDBlob("%s is missing", f.name)
+		}
+		if f.isHex && !isHex(*f.value) {
+			return invalidSDBlob("%s is not hex", f.name)
+		}
+	}
+	if *sd.StreamType != streamTypeLBRYFile {
+		return invalidSDBlob("stream_type is %q, not %q", *sd.StreamType, streamTypeLBRYFile)
+	}
+	if len(*sd.Key) != aes.BlockSize*2 {
+		return invalidSDBlob("key is %d hex chars, not %d", len(*sd.Key), aes.BlockSize*2)
+	}
+	if len(*sd.StreamHash) != stream.BlobHashHexLength {
+		return invalidSDBlob("stream_hash is %d hex chars, not %d", len(*sd.StreamHash), stream.BlobHashHexLength)
+	}
+	if len(sd.Blobs) == 0 {
+		return invalidSDBlob("blobs is missing or empty")
+	}
+
+	for i, b := range sd.Blobs {
+		if b.BlobNum == nil || b.Length == nil || b.IV == nil {
+			return invalidSDBlob("blob %d is missing blob_num, length or iv", i)
+		}
+		if *b.BlobNum != i {
+			return invalidSDBlob("blob %d has blob_num %d", i, *b.BlobNum)
+		}
+		if len(*b.IV) != aes.BlockSize*2 || !isHex(*b.IV) {
+			return invalidSDBlob("blob %d has an iv that is not %d hex chars", i, aes.BlockSize*2)
+		}
+		if i == len(sd.Blobs)-1 {
+			if *b.Length != 0 || (b.BlobHash != nil && *b.BlobHash != "") {
+				return invalidSDBlob("stream does not end with a zero-length blob without a hash")
+			}
+			break
+		}
+		if *b.Length <= 0 || *b.Length > stream.MaxBlobSize {
+			return invalidSDBlob("blob %d has length %d, it must be between 1 and %d", i, *b.Length, stream.MaxBlobSize)
+		}
+		if b.BlobHash == nil || len(*b.BlobHash) != stream.BlobHashHexLength || !isHex(*b.BlobHash) {
+			return invalidSDBlob("blob %d has a blob_hash that is not %d hex chars", i, stream.BlobHashHexLength)
+		}
+	}
+
+	var parsed stream.SDBlob
+	err = parsed.FromBlob(blob)
+	if err != nil {
+		return invalidSDBlob("%s", err.Error())
+	}
+	if !parsed.IsValid() {
+		return invalidSDBlob("stream_hash does not match the stream")
+	}
+	return nil
+}
+
+func invalidSDBlob(format string, a ...interface{}) error {
+	return errors.Err(fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidSDBlob}, a...)...))
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,62 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSDBlob(t *testing.T) {
+	st, err := stream.New(bytes.NewReader(bytes.Repeat([]byte("lbry"), stream.MaxBlobSize/2)))
+	require.NoError(t, err)
+	require.NoError(t, ValidateSDBlob(st[0]))
+
+	tests := []struct {
+		name   string
+		change func(sd map[string]interface{})
+		reason string
+	}{
+		{"not json", nil, "invalid character"},
+		{"missing key", func(sd map[string]interface{}) { delete(sd, "key") }, "key is missing"},
+		{"wrong type", func(sd map[string]interface{}) { sd["stream_name"] = 12 }, "cannot unmarshal number"},
+		{"stream type", func(sd map[string]interface{}) { sd["stream_type"] = "video" }, "stream_type is"},
+		{"short key", func(sd map[string]interface{}) { sd["key"] = "abcd" }, "key is 4 hex chars"},
+		{"stream hash not hex", func(sd map[string]interface{}) { sd["stream_hash"] = "zz" }, "stream_hash is not hex"},
+		{"no blobs", func(sd map[string]interface{}) { sd["blobs"] = []interface{}{} }, "blobs is missing or empty"},
+		{"blob_num", func(sd map[string]interface{}) { blob(sd, 1)["blob_num"] = 2 }, "blob 1 has blob_num 2"},
+		{"iv", func(sd map[string]interface{}) { blob(sd, 0)["iv"] = "00" }, "blob 0 has an iv"},
+		{"length", func(sd map[string]interface{}) { blob(sd, 0)["length"] = stream.MaxBlobSize + 1 }, "blob 0 has length"},
+		{"blob hash", func(sd map[string]interface{}) { delete(blob(sd, 0), "blob_hash") }, "blob 0 has a blob_hash"},
+		{"terminator", func(sd map[string]interface{}) {
+			blobs := sd["blobs"].([]interface{})
+			sd["blobs"] = blobs[:len(blobs)-1]
+		}, "does not end with a zero-length blob"},
+		{"stream hash", func(sd map[string]interface{}) { sd["suggested_file_name"] = "6c627279" }, "stream_hash does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sdBlob := []byte("not json")
+			if tt.change != nil {
+				var sd map[string]interface{}
+				require.NoError(t, json.Unmarshal(st[0], &sd))
+				tt.change(sd)
+				sdBlob, err = json.Marshal(sd)
+				require.NoError(t, err)
+			}
+			err := ValidateSDBlob(sdBlob)
+			assert.True(t, errors.Is(err, ErrInvalidSDBlob), "expected ErrInvalidSDBlob, got %v", err)
+			assert.True(t, strings.Contains(err.Error(), tt.reason), "expected %q in %q", tt.reason, err.Error())
+		})
+	}
+}
+
+func blob(sd map[string]interface{}, i int) map[string]interface{} {
+	return sd["blobs"].([]interface{})[i].(map[string]interface{})
+}
@@ -0,0 +1,150 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+)
+
+// Query parameters of a signed URL
+const (
+	ParamExpires   = "expires"
+	ParamKeyID     = "kid"
+	ParamIP        = "ip"
+	ParamSignature = "signature"
+)
+
+var (
+	ErrMissingSignature = errors.Base("missing signature")
+	ErrInvalidSignature = errors.Base("invalid signature")
+	ErrExpired          = errors.Base("signature expired")
+	ErrUnknownKey       = errors.Base("unknown signing key")
+	ErrIPMismatch       = errors.Base("signature is bound to another ip")
+)
+
+// Key is a secret used to sign URLs. Keys have an ID so that several of them can be accepted during a rotation.
+type Key struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+// Keyring verifies URLs that grant time limited access to a blob. Any of its keys is accepted, so a new key is
+// rolled out by adding it to the servers before the signers use it, and the old one is removed once the URLs
+// it signed have expired. An empty Keyring accepts nothing.
+type Keyring struct {
+	mu   sync.RWMutex
+	keys map[string][]byte
+}
+
+// NewKeyring returns an initialized Keyring pointer.
+func NewKeyring(keys []Key) (*Keyring, error) {
+	k := &Keyring{}
+	err := k.SetKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// SetKeys replaces the keys of the keyring
+func (k *Keyring) SetKeys(keys []Key) error {
+	byID := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if key.ID == "" || key.Secret == "" {
+			return errors.Err("signing keys need an id and a secret")
+		}
+		if _, ok := byID[key.ID]; ok {
+			return errors.Err("duplicate signing key %s", key.ID)
+		}
+		byID[key.ID] = []byte(key.Secret)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = byID
+	return nil
+}
+
+// HasKeys returns true if the keyring accepts any key
+func (k *Keyring) HasKeys() bool {
+	if k == nil {
+		return false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.keys) > 0
+}
+
+// Sign returns the query parameters that grant access to the blob until expires, signed with key.
+// If ip is not empty, the parameters are only valid for requests coming from that ip.
+func Sign(key Key, hash string, expires time.Time, ip string) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	params := url.Values{}
+	params.Set(ParamExpires, exp)
+	params.Set(ParamKeyID, key.ID)
+	if ip != "" {
+		params.Set(ParamIP, ip)
+	}
+	params.Set(ParamSignature, signature([]byte(key.Secret), hash, exp, ip))
+	return params
+}
+
+// Verify checks that params hold a valid signature for the blob, and that it is used in time by clientIP.
+// A nil Keyring accepts nothing.
+func (k *Keyring) Verify(hash string, params url.Values, clientIP string) error {
+	sig := params.Get(ParamSignature)
+	if sig == "" {
+		return errors.Err(ErrMissingSignature)
+	}
+	if k == nil {
+		return errors.Err(ErrUnknownKey)
+	}
+
+	k.mu.RLock()
+	secret, ok := k.keys[params.Get(ParamKeyID)]
+	k.mu.RUnlock()
+	if !ok {
+		return errors.Err(ErrUnknownKey)
+	}
+
+	exp := params.Get(ParamExpires)
+	ip := params.Get(ParamIP)
+	expected := signature(secret, hash, exp, ip)
+	if subtle.ConstantTimeCompare([]byte(sig), []byte(expected)) != 1 {
+		return errors.Err(ErrInvalidSignature)
+	}
+
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return errors.Err(ErrInvalidSignature)
+	}
+	if time.Now().Unix() > expires {
+		return errors.Err(ErrExpired)
+	}
+	if ip != "" && ip != clientIP {
+		return errors.Err(ErrIPMismatch)
+	}
+	return nil
+}
+
+// VerifyQuery is Verify for parameters encoded as a query string
+func (k *Keyring) VerifyQuery(hash, query, clientIP string) error {
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return errors.Err(ErrInvalidSignature)
+	}
+	return k.Verify(hash, params, clientIP)
+}
+
+func signature(secret []byte, hash, expires, ip string) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(hash + "\n" + expires + "\n" + ip))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
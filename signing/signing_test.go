@@ -0,0 +1,72 @@
+package signing
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var hash = strings.Repeat("a", 96)
+
+func TestKeyring_Verify(t *testing.T) {
+	current := Key{ID: "2", Secret: "new secret"}
+	previous := Key{ID: "1", Secret: "old secret"}
+	keyring, err := NewKeyring([]Key{current, previous})
+	require.NoError(t, err)
+
+	inAMinute := time.Now().Add(time.Minute)
+	tests := map[string]struct {
+		sign     func() url.Values
+		clientIP string
+		err      error
+	}{
+		"current key":  {sign: func() url.Values { return Sign(current, hash, inAMinute, "") }},
+		"previous key": {sign: func() url.Values { return Sign(previous, hash, inAMinute, "") }},
+		"bound ip":     {sign: func() url.Values { return Sign(current, hash, inAMinute, "10.0.0.1") }, clientIP: "10.0.0.1"},
+		"other ip":     {sign: func() url.Values { return Sign(current, hash, inAMinute, "10.0.0.1") }, clientIP: "10.0.0.2", err: ErrIPMismatch},
+		"expired":      {sign: func() url.Values { return Sign(current, hash, time.Now().Add(-time.Minute), "") }, err: ErrExpired},
+		"unknown key":  {sign: func() url.Values { return Sign(Key{ID: "3", Secret: "x"}, hash, inAMinute, "") }, err: ErrUnknownKey},
+		"other hash":   {sign: func() url.Values { return Sign(current, strings.Repeat("b", 96), inAMinute, "") }, err: ErrInvalidSignature},
+		"unsigned":     {sign: func() url.Values { return nil }, err: ErrMissingSignature},
+		"tampered expiry": {sign: func() url.Values {
+			params := Sign(current, hash, inAMinute, "")
+			params.Set(ParamExpires, "99999999999")
+			return params
+		}, err: ErrInvalidSignature},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := keyring.Verify(hash, test.sign(), test.clientIP)
+			if test.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, test.err), "got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyring_SetKeys(t *testing.T) {
+	keyring, err := NewKeyring([]Key{{ID: "1", Secret: "old secret"}})
+	require.NoError(t, err)
+	params := Sign(Key{ID: "1", Secret: "old secret"}, hash, time.Now().Add(time.Minute), "")
+	require.NoError(t, keyring.VerifyQuery(hash, params.Encode(), ""))
+
+	require.NoError(t, keyring.SetKeys([]Key{{ID: "2", Secret: "new secret"}}))
+	assert.True(t, errors.Is(keyring.VerifyQuery(hash, params.Encode(), ""), ErrUnknownKey))
+
+	assert.Error(t, keyring.SetKeys([]Key{{ID: "2", Secret: "a"}, {ID: "2", Secret: "b"}}))
+	assert.Error(t, keyring.SetKeys([]Key{{ID: "3"}}))
+
+	require.NoError(t, keyring.SetKeys(nil))
+	assert.False(t, keyring.HasKeys())
+	var nilKeyring *Keyring
+	assert.False(t, nilKeyring.HasKeys())
+	assert.Error(t, nilKeyring.Verify(hash, params, ""))
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+)
+
+// HasBlobs checks many hashes at once if the store is a BatchChecker, and one by one otherwise.
+// Hashes the store doesn't have may be left out of the map.
+func HasBlobs(s BlobStore, hashes []string) (map[string]bool, error) {
+	if len(hashes) == 0 {
+		return map[string]bool{}, nil
+	}
+	if bc, ok := s.(BatchChecker); ok {
+		return bc.HasBlobs(hashes)
+	}
+	return hasEach(s.Has, hashes)
+}
+
+// hasEach checks the hashes one by one
+func hasEach(check func(hash string) (bool, error), hashes []string) (map[string]bool, error) {
+	found := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		has, err := check(hash)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			found[hash] = true
+		}
+	}
+	return found, nil
+}
+
+// missingFrom returns the hashes that are not in found
+func missingFrom(hashes []string, found map[string]bool) []string {
+	var missing []string
+	for _, hash := range hashes {
+		if !found[hash] {
+			missing = append(missing, hash)
+		}
+	}
+	return missing
+}
+
+// errBatchUnsupported is returned by postHas when the server has no batch availability endpoint
+var errBatchUnsupported = errors.Base("server does not support batch availability requests")
+
+// maxBatchHashes is the number of hashes sent in a single availability request. Servers refuse larger batches.
+const maxBatchHashes = 1000
+
+type hasRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+type hasResponse struct {
+	Available map[string]bool `json:"available"`
+}
+
+// postHas asks the http or http3 server at address which of the hashes it has, using its POST /has endpoint.
+// It returns errBatchUnsupported if the server doesn't have the endpoint.
+func postHas(client *http.Client, address string, hashes []string) (map[string]bool, error) {
+	found := make(map[string]bool, len(hashes))
+	for start := 0; start < len(hashes); start += maxBatchHashes {
+		end := start + maxBatchHashes
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		body, err := json.Marshal(hasRequest{Hashes: hashes[start:end]})
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		res, err := client.Post(address+"/has", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		var response hasResponse
+		switch res.StatusCode {
+		case http.StatusOK:
+			err = json.NewDecoder(res.Body).Decode(&response)
+		case http.StatusNotFound, http.StatusMethodNotAllowed:
+			err = errors.Err(errBatchUnsupported)
+		default:
+			body, _ := io.ReadAll(res.Body)
+			err = errors.Err("upstream error. Status code: %d (%s)", res.StatusCode, string(body))
+		}
+		_ = res.Body.Close()
+		if err != nil {
+			return nil, errors.Err(err)
+		}
+		for hash, has := range response.Available {
+			if has {
+				found[hash] = true
+			}
+		}
+	}
+	return found, nil
+}
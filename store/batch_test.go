@@ -0,0 +1,67 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingStore_HasBlobs(t *testing.T) {
+	origin := NewMemStore(MemParams{Name: "origin"})
+	cache := NewMemStore(MemParams{Name: "cache"})
+	s := NewCachingStore(CachingParams{Name: "test", Origin: origin, Cache: cache})
+	require.NoError(t, cache.Put("cached", []byte("a")))
+	require.NoError(t, origin.Put("origin", []byte("b")))
+
+	found, err := HasBlobs(s, []string{"cached", "origin", "missing"})
+	require.NoError(t, err)
+	assert.True(t, found["cached"])
+	assert.True(t, found["origin"])
+	assert.False(t, found["missing"])
+}
+
+func TestUpstreamStore_HasBlobs(t *testing.T) {
+	var batches, singles int
+	batchSupported := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/has" && batchSupported:
+			batches++
+			var request hasRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			response := hasResponse{Available: map[string]bool{}}
+			for _, hash := range request.Hashes {
+				response.Available[hash] = hash == "a"
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(response))
+		case r.Method == http.MethodHead && r.URL.Path == "/blob":
+			singles++
+			if r.URL.Query().Get("hash") == "a" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	s := NewUpstreamStore(UpstreamParams{Name: "test", Upstream: srv.URL})
+
+	found, err := s.HasBlobs([]string{"a", "b", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a": true}, found)
+	assert.Equal(t, 1, batches)
+	assert.Equal(t, 0, singles)
+
+	// servers without the batch endpoint are asked for each hash
+	batchSupported = false
+	found, err = s.HasBlobs([]string{"a", "b", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a": true}, found)
+	assert.Equal(t, 3, singles)
+}
@@ -0,0 +1,361 @@
+package store
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/lbryio/reflector.go/shared"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Builder creates store trees from configuration. Stores whose configuration did not change since the last
+// committed tree are reused instead of being created again, so that rebuilding the tree (e.g. on a config
+// reload) keeps caches, indexes and connections of the unchanged parts alive.
+//
+// Anywhere a store can be configured, `ref: <name>` may be used instead to point at a named store
+// definition. Every reference to the same name within a tree shares a single instance, which is shut
+// down when the last store using it is shut down.
+type Builder struct {
+	// live holds the instances used by the last committed tree, keyed by configuration fingerprint
+	live map[string]*refCountedStore
+	mu   sync.Mutex
+}
+
+// NewBuilder returns an initialized Builder pointer.
+func NewBuilder() *Builder {
+	return &Builder{live: make(map[string]*refCountedStore)}
+}
+
+// build holds the state of a single Builder.Build call
+type build struct {
+	previous  map[string]*refCountedStore
+	next      map[string]*refCountedStore
+	refs      []*storeRef
+	named     *viper.Viper
+	resolving map[string]bool
+	// used lists every instance the tree uses so far, in the order they were created or reused
+	used []usedStore
+}
+
+type usedStore struct {
+	fingerprint string
+	rc          *refCountedStore
+}
+
+// refKey is used in place of a store type to reference a named store definition
+const refKey = "ref"
+
+// Build creates the store tree defined by config. The config must contain exactly one key: the type of the root store.
+// named holds the store definitions that can be referenced by name from the tree. It may be nil.
+// The tree must then be committed once it is in use, or aborted if it never will be.
+func (b *Builder) Build(config, named *viper.Viper) (*Tree, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if named == nil {
+		named = viper.New()
+	}
+	current := &build{
+		previous:  b.live,
+		next:      make(map[string]*refCountedStore),
+		named:     named,
+		resolving: make(map[string]bool),
+	}
+	s, err := current.newStore(config)
+	if err != nil {
+		current.release()
+		return nil, err
+	}
+	return &Tree{Store: s, builder: b, build: current}, nil
+}
+
+// Tree is a store tree created by Builder.Build. The next Build only reuses its stores once it is committed,
+// so a tree that never goes live (e.g. a reload that failed halfway) doesn't change what the next Build reuses.
+type Tree struct {
+	Store   BlobStore
+	builder *Builder
+	build   *build
+}
+
+// Commit makes the stores of the tree the ones the next Build reuses. It is called once the tree is in use.
+func (t *Tree) Commit() {
+	t.builder.mu.Lock()
+	defer t.builder.mu.Unlock()
+	t.builder.live = t.build.next
+}
+
+// Abort shuts down a tree that was never used. New stores are shut down, and the reused ones are released.
+func (t *Tree) Abort() {
+	t.build.release()
+}
+
+// release releases everything the build acquired, so new instances are shut down and reused ones keep their old refcount
+func (b *build) release() {
+	for _, ref := range b.refs {
+		ref.Shutdown()
+	}
+}
+
+// NewStoreFromConfig creates the store defined by config, which must contain exactly one key: the store type.
+// The stores it creates are not shared with other trees, and can't reference named stores. Use a Builder for that.
+func NewStoreFromConfig(config *viper.Viper) (BlobStore, error) {
+	storeType, storeConfig, err := parseStoreConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if storeType == refKey {
+		return nil, errors.Err("store references can only be used when building from a config file")
+	}
+	factory, ok := Factories[storeType]
+	if !ok {
+		return nil, errors.Err("unknown store type %s", storeType)
+	}
+	return factory(storeConfig, NewStoreFromConfig)
+}
+
+// parseStoreConfig returns the store type of a store config and the config of that type
+func parseStoreConfig(config *viper.Viper) (string, *viper.Viper, error) {
+	if config == nil || len(config.AllSettings()) == 0 {
+		return "", nil, errors.Err("store config missing")
+	}
+	if len(config.AllSettings()) > 1 {
+		return "", nil, errors.Err("expected a single store type, got %d", len(config.AllSettings()))
+	}
+	storeType := storeTypeOf(config)
+	storeConfig := config.Sub(storeType)
+	if storeConfig == nil {
+		storeConfig = viper.New()
+	}
+	return storeType, storeConfig, nil
+}
+
+// newStore creates the store defined by config as part of the build, reusing the instance of the previous
+// tree if its config did not change. It is the NewStoreFunc the factories get, so the stores underneath are
+// reused too.
+func (b *build) newStore(config *viper.Viper) (BlobStore, error) {
+	storeType, storeConfig, err := parseStoreConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if storeType == refKey {
+		return b.resolve(config.GetString(refKey))
+	}
+	factory, ok := Factories[storeType]
+	if !ok {
+		return nil, errors.Err("unknown store type %s", storeType)
+	}
+
+	fingerprint, err := b.fingerprint(storeType, storeConfig)
+	if err != nil {
+		return nil, err
+	}
+	rc, ok := b.next[fingerprint]
+	if !ok {
+		rc, ok = b.previous[fingerprint]
+		if !ok || !rc.acquire() {
+			start := len(b.used)
+			s, err := factory(storeConfig, b.newStore)
+			if err != nil {
+				return nil, errors.Err(err)
+			}
+			rc = &refCountedStore{store: s, refs: 1, descendants: append([]usedStore(nil), b.used[start:]...)}
+		} else {
+			log.Debugf("reusing unchanged store %s", rc.store.Name())
+			// the stores underneath are reused along with it, so they must stay live for the next build too
+			for _, d := range rc.descendants {
+				if _, ok := b.next[d.fingerprint]; !ok {
+					b.next[d.fingerprint] = d.rc
+				}
+			}
+			b.used = append(b.used, rc.descendants...)
+		}
+		b.next[fingerprint] = rc
+	} else if !rc.acquire() {
+		return nil, errors.Err("store %s was shut down while building", rc.store.Name())
+	}
+	b.used = append(b.used, usedStore{fingerprint: fingerprint, rc: rc})
+
+	ref := &storeRef{BlobStore: rc.store, rc: rc}
+	b.refs = append(b.refs, ref)
+	return ref, nil
+}
+
+// storeTypeOf returns the store type of a store config, which is its only top level key
+func storeTypeOf(config *viper.Viper) string {
+	for storeType := range config.AllSettings() {
+		return storeType
+	}
+	return ""
+}
+
+// resolve creates (or shares) the named store definition
+func (b *build) resolve(name string) (BlobStore, error) {
+	// viper lowercases keys, so the definition names are lowercase too
+	name = strings.ToLower(name)
+	definition := b.named.Sub(name)
+	if definition == nil {
+		return nil, errors.Err("unknown store reference %s", name)
+	}
+	if b.resolving[name] {
+		return nil, errors.Err("store reference %s refers to itself", name)
+	}
+	b.resolving[name] = true
+	defer delete(b.resolving, name)
+
+	// a definition is built like any other store, so every reference to it ends up with the same fingerprint
+	// and therefore the same instance
+	return b.newStore(definition)
+}
+
+// fingerprint identifies a store by its type and full configuration, including underlying stores
+// and the definitions of any stores they reference
+func (b *build) fingerprint(storeType string, config *viper.Viper) (string, error) {
+	settings, err := b.expandRefs(config.AllSettings(), make(map[string]bool))
+	if err != nil {
+		return "", err
+	}
+	// map keys are marshaled in sorted order, so equal configs always produce the same fingerprint
+	serialized, err := json.Marshal(settings)
+	if err != nil {
+		return "", errors.Err(err)
+	}
+	return storeType + ":" + string(serialized), nil
+}
+
+// expandRefs replaces store references in the settings with the definitions they point to
+func (b *build) expandRefs(settings interface{}, seen map[string]bool) (interface{}, error) {
+	m, ok := settings.(map[string]interface{})
+	if !ok {
+		return settings, nil
+	}
+	if ref, ok := m[refKey].(string); ok && len(m) == 1 {
+		name := strings.ToLower(ref)
+		if seen[name] {
+			return nil, errors.Err("store reference %s refers to itself", name)
+		}
+		definition := b.named.Get(name)
+		if definition == nil {
+			return nil, errors.Err("unknown store reference %s", name)
+		}
+		seen[name] = true
+		defer delete(seen, name)
+		return b.expandRefs(definition, seen)
+	}
+
+	expanded := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		e, err := b.expandRefs(v, seen)
+		if err != nil {
+			return nil, err
+		}
+		expanded[k] = e
+	}
+	return expanded, nil
+}
+
+// refCountedStore is a store instance that may be shared by several store trees. It is shut down
+// when the last reference to it is released.
+type refCountedStore struct {
+	store BlobStore
+	refs  int
+	mu    sync.Mutex
+	// descendants are the stores it was created with, all the way down. They are live as long as it is.
+	descendants []usedStore
+}
+
+// acquire adds a reference to the store. It returns false if the store was already shut down.
+func (r *refCountedStore) acquire() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.refs <= 0 {
+		return false
+	}
+	r.refs++
+	return true
+}
+
+func (r *refCountedStore) release() {
+	r.mu.Lock()
+	r.refs--
+	last := r.refs == 0
+	r.mu.Unlock()
+	if last {
+		r.store.Shutdown()
+	}
+}
+
+// storeRef is a single reference to a shared store. Shutting it down releases the reference.
+type storeRef struct {
+	BlobStore
+	rc   *refCountedStore
+	once sync.Once
+}
+
+// Shutdown releases the reference, shutting the store down if it was the last one
+func (r *storeRef) Shutdown() {
+	r.once.Do(r.rc.release)
+}
+
+// Block forwards to the underlying store if it is a Blocklister
+func (r *storeRef) Block(hash string, info BlockInfo) error {
+	if bl, ok := r.BlobStore.(Blocklister); ok {
+		return bl.Block(hash, info)
+	}
+	return errors.Err(shared.ErrNotImplemented)
+}
+
+// Unblock forwards to the underlying store if it is a Blocklister
+func (r *storeRef) Unblock(hash string, info BlockInfo) error {
+	if bl, ok := r.BlobStore.(Blocklister); ok {
+		return bl.Unblock(hash, info)
+	}
+	return errors.Err(shared.ErrNotImplemented)
+}
+
+// Wants forwards to the underlying store if it is a Blocklister. Otherwise nothing is blocked, so it wants any blob it doesn't have.
+func (r *storeRef) Wants(hash string) (bool, error) {
+	if bl, ok := r.BlobStore.(Blocklister); ok {
+		return bl.Wants(hash)
+	}
+	has, err := r.BlobStore.Has(hash)
+	return !has, err
+}
+
+// Blocked forwards to the underlying store if it is a BlockedLister
+func (r *storeRef) Blocked() ([]string, error) {
+	if bl, ok := r.BlobStore.(BlockedLister); ok {
+		return bl.Blocked()
+	}
+	return nil, errors.Err(shared.ErrNotImplemented)
+}
+
+// HasBlobs forwards to the underlying store, checking the hashes one by one if it isn't a BatchChecker
+func (r *storeRef) HasBlobs(hashes []string) (map[string]bool, error) {
+	return HasBlobs(r.BlobStore, hashes)
+}
+
+// MissingBlobsForKnownStream forwards to the underlying store if it is a NeededBlobChecker
+func (r *storeRef) MissingBlobsForKnownStream(sdHash string) ([]string, error) {
+	if bc, ok := r.BlobStore.(NeededBlobChecker); ok {
+		return bc.MissingBlobsForKnownStream(sdHash)
+	}
+	return nil, errors.Err(shared.ErrNotImplemented)
+}
+
+// unwrap returns the referenced store
+func (r *storeRef) unwrap() BlobStore {
+	return r.BlobStore
+}
+
+// list forwards to the underlying store if it is a lister. Otherwise there is nothing to list.
+func (r *storeRef) list() ([]string, error) {
+	if l, ok := r.BlobStore.(lister); ok {
+		return l.list()
+	}
+	return nil, nil
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lbryio/reflector.go/shared"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func configFromYAML(t *testing.T, yaml string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(strings.NewReader(yaml)))
+	return v
+}
+
+// buildTree builds and commits a tree, like a reload that succeeds
+func buildTree(t *testing.T, b *Builder, config, named *viper.Viper) BlobStore {
+	tree, err := b.Build(config, named)
+	require.NoError(t, err)
+	tree.Commit()
+	return tree.Store
+}
+
+const cachingConfig = `
+caching:
+  name: %s
+  cache:
+    mem:
+      name: cache
+  origin:
+    mem:
+      name: origin
+`
+
+func TestBuilder_ReusesUnchangedStores(t *testing.T) {
+	b := NewBuilder()
+	first := buildTree(t, b, configFromYAML(t, fmt.Sprintf(cachingConfig, "first")), nil)
+
+	hash := "hash"
+	require.NoError(t, first.Put(hash, []byte("blob")))
+
+	// the caching store changed but its cache and origin did not, so they must be carried over
+	second := buildTree(t, b, configFromYAML(t, fmt.Sprintf(cachingConfig, "second")), nil)
+	first.Shutdown()
+
+	has, err := second.Has(hash)
+	require.NoError(t, err)
+	assert.True(t, has, "unchanged stores should keep their content across builds")
+
+	second.Shutdown()
+	third := buildTree(t, b, configFromYAML(t, fmt.Sprintf(cachingConfig, "second")), nil)
+	defer third.Shutdown()
+
+	has, err = third.Has(hash)
+	require.NoError(t, err)
+	assert.False(t, has, "stores that were shut down must not be reused")
+}
+
+func TestBuilder_SharesNamedStores(t *testing.T) {
+	named := configFromYAML(t, `
+shared_mem:
+  mem:
+    name: shared
+`)
+	root := configFromYAML(t, `
+ittt:
+  this:
+    ref: shared_mem
+  that:
+    ref: shared_mem
+`)
+	b := NewBuilder()
+	s := buildTree(t, b, root, named)
+
+	ittt := s.(*storeRef).BlobStore.(*ITTTStore)
+	this := ittt.this.(*storeRef)
+	that := ittt.that.(*storeRef)
+	assert.Same(t, this.rc, that.rc, "both references should share the same instance")
+	assert.Equal(t, 2, this.rc.refs)
+
+	this.Shutdown()
+	this.Shutdown() // releasing the same reference twice must not release the other one
+	assert.Equal(t, 1, that.rc.refs)
+	s.Shutdown()
+	assert.Equal(t, 0, that.rc.refs)
+}
+
+func TestBuilder_InvalidRefs(t *testing.T) {
+	named := configFromYAML(t, `
+loop:
+  singleflight:
+    store:
+      ref: loop
+`)
+	b := NewBuilder()
+	_, err := b.Build(configFromYAML(t, "ref: missing"), named)
+	assert.Error(t, err)
+	_, err = b.Build(configFromYAML(t, "ref: loop"), named)
+	assert.Error(t, err)
+}
+
+func TestBuilder_KeepsChildrenOfReusedStores(t *testing.T) {
+	b := NewBuilder()
+	first := buildTree(t, b, configFromYAML(t, fmt.Sprintf(cachingConfig, "first")), nil)
+	defer first.Shutdown()
+
+	hash := "hash"
+	require.NoError(t, first.Put(hash, []byte("blob")))
+
+	// nothing changed, so the whole tree is reused, and the next build must still know its cache and origin
+	second := buildTree(t, b, configFromYAML(t, fmt.Sprintf(cachingConfig, "first")), nil)
+	defer second.Shutdown()
+
+	third := buildTree(t, b, configFromYAML(t, fmt.Sprintf(cachingConfig, "third")), nil)
+	defer third.Shutdown()
+
+	has, err := third.Has(hash)
+	require.NoError(t, err)
+	assert.True(t, has, "the children of a reused store should be reused by the next build")
+}
+
+func TestBuilder_AbortKeepsLiveTree(t *testing.T) {
+	const config = `
+singleflight:
+  store:
+    mem:
+      name: %s
+`
+	b := NewBuilder()
+	first := buildTree(t, b, configFromYAML(t, fmt.Sprintf(config, "first")), nil)
+	defer first.Shutdown()
+	hash := "hash"
+	require.NoError(t, first.Put(hash, []byte("blob")))
+
+	// a tree that never went live must not change what the next build reuses
+	aborted, err := b.Build(configFromYAML(t, fmt.Sprintf(config, "second")), nil)
+	require.NoError(t, err)
+	aborted.Abort()
+
+	third := buildTree(t, b, configFromYAML(t, fmt.Sprintf(config, "first")), nil)
+	defer third.Shutdown()
+	has, err := third.Has(hash)
+	require.NoError(t, err)
+	assert.True(t, has, "the live tree should still be reused after an aborted build")
+}
+
+func TestNewStoreFromConfig(t *testing.T) {
+	// without a builder the stores are neither shared nor reused
+	s, err := NewStoreFromConfig(configFromYAML(t, fmt.Sprintf(cachingConfig, "plain")))
+	require.NoError(t, err)
+	defer s.Shutdown()
+	c, ok := s.(*CachingStore)
+	require.True(t, ok)
+	assert.IsType(t, &MemStore{}, c.cache.(unwrapper).unwrap())
+
+	_, err = NewStoreFromConfig(configFromYAML(t, "ref: shared_mem"))
+	assert.Error(t, err)
+}
+
+func TestReloadableStore_Swap(t *testing.T) {
+	first := NewMemStore(MemParams{Name: "first"})
+	second := NewMemStore(MemParams{Name: "second"})
+	require.NoError(t, second.Put("hash", []byte("blob")))
+
+	s := NewReloadableStore(first)
+	has, err := s.Has("hash")
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	s.Swap(second)
+	has, err = s.Has("hash")
+	require.NoError(t, err)
+	assert.True(t, has)
+	assert.Equal(t, second.Name(), s.Name())
+}
+
+func TestReloadableStore_Shutdown(t *testing.T) {
+	s := NewReloadableStore(NewMemStore(MemParams{Name: "mem"}))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				_, _ = s.Has("hash")
+			}
+		}()
+	}
+	// requests that race with the shutdown must not land on the generation it waits for
+	s.Shutdown()
+	wg.Wait()
+
+	_, err := s.Has("hash")
+	assert.True(t, errors.Is(err, ErrStoreShutDown))
+	s.Shutdown()
+}
+
+func TestReloadableStore_WithoutBlocklist(t *testing.T) {
+	mem := NewMemStore(MemParams{Name: "mem"})
+	require.NoError(t, mem.Put("stored", []byte("blob")))
+	s := NewReloadableStore(mem)
+
+	// a store without a blocklist blocks nothing, so it wants whatever it doesn't have
+	wants, err := s.Wants("stored")
+	require.NoError(t, err)
+	assert.False(t, wants)
+	wants, err = s.Wants("missing")
+	require.NoError(t, err)
+	assert.True(t, wants)
+
+	_, err = s.MissingBlobsForKnownStream("stored")
+	assert.True(t, errors.Is(err, shared.ErrNotImplemented))
+}
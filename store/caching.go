@@ -1,7 +1,6 @@
 package store
 
 import (
-	"strings"
 	"time"
 
 	"github.com/lbryio/reflector.go/internal/metrics"
@@ -45,7 +44,7 @@ func NewCachingStore(params CachingParams) *CachingStore {
 
 const nameCaching = "caching"
 
-func CachingStoreFactory(config *viper.Viper) (BlobStore, error) {
+func CachingStoreFactory(config *viper.Viper, newStore NewStoreFunc) (BlobStore, error) {
 	var cfg CachingConfig
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -57,25 +56,14 @@ func CachingStoreFactory(config *viper.Viper) (BlobStore, error) {
 		return nil, errors.Err("cache and origin missing")
 	}
 
-	originStoreType := strings.Split(cfg.Origin.AllKeys()[0], ".")[0]
-	originStoreConfig := cfg.Origin.Sub(originStoreType)
-	factory, ok := Factories[originStoreType]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", originStoreType)
-	}
-	originStore, err := factory(originStoreConfig)
+	originStore, err := newStore(cfg.Origin)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
 
-	cacheStoreType := strings.Split(cfg.Cache.AllKeys()[0], ".")[0]
-	cacheStoreConfig := cfg.Cache.Sub(cacheStoreType)
-	factory, ok = Factories[cacheStoreType]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", cacheStoreType)
-	}
-	cacheStore, err := factory(cacheStoreConfig)
+	cacheStore, err := newStore(cfg.Cache)
 	if err != nil {
+		originStore.Shutdown()
 		return nil, errors.Err(err)
 	}
 
@@ -102,6 +90,26 @@ func (c *CachingStore) Has(hash string) (bool, error) {
 	return c.origin.Has(hash)
 }
 
+// HasBlobs checks the cache and then the origin for the hashes the cache doesn't have
+func (c *CachingStore) HasBlobs(hashes []string) (map[string]bool, error) {
+	found, err := HasBlobs(c.cache, hashes)
+	if err != nil {
+		return nil, err
+	}
+	missing := missingFrom(hashes, found)
+	if len(missing) == 0 {
+		return found, nil
+	}
+	fromOrigin, err := HasBlobs(c.origin, missing)
+	if err != nil {
+		return nil, err
+	}
+	for hash, has := range fromOrigin {
+		found[hash] = has
+	}
+	return found, nil
+}
+
 // Get tries to get the blob from the cache first, falling back to the origin. If the blob comes
 // from the origin, it is also stored in the cache.
 func (c *CachingStore) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
@@ -132,6 +140,17 @@ func (c *CachingStore) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
 	return blob, trace.Stack(time.Since(start), c.Name()), nil
 }
 
+// Peek reads the blob from the cache, or from the origin without caching it
+func (c *CachingStore) Peek(hash string) (stream.Blob, shared.BlobTrace, error) {
+	start := time.Now()
+	blob, trace, err := Peek(c.cache, hash)
+	if err == nil || !errors.Is(err, ErrBlobNotFound) {
+		return blob, trace.Stack(time.Since(start), c.Name()), err
+	}
+	blob, trace, err = Peek(c.origin, hash)
+	return blob, trace.Stack(time.Since(start), c.Name()), err
+}
+
 // Put stores the blob in the origin and the cache
 func (c *CachingStore) Put(hash string, blob stream.Blob) error {
 	err := c.origin.Put(hash, blob)
@@ -159,6 +178,20 @@ func (c *CachingStore) Delete(hash string) error {
 	return c.cache.Delete(hash)
 }
 
+// Evict deletes the blob from the cache only
+func (c *CachingStore) Evict(hash string) error {
+	has, err := c.cache.Has(hash)
+	if err != nil || !has {
+		return err
+	}
+	return c.cache.Delete(hash)
+}
+
+// Underlying returns the origin and cache stores
+func (c *CachingStore) Underlying() []BlobStore {
+	return []BlobStore{c.origin, c.cache}
+}
+
 // Shutdown shuts down the store gracefully
 func (c *CachingStore) Shutdown() {
 	c.origin.Shutdown()
@@ -1,9 +1,9 @@
 package store
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
@@ -21,14 +21,18 @@ import (
 
 // DBBackedStore is a store that's backed by a DB. The DB contains data about what's in the store.
 type DBBackedStore struct {
-	blobs        BlobStore
-	db           *db.SQL
-	blocked      map[string]bool
-	cleanerStop  *stop.Group
-	name         string
-	maxSize      int
-	blockedMu    sync.RWMutex
-	deleteOnMiss bool
+	blobs       BlobStore
+	db          *db.SQL
+	blocked     map[string]bool
+	cleanerStop *stop.Group
+	name        string
+	maxSize     int
+	blockedMu   sync.RWMutex
+	// blockedLoadedAt is when blocked was last loaded from the db
+	blockedLoadedAt time.Time
+	deleteOnMiss    bool
+	// cleanMu keeps the periodic cleanup and the ones requested through Clean from running at the same time
+	cleanMu sync.Mutex
 }
 
 type DBBackedParams struct {
@@ -81,6 +85,11 @@ func (d *DBBackedStore) Has(hash string) (bool, error) {
 	return d.db.HasBlob(hash, false)
 }
 
+// HasBlobs checks which of the blobs are in the store with a single query
+func (d *DBBackedStore) HasBlobs(hashes []string) (map[string]bool, error) {
+	return d.db.HasBlobs(hashes, false)
+}
+
 // Get gets the blob
 func (d *DBBackedStore) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
 	start := time.Now()
@@ -103,6 +112,20 @@ func (d *DBBackedStore) Get(hash string) (stream.Blob, shared.BlobTrace, error)
 	return b, stack.Stack(time.Since(start), d.Name()), err
 }
 
+// Peek reads the blob without touching its access time or deleting it from the db if it is missing
+func (d *DBBackedStore) Peek(hash string) (stream.Blob, shared.BlobTrace, error) {
+	start := time.Now()
+	has, err := d.db.HasBlob(hash, false)
+	if err != nil {
+		return nil, shared.NewBlobTrace(time.Since(start), d.Name()), err
+	}
+	if !has {
+		return nil, shared.NewBlobTrace(time.Since(start), d.Name()), ErrBlobNotFound
+	}
+	b, stack, err := Peek(d.blobs, hash)
+	return b, stack.Stack(time.Since(start), d.Name()), err
+}
+
 // Put stores the blob in the S3 store and stores the blob information in the DB.
 func (d *DBBackedStore) Put(hash string, blob stream.Blob) error {
 	err := d.blobs.Put(hash, blob)
@@ -116,6 +139,7 @@ func (d *DBBackedStore) Put(hash string, blob stream.Blob) error {
 // PutSD stores the SDBlob in the S3 store. It will return an error if the sd blob is missing the stream hash or if
 // there is an error storing the blob information in the DB.
 func (d *DBBackedStore) PutSD(hash string, blob stream.Blob) error {
+	// sd blobs are fully validated when they are received, so they are only parsed here
 	var blobContents db.SdBlob
 	err := json.Unmarshal(blob, &blobContents)
 	if err != nil {
@@ -142,21 +166,121 @@ func (d *DBBackedStore) Delete(hash string) error {
 	return d.db.Delete(hash)
 }
 
-// Block deletes the blob and prevents it from being uploaded in the future
-func (d *DBBackedStore) Block(hash string) error {
+// Block deletes the blob and prevents it from being uploaded in the future. If the blob is an sd blob, the content
+// blobs of its stream are blocked and deleted too, unless they are also part of a stream that is not blocked.
+// The sd hash is blocked last: deleting the sd blob forgets the stream, so a block that fails halfway has to be
+// retried while the content blobs can still be found.
+func (d *DBBackedStore) Block(hash string, info BlockInfo) error {
 	blocked, err := d.isBlocked(hash)
-	if blocked || err != nil {
+	if err != nil {
 		return err
 	}
 
+	// the stream has to be resolved first, deleting the sd blob deletes the stream from the db. The sd blob of
+	// a blocked hash was deleted when it was blocked, so only the db can still know content blobs to block.
+	var contentBlobs []string
+	if blocked {
+		contentBlobs, err = d.db.StreamBlobs(hash)
+	} else {
+		contentBlobs, err = d.streamBlobs(hash)
+	}
+	if err != nil {
+		return err
+	}
+	var unblocked []string
+	for _, blobHash := range contentBlobs {
+		b, err := d.isBlocked(blobHash)
+		if err != nil {
+			return err
+		}
+		if !b {
+			unblocked = append(unblocked, blobHash)
+		}
+	}
+	if blocked && len(unblocked) == 0 {
+		return nil
+	}
+
 	log.Debugf("blocking %s", hash)
 
-	err = d.db.Block(hash)
+	unshared, err := d.db.UnsharedBlobs(hash, unblocked)
+	if err != nil {
+		return err
+	}
+	log.Debugf("blocking %d of %d content blobs of %s", len(unshared), len(contentBlobs), hash)
+	for _, blobHash := range unshared {
+		err = d.block(db.BlockRecord{Hash: blobHash, Reason: info.Reason, Source: info.Source, StreamSdHash: hash})
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.block(db.BlockRecord{Hash: hash, Reason: info.Reason, Source: info.Source})
+}
+
+// block marks a single blob as blocked and deletes it
+func (d *DBBackedStore) block(record db.BlockRecord) error {
+	err := d.db.Block(record)
+	if err != nil {
+		return err
+	}
+
+	err = d.markBlocked(record.Hash)
+	if err != nil {
+		return err
+	}
+
+	return d.Delete(record.Hash)
+}
+
+// Unblock allows the blob to be uploaded again. Unblocking an sd hash also unblocks the content blobs that
+// were blocked along with it. Deleted blobs are not restored, they have to be uploaded again.
+func (d *DBBackedStore) Unblock(hash string, info BlockInfo) error {
+	unblocked, err := d.db.Unblock(hash, info.Reason, info.Source)
 	if err != nil {
 		return err
 	}
+	log.Debugf("unblocked %d blobs for %s", len(unblocked), hash)
 
-	return d.markBlocked(hash)
+	err = d.initBlocked()
+	if err != nil {
+		return err
+	}
+
+	d.blockedMu.Lock()
+	defer d.blockedMu.Unlock()
+	for _, h := range unblocked {
+		delete(d.blocked, h)
+	}
+	return nil
+}
+
+// streamBlobs returns the content blobs of the stream with the given sd hash. Streams unknown to the db are
+// resolved by parsing the sd blob. It returns nothing if the blob is not stored or is not an sd blob.
+func (d *DBBackedStore) streamBlobs(sdHash string) ([]string, error) {
+	hashes, err := d.db.StreamBlobs(sdHash)
+	if err != nil || len(hashes) > 0 {
+		return hashes, err
+	}
+
+	blob, _, err := d.blobs.Get(sdHash)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sd stream.SDBlob
+	err = sd.FromBlob(blob)
+	if err != nil {
+		return nil, nil
+	}
+	for _, info := range sd.BlobInfos {
+		if info.Length > 0 {
+			hashes = append(hashes, hex.EncodeToString(info.BlobHash))
+		}
+	}
+	return hashes, nil
 }
 
 // Wants returns false if the hash exists or is blocked, true otherwise
@@ -177,6 +301,21 @@ func (d *DBBackedStore) MissingBlobsForKnownStream(sdHash string) ([]string, err
 	return d.db.MissingBlobsForKnownStream(sdHash)
 }
 
+// Blocked returns every blocked hash
+func (d *DBBackedStore) Blocked() ([]string, error) {
+	err := d.initBlocked()
+	if err != nil {
+		return nil, err
+	}
+	d.blockedMu.RLock()
+	defer d.blockedMu.RUnlock()
+	hashes := make([]string, 0, len(d.blocked))
+	for hash := range d.blocked {
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
 func (d *DBBackedStore) markBlocked(hash string) error {
 	err := d.initBlocked()
 	if err != nil {
@@ -202,9 +341,16 @@ func (d *DBBackedStore) isBlocked(hash string) (bool, error) {
 	return d.blocked[hash], nil
 }
 
+// blockedRefreshInterval is how often the blocked hashes are reloaded from the db, so blocks and unblocks made
+// by other processes (e.g. the blocklist command) are picked up
+const blockedRefreshInterval = 5 * time.Minute
+
 func (d *DBBackedStore) initBlocked() error {
 	// first check without blocking since this is the most likely scenario
-	if d.blocked != nil {
+	d.blockedMu.RLock()
+	fresh := d.blocked != nil && time.Since(d.blockedLoadedAt) < blockedRefreshInterval
+	d.blockedMu.RUnlock()
+	if fresh {
 		return nil
 	}
 
@@ -212,14 +358,22 @@ func (d *DBBackedStore) initBlocked() error {
 	defer d.blockedMu.Unlock()
 
 	// check again in case of race condition
-	if d.blocked != nil {
+	if d.blocked != nil && time.Since(d.blockedLoadedAt) < blockedRefreshInterval {
 		return nil
 	}
 
-	var err error
-	d.blocked, err = d.db.GetBlocked()
-
-	return err
+	blocked, err := d.db.GetBlocked()
+	if err != nil {
+		if d.blocked != nil {
+			// keep using the hashes we have, they are only a few minutes old
+			log.Errorln(errors.Prefix("refreshing blocked hashes", err))
+			return nil
+		}
+		return err
+	}
+	d.blocked = blocked
+	d.blockedLoadedAt = time.Now()
+	return nil
 }
 
 // cleanOldestBlobs periodically cleans up the oldest blobs if maxSize is set
@@ -246,6 +400,9 @@ func (d *DBBackedStore) cleanOldestBlobs() {
 
 // doClean removes the least recently accessed blobs if the store exceeds maxItems
 func (d *DBBackedStore) doClean() error {
+	d.cleanMu.Lock()
+	defer d.cleanMu.Unlock()
+
 	blobsCount, err := d.db.Count()
 	if err != nil {
 		return err
@@ -293,13 +450,32 @@ func (d *DBBackedStore) doClean() error {
 	return nil
 }
 
+// Underlying returns the store holding the blobs
+func (d *DBBackedStore) Underlying() []BlobStore {
+	return []BlobStore{d.blobs}
+}
+
+// Size returns the number of blobs tracked in the db and the configured max size (0 if unbounded)
+func (d *DBBackedStore) Size() (int, int, error) {
+	count, err := d.db.Count()
+	return count, d.maxSize, err
+}
+
+// Clean runs the cleanup that normally happens every 10 minutes. It does nothing if the store has no max size.
+func (d *DBBackedStore) Clean() error {
+	if d.maxSize <= 0 {
+		return nil
+	}
+	return d.doClean()
+}
+
 // Shutdown shuts down the store gracefully
 func (d *DBBackedStore) Shutdown() {
 	d.cleanerStop.Stop()
 	d.blobs.Shutdown()
 }
 
-func DBBackedStoreFactory(config *viper.Viper) (BlobStore, error) {
+func DBBackedStoreFactory(config *viper.Viper, newStore NewStoreFunc) (BlobStore, error) {
 	var cfg DBBackedConfig
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -308,13 +484,7 @@ func DBBackedStoreFactory(config *viper.Viper) (BlobStore, error) {
 
 	cfg.Store = config.Sub("store")
 
-	storeType := strings.Split(cfg.Store.AllKeys()[0], ".")[0]
-	storeConfig := cfg.Store.Sub(storeType)
-	factory, ok := Factories[storeType]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", storeType)
-	}
-	underlyingStore, err := factory(storeConfig)
+	underlyingStore, err := newStore(cfg.Store)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
@@ -327,6 +497,7 @@ func DBBackedStoreFactory(config *viper.Viper) (BlobStore, error) {
 
 	err = parsedDb.Connect(fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database))
 	if err != nil {
+		underlyingStore.Shutdown()
 		return nil, err
 	}
 	params := DBBackedParams{
@@ -339,6 +510,7 @@ func DBBackedStoreFactory(config *viper.Viper) (BlobStore, error) {
 		var parsedSize datasize.ByteSize
 		err = parsedSize.UnmarshalText([]byte(cfg.MaxSize))
 		if err != nil {
+			underlyingStore.Shutdown()
 			return nil, errors.Err(err)
 		}
 		maxSize := int(float64(parsedSize) / float64(stream.MaxBlobSize))
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/lbryio/reflector.go/db"
+
+	"github.com/lbryio/lbry.go/v2/stream"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockDBBackedStore(t *testing.T, blocked ...string) (*DBBackedStore, *MemStore, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	sql := &db.SQL{SoftDelete: true}
+	sql.SetConnection(conn)
+
+	rows := sqlmock.NewRows([]string{"hash"})
+	for _, hash := range blocked {
+		rows.AddRow(hash)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT hash FROM blocked")).WillReturnRows(rows)
+
+	mem := NewMemStore(MemParams{Name: "mem"})
+	return NewDBBackedStore(DBBackedParams{Store: mem, DB: sql, Name: "test"}), mem, mock
+}
+
+func expectStreamBlobs(mock sqlmock.Sqlmock, sdHash string, hashes ...string) {
+	rows := sqlmock.NewRows([]string{"hash"})
+	for _, hash := range hashes {
+		rows.AddRow(hash)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("INNER JOIN blob_ sdb ON sdb.id = s.sd_blob_id AND sdb.hash = ?")).WithArgs(sdHash).WillReturnRows(rows)
+}
+
+func expectSharedBlobs(mock sqlmock.Sqlmock, hashes ...string) {
+	rows := sqlmock.NewRows([]string{"hash"})
+	for _, hash := range hashes {
+		rows.AddRow(hash)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("LEFT JOIN blocked bl ON bl.hash = sdb.hash")).WillReturnRows(rows)
+}
+
+func expectBlock(mock sqlmock.Sqlmock, hash string) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO blocked")).WithArgs(hash, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO blocked_history")).WithArgs(hash, "block", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE blob_ SET is_stored = 0")).WithArgs(hash).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestDBBackedStore_Block(t *testing.T) {
+	d, mem, mock := newMockDBBackedStore(t)
+	for _, hash := range []string{"sd", "a", "b"} {
+		require.NoError(t, mem.Put(hash, []byte(hash)))
+	}
+
+	// b is part of another stream, so only a is blocked along with the stream, and the sd hash comes last
+	expectStreamBlobs(mock, "sd", "a", "b")
+	expectSharedBlobs(mock, "b")
+	expectBlock(mock, "a")
+	expectBlock(mock, "sd")
+	require.NoError(t, d.Block("sd", BlockInfo{Reason: "test", Source: "test"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	for hash, blocked := range map[string]bool{"sd": true, "a": true, "b": false} {
+		has, err := mem.Has(hash)
+		require.NoError(t, err)
+		assert.Equal(t, !blocked, has, hash)
+	}
+	wants, err := d.Wants("sd")
+	require.NoError(t, err)
+	assert.False(t, wants)
+	wants, err = d.Wants("a")
+	require.NoError(t, err)
+	assert.False(t, wants)
+
+	// the stream is gone and the sd hash is blocked, so there is nothing left to do
+	expectStreamBlobs(mock, "sd")
+	require.NoError(t, d.Block("sd", BlockInfo{Reason: "test", Source: "test"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// blobs that aren't blocked are wanted unless they are stored
+	mock.ExpectQuery(regexp.QuoteMeta("FROM blob_ b")).WithArgs("c").WillReturnRows(sqlmock.NewRows([]string{"hash", "id", "stream_id", "last_accessed_at"}))
+	wants, err = d.Wants("c")
+	require.NoError(t, err)
+	assert.True(t, wants)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBBackedStore_BlockRetry(t *testing.T) {
+	d, _, mock := newMockDBBackedStore(t)
+
+	expectStreamBlobs(mock, "sd", "a", "b")
+	expectSharedBlobs(mock)
+	expectBlock(mock, "a")
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO blocked")).WithArgs("b", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+	assert.Error(t, d.Block("sd", BlockInfo{}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// the sd hash was not blocked, so the retry finds the stream again and finishes the block
+	expectStreamBlobs(mock, "sd", "a", "b")
+	expectSharedBlobs(mock)
+	expectBlock(mock, "b")
+	expectBlock(mock, "sd")
+	require.NoError(t, d.Block("sd", BlockInfo{}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBBackedStore_BlockCompletesOldBlocks(t *testing.T) {
+	// the sd hash was blocked without its content blobs
+	d, _, mock := newMockDBBackedStore(t, "sd")
+
+	expectStreamBlobs(mock, "sd", "a")
+	expectSharedBlobs(mock)
+	expectBlock(mock, "a")
+	expectBlock(mock, "sd")
+	require.NoError(t, d.Block("sd", BlockInfo{}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDBBackedStore_BlockSkipsBlockedStreams(t *testing.T) {
+	d, mem, mock := newMockDBBackedStore(t, "sd")
+	// the blob store is not asked for the sd blob of a blocked hash, even if it still has it
+	sd := stream.SDBlob{BlobInfos: []stream.BlobInfo{{Length: 10, BlobHash: make([]byte, stream.BlobHashSize)}}}
+	require.NoError(t, mem.Put("sd", sd.ToBlob()))
+
+	expectStreamBlobs(mock, "sd")
+	require.NoError(t, d.Block("sd", BlockInfo{}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
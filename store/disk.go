@@ -39,7 +39,7 @@ func NewDiskStore(params DiskParams) *DiskStore {
 
 const nameDisk = "disk"
 
-func DiskStoreFactory(config *viper.Viper) (BlobStore, error) {
+func DiskStoreFactory(config *viper.Viper, _ NewStoreFunc) (BlobStore, error) {
 	var cfg DiskParams
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -1,7 +1,6 @@
 package store
 
 import (
-	"strings"
 	"time"
 
 	"github.com/lbryio/reflector.go/internal/metrics"
@@ -20,6 +19,7 @@ type GcacheStore struct {
 	underlyingStore BlobStore
 	cache           gcache.Cache
 	name            string
+	maxSize         int
 }
 
 type EvictionStrategy int
@@ -72,6 +72,7 @@ func NewGcacheStore(params GcacheParams) *GcacheStore {
 		underlyingStore: params.Store,
 		cache:           cache,
 		name:            params.Name,
+		maxSize:         params.MaxSize,
 	}
 	go func() {
 		if lstr, ok := params.Store.(lister); ok {
@@ -87,7 +88,7 @@ func NewGcacheStore(params GcacheParams) *GcacheStore {
 
 const nameGcache = "gcache"
 
-func GcacheStoreFactory(config *viper.Viper) (BlobStore, error) {
+func GcacheStoreFactory(config *viper.Viper, newStore NewStoreFunc) (BlobStore, error) {
 	var cfg GcacheConfig
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -96,13 +97,7 @@ func GcacheStoreFactory(config *viper.Viper) (BlobStore, error) {
 
 	cfg.Store = config.Sub("store")
 
-	storeType := strings.Split(cfg.Store.AllKeys()[0], ".")[0]
-	storeConfig := cfg.Store.Sub(storeType)
-	factory, ok := Factories[storeType]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", storeType)
-	}
-	underlyingStore, err := factory(storeConfig)
+	underlyingStore, err := newStore(cfg.Store)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
@@ -142,6 +137,16 @@ func (l *GcacheStore) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
 	return blob, stack.Stack(time.Since(start), l.Name()), err
 }
 
+// Peek reads the blob from the underlying store without counting it as an access
+func (l *GcacheStore) Peek(hash string) (stream.Blob, shared.BlobTrace, error) {
+	start := time.Now()
+	if !l.cache.Has(hash) {
+		return nil, shared.NewBlobTrace(time.Since(start), l.Name()), errors.Err(ErrBlobNotFound)
+	}
+	blob, stack, err := Peek(l.underlyingStore, hash)
+	return blob, stack.Stack(time.Since(start), l.Name()), err
+}
+
 // Put stores the blob. Following LFUDA rules it's not guaranteed that a SET will store the value!!!
 func (l *GcacheStore) Put(hash string, blob stream.Blob) error {
 	_ = l.cache.Set(hash, true)
@@ -206,6 +211,16 @@ func (l *GcacheStore) loadExisting(store lister, maxItems int) error {
 	return nil
 }
 
+// Underlying returns the store the cache is built on
+func (l *GcacheStore) Underlying() []BlobStore {
+	return []BlobStore{l.underlyingStore}
+}
+
+// Size returns the number of cached blobs and the cache size limit
+func (l *GcacheStore) Size() (int, int, error) {
+	return l.cache.Len(false), l.maxSize, nil
+}
+
 // Shutdown shuts down the store gracefully
 func (l *GcacheStore) Shutdown() {
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/lbryio/reflector.go/internal/metrics"
 	"github.com/lbryio/reflector.go/meta"
 	"github.com/lbryio/reflector.go/shared"
+	"github.com/lbryio/reflector.go/tlsconfig"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
 	"github.com/lbryio/lbry.go/v2/stream"
@@ -30,13 +31,15 @@ type HttpParams struct {
 	Name         string `mapstructure:"name"`
 	Endpoint     string `mapstructure:"endpoint"`
 	ShardingSize int    `mapstructure:"sharding_size"`
+	// TLS verifies the certificate of an https endpoint as configured, instead of with the system roots
+	TLS *tlsconfig.ClientConfig `mapstructure:"tls"`
 }
 
 // NewHttpStore returns an initialized HttpStore store pointer.
 func NewHttpStore(params HttpParams) *HttpStore {
 	return &HttpStore{
 		endpoint:     params.Endpoint,
-		httpClient:   getClient(),
+		httpClient:   getClient(params.TLS.TLSConfig()),
 		prefixLength: params.ShardingSize,
 		name:         params.Name,
 	}
@@ -44,12 +47,16 @@ func NewHttpStore(params HttpParams) *HttpStore {
 
 const nameHttp = "http"
 
-func HttpStoreFactory(config *viper.Viper) (BlobStore, error) {
+func HttpStoreFactory(config *viper.Viper, _ NewStoreFunc) (BlobStore, error) {
 	var cfg HttpParams
 	err := config.Unmarshal(&cfg)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
+	err = cfg.TLS.Validate()
+	if err != nil {
+		return nil, err
+	}
 	return NewHttpStore(cfg), nil
 }
 
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/lbryio/reflector.go/shared"
+	"github.com/lbryio/reflector.go/tlsconfig"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
 	"github.com/lbryio/lbry.go/v2/stream"
@@ -21,6 +22,7 @@ type Http3Store struct {
 	name          string
 	address       string
 	timeout       time.Duration
+	tls           *tlsconfig.ClientConfig
 	clientMu      sync.RWMutex
 }
 
@@ -29,6 +31,8 @@ type Http3Params struct {
 	Name    string        `mapstructure:"name"`
 	Address string        `mapstructure:"address"`
 	Timeout time.Duration `mapstructure:"timeout"`
+	// TLS verifies the certificate of the peer. Without it, the certificate is not verified.
+	TLS *tlsconfig.ClientConfig `mapstructure:"tls"`
 }
 
 // NewHttp3Store makes a new HTTP3 store.
@@ -38,17 +42,22 @@ func NewHttp3Store(params Http3Params) *Http3Store {
 		NotFoundCache: &sync.Map{},
 		address:       params.Address,
 		timeout:       params.Timeout,
+		tls:           params.TLS,
 	}
 }
 
 const nameHttp3 = "http3"
 
-func Http3StoreFactory(config *viper.Viper) (BlobStore, error) {
+func Http3StoreFactory(config *viper.Viper, _ NewStoreFunc) (BlobStore, error) {
 	var cfg Http3Params
 	err := config.Unmarshal(&cfg)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
+	err = cfg.TLS.Validate()
+	if err != nil {
+		return nil, err
+	}
 	return NewHttp3Store(cfg), nil
 }
 
@@ -75,7 +84,7 @@ func (h *Http3Store) getClient() (*Http3Client, error) {
 		return h.client, nil
 	}
 
-	client, err := NewHttp3Client(h.address)
+	client, err := NewHttp3Client(h.address, h.tls.TLSConfig())
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +101,15 @@ func (h *Http3Store) Has(hash string) (bool, error) {
 	return c.HasBlob(hash)
 }
 
+// HasBlobs asks the peer which of the hashes it has
+func (h *Http3Store) HasBlobs(hashes []string) (map[string]bool, error) {
+	c, err := h.getClient()
+	if err != nil {
+		return nil, err
+	}
+	return c.HasBlobs(hashes)
+}
+
 // Get downloads the blob from the peer
 func (h *Http3Store) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
 	start := time.Now()
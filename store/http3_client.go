@@ -23,8 +23,8 @@ type Http3Client struct {
 	ServerAddr   string
 }
 
-// NewHttp3Client creates a new HTTP3 client
-func NewHttp3Client(address string) (*Http3Client, error) {
+// NewHttp3Client creates a new HTTP3 client. If tlsConfig is nil, the certificate of the server is not verified.
+func NewHttp3Client(address string, tlsConfig *tls.Config) (*Http3Client, error) {
 	var qconf quic.Config
 	window500M := 500 * 1 << 20
 	qconf.MaxStreamReceiveWindow = uint64(window500M)
@@ -32,16 +32,19 @@ func NewHttp3Client(address string) (*Http3Client, error) {
 	qconf.EnableDatagrams = true
 	qconf.HandshakeIdleTimeout = 4 * time.Second
 	qconf.MaxIdleTimeout = 20 * time.Second
-	pool, err := x509.SystemCertPool()
-	if err != nil {
-		return nil, err
-	}
-	roundTripper := &http3.Transport{
-		TLSClientConfig: &tls.Config{
+	if tlsConfig == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{
 			RootCAs:            pool,
 			InsecureSkipVerify: true,
-		},
-		QUICConfig: &qconf,
+		}
+	}
+	roundTripper := &http3.Transport{
+		TLSClientConfig: tlsConfig,
+		QUICConfig:      &qconf,
 	}
 	connection := &http.Client{
 		Transport: roundTripper,
@@ -84,6 +87,16 @@ func (c *Http3Client) HasBlob(hash string) (bool, error) {
 	return false, errors.Err("upstream error. Status code: %d (%s)", res.StatusCode, string(body))
 }
 
+// HasBlobs asks the peer which of the hashes it has with a single request per batch, falling back to one
+// request per hash if the peer doesn't support batches
+func (c *Http3Client) HasBlobs(hashes []string) (map[string]bool, error) {
+	found, err := postHas(c.conn, c.ServerAddr, hashes)
+	if errors.Is(err, errBatchUnsupported) {
+		return hasEach(c.HasBlob, hashes)
+	}
+	return found, err
+}
+
 // GetBlob gets a blob from the peer
 func (c *Http3Client) GetBlob(hash string) (stream.Blob, shared.BlobTrace, error) {
 	start := time.Now()
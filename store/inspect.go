@@ -0,0 +1,114 @@
+package store
+
+import (
+	"github.com/lbryio/reflector.go/shared"
+
+	"github.com/lbryio/lbry.go/v2/stream"
+)
+
+// Wrapper is a store that serves blobs from other stores. It lets tools inspect the store tree.
+type Wrapper interface {
+	// Underlying returns the stores this store is built on
+	Underlying() []BlobStore
+}
+
+// Sizer is a store that knows how many blobs it holds
+type Sizer interface {
+	// Size returns the number of blobs in the store and the maximum it will hold (0 if unbounded)
+	Size() (count int, capacity int, err error)
+}
+
+// Cleaner is a store that evicts blobs to stay within its size limit
+type Cleaner interface {
+	// Clean evicts the least recently accessed blobs if the store is over its size limit
+	Clean() error
+}
+
+// Evicter is a store that keeps local copies of blobs from an origin
+type Evicter interface {
+	// Evict removes the blob from the local copies only. The origin is left untouched.
+	Evict(hash string) error
+}
+
+// Peeker is a store that can read a blob without side effects, such as copying it into its caches or
+// counting the read as an access
+type Peeker interface {
+	// Peek gets the blob like Get does, but leaves the store as it was
+	Peek(hash string) (stream.Blob, shared.BlobTrace, error)
+}
+
+// Peek reads the blob from s without side effects wherever the stores allow it. Stores that aren't Peekers are read with Get.
+func Peek(s BlobStore, hash string) (stream.Blob, shared.BlobTrace, error) {
+	for {
+		if p, ok := s.(Peeker); ok {
+			return p.Peek(hash)
+		}
+		u, ok := s.(unwrapper)
+		if !ok {
+			return s.Get(hash)
+		}
+		s = u.unwrap()
+	}
+}
+
+// CanBlock returns true if s supports blocking. References, reloadable stores and proxied S3 stores implement
+// Blocklister whatever store they forward to, and only fail when it is used, so the store they forward to is
+// checked instead.
+func CanBlock(s BlobStore) bool {
+	for {
+		switch w := s.(type) {
+		case *storeRef:
+			s = w.BlobStore
+		case *ReloadableStore:
+			held, release := w.hold()
+			defer release()
+			s = held
+		case *ProxiedS3Store:
+			s = w.writerStore
+		default:
+			_, ok := s.(Blocklister)
+			return ok
+		}
+	}
+}
+
+// holder is implemented by wrappers whose store can be replaced and shut down at any time (reloadable stores).
+// The store returned by hold is not shut down until release is called.
+type holder interface {
+	hold() (s BlobStore, release func())
+}
+
+// unwrapper is implemented by the plumbing wrappers (references, reloadable stores) that are not part of
+// the configured topology. Walk looks through them.
+type unwrapper interface {
+	unwrap() BlobStore
+}
+
+// Walk calls fn for s and every store beneath it, depth first. depth is 0 for s.
+// Stores shared by several parents are visited once per parent. The stores are not shut down by a reload
+// until Walk returns, so fn may use them.
+func Walk(s BlobStore, fn func(s BlobStore, depth int)) {
+	walk(s, 0, fn)
+}
+
+func walk(s BlobStore, depth int, fn func(s BlobStore, depth int)) {
+	for {
+		if h, ok := s.(holder); ok {
+			held, release := h.hold()
+			defer release()
+			s = held
+			continue
+		}
+		u, ok := s.(unwrapper)
+		if !ok {
+			break
+		}
+		s = u.unwrap()
+	}
+	fn(s, depth)
+	if w, ok := s.(Wrapper); ok {
+		for _, child := range w.Underlying() {
+			walk(child, depth+1, fn)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalk(t *testing.T) {
+	r := NewReloadableStore(buildTree(t, NewBuilder(), configFromYAML(t, fmt.Sprintf(cachingConfig, "root")), nil))
+	defer r.Shutdown()
+
+	var topology []string
+	Walk(r, func(s BlobStore, depth int) {
+		topology = append(topology, strings.Repeat(" ", depth)+s.Name())
+	})
+	// references, the reloadable store and singleflight are plumbing and must not show up
+	assert.Equal(t, []string{"caching", " mem-origin", " mem-cache"}, topology)
+}
+
+func TestPeek(t *testing.T) {
+	origin := NewMemStore(MemParams{Name: "origin"})
+	cache := NewMemStore(MemParams{Name: "cache"})
+	require.NoError(t, origin.Put("hash", []byte("blob")))
+	r := NewReloadableStore(NewCachingStore(CachingParams{Name: "caching", Origin: origin, Cache: cache}))
+
+	blob, trace, err := Peek(r, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("blob"), []byte(blob))
+	assert.Contains(t, trace.String(), "mem-origin")
+	has, err := cache.Has("hash")
+	require.NoError(t, err)
+	assert.False(t, has, "peeking must not cache the blob")
+
+	_, _, err = Peek(r, "missing")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
+
+func TestCanBlock(t *testing.T) {
+	mem := NewMemStore(MemParams{Name: "mem"})
+	db := NewDBBackedStore(DBBackedParams{Store: mem, Name: "db"})
+	assert.True(t, CanBlock(db))
+	assert.True(t, CanBlock(NewReloadableStore(&storeRef{BlobStore: db})))
+	assert.True(t, CanBlock(NewProxiedS3Store(ProxiedS3Params{Reader: mem, Writer: db})))
+
+	// the wrappers implement Blocklister, but the store they forward to can't block
+	assert.False(t, CanBlock(NewReloadableStore(&storeRef{BlobStore: mem})))
+	assert.False(t, CanBlock(NewProxiedS3Store(ProxiedS3Params{Reader: mem, Writer: mem})))
+	assert.False(t, CanBlock(WithSingleFlight("test", db)), "singleflight doesn't forward blocks")
+}
+
+type shutdownRecorder struct {
+	*MemStore
+	shutdown chan struct{}
+}
+
+func (s *shutdownRecorder) Shutdown() { close(s.shutdown) }
+
+func TestWalk_HoldsReloadedStores(t *testing.T) {
+	old := &shutdownRecorder{MemStore: NewMemStore(MemParams{Name: "old"}), shutdown: make(chan struct{})}
+	r := NewReloadableStore(old)
+
+	Walk(r, func(s BlobStore, depth int) {
+		r.Swap(NewMemStore(MemParams{Name: "new"}))
+		select {
+		case <-old.shutdown:
+			t.Error("the store was shut down while it was being walked")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+	select {
+	case <-old.shutdown:
+	case <-time.After(time.Second):
+		t.Error("the old store was not shut down after the walk")
+	}
+}
@@ -1,7 +1,6 @@
 package store
 
 import (
-	"strings"
 	"time"
 
 	"github.com/lbryio/reflector.go/internal/metrics"
@@ -42,7 +41,7 @@ func NewITTTStore(params ITTTParams) *ITTTStore {
 
 const nameIttt = "ittt"
 
-func ITTTStoreFactory(config *viper.Viper) (BlobStore, error) {
+func ITTTStoreFactory(config *viper.Viper, newStore NewStoreFunc) (BlobStore, error) {
 	var cfg ITTTConfig
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -52,25 +51,14 @@ func ITTTStoreFactory(config *viper.Viper) (BlobStore, error) {
 	cfg.This = config.Sub("this")
 	cfg.That = config.Sub("that")
 
-	thisStoreType := strings.Split(cfg.This.AllKeys()[0], ".")[0]
-	thisStoreConfig := cfg.This.Sub(thisStoreType)
-	factory, ok := Factories[thisStoreType]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", thisStoreType)
-	}
-	thisStore, err := factory(thisStoreConfig)
+	thisStore, err := newStore(cfg.This)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
 
-	thatStoreType := strings.Split(cfg.That.AllKeys()[0], ".")[0]
-	thatStoreConfig := cfg.That.Sub(thatStoreType)
-	factory, ok = Factories[thatStoreType]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", thatStoreType)
-	}
-	thatStore, err := factory(thatStoreConfig)
+	thatStore, err := newStore(cfg.That)
 	if err != nil {
+		thisStore.Shutdown()
 		return nil, errors.Err(err)
 	}
 
@@ -97,6 +85,26 @@ func (c *ITTTStore) Has(hash string) (bool, error) {
 	return has, err
 }
 
+// HasBlobs checks this and then that for the hashes this doesn't have
+func (c *ITTTStore) HasBlobs(hashes []string) (map[string]bool, error) {
+	found, err := HasBlobs(c.this, hashes)
+	if err != nil {
+		return HasBlobs(c.that, hashes)
+	}
+	missing := missingFrom(hashes, found)
+	if len(missing) == 0 {
+		return found, nil
+	}
+	fromThat, err := HasBlobs(c.that, missing)
+	if err != nil {
+		return nil, err
+	}
+	for hash, has := range fromThat {
+		found[hash] = has
+	}
+	return found, nil
+}
+
 // Get tries to get the blob from this first, falling back to that.
 func (c *ITTTStore) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
 	start := time.Now()
@@ -114,6 +122,17 @@ func (c *ITTTStore) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
 	return blob, trace.Stack(time.Since(start), c.Name()), nil
 }
 
+// Peek reads the blob from this store, then from that store, without side effects
+func (c *ITTTStore) Peek(hash string) (stream.Blob, shared.BlobTrace, error) {
+	start := time.Now()
+	blob, trace, err := Peek(c.this, hash)
+	if err == nil {
+		return blob, trace.Stack(time.Since(start), c.Name()), nil
+	}
+	blob, trace, err = Peek(c.that, hash)
+	return blob, trace.Stack(time.Since(start), c.Name()), err
+}
+
 // Put not implemented
 func (c *ITTTStore) Put(hash string, blob stream.Blob) error {
 	return errors.Err(shared.ErrNotImplemented)
@@ -129,6 +148,11 @@ func (c *ITTTStore) Delete(hash string) error {
 	return errors.Err(shared.ErrNotImplemented)
 }
 
+// Underlying returns the this and that stores
+func (c *ITTTStore) Underlying() []BlobStore {
+	return []BlobStore{c.this, c.that}
+}
+
 // Shutdown shuts down the store gracefully
 func (c *ITTTStore) Shutdown() {
 	c.this.Shutdown()
@@ -33,7 +33,7 @@ func NewMemStore(params MemParams) *MemStore {
 
 const nameMem = "mem"
 
-func MemStoreFactory(config *viper.Viper) (BlobStore, error) {
+func MemStoreFactory(config *viper.Viper, _ NewStoreFunc) (BlobStore, error) {
 	var cfg MemParams
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -97,5 +97,12 @@ func (m *MemStore) Debug() map[string]stream.Blob {
 	return m.blobs
 }
 
+// Size returns the number of blobs in memory. The store is unbounded.
+func (m *MemStore) Size() (int, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.blobs), 0, nil
+}
+
 // Shutdown shuts down the store gracefully
 func (m *MemStore) Shutdown() {}
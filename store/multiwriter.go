@@ -40,7 +40,7 @@ func NewMultiWriterStore(params MultiWriterParams) *MultiWriterStore {
 
 const nameMultiWriter = "multiwriter"
 
-func MultiWriterStoreFactory(config *viper.Viper) (BlobStore, error) {
+func MultiWriterStoreFactory(config *viper.Viper, newStore NewStoreFunc) (BlobStore, error) {
 	var cfg MultiWriterConfig
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -49,40 +49,16 @@ func MultiWriterStoreFactory(config *viper.Viper) (BlobStore, error) {
 
 	var destinations []BlobStore
 
-	one := config.Sub("one")
-	two := config.Sub("two")
-	//three := config.Sub("three")
-
-	storeTypeOne := strings.Split(one.AllKeys()[0], ".")[0]
-	storeTypeTwo := strings.Split(two.AllKeys()[0], ".")[0]
-	//storeTypeThree := strings.Split(three.AllKeys()[0], ".")[0]
-
-	storeCfgOne := one.Sub(storeTypeOne)
-	storeCfgTwo := two.Sub(storeTypeTwo)
-	//storeCfgThree := config.Sub(storeTypeThree)
-
-	factoryOne, ok := Factories[storeTypeOne]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", storeTypeOne)
-	}
-	factoryTwo, ok := Factories[storeTypeTwo]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", storeTypeTwo)
-	}
-	//factoryThree, ok := Factories[storeTypeThree]
-	//if !ok {
-	//	return nil, errors.Err("unknown store type %s", storeTypeThree)
-	//}
-
-	store1, err := factoryOne(storeCfgOne)
+	store1, err := newStore(config.Sub("one"))
 	if err != nil {
 		return nil, errors.Err(err)
 	}
-	store2, err := factoryTwo(storeCfgTwo)
+	store2, err := newStore(config.Sub("two"))
 	if err != nil {
+		store1.Shutdown()
 		return nil, errors.Err(err)
 	}
-	//store3, err := factoryThree(storeCfgThree)
+	//store3, err := newStore(config.Sub("three"))
 	//if err != nil {
 	//	return nil, errors.Err(err)
 	//}
@@ -198,6 +174,11 @@ func (m *MultiWriterStore) Delete(hash string) error {
 	return nil
 }
 
+// Underlying returns the destination stores
+func (m *MultiWriterStore) Underlying() []BlobStore {
+	return m.destinations
+}
+
 // Shutdown shuts down all destination stores gracefully
 func (m *MultiWriterStore) Shutdown() {
 	for _, dest := range m.destinations {
@@ -22,7 +22,7 @@ func NewNoopStore(name string) *NoopStore {
 
 const nameNoop = "noop"
 
-func NoopStoreFactory(config *viper.Viper) (BlobStore, error) {
+func NoopStoreFactory(config *viper.Viper, _ NewStoreFunc) (BlobStore, error) {
 	var cfg struct {
 		Name string `mapstructure:"name"`
 	}
@@ -1,10 +1,12 @@
 package store
 
 import (
+	"crypto/tls"
 	"strings"
 	"time"
 
 	"github.com/lbryio/reflector.go/shared"
+	"github.com/lbryio/reflector.go/tlsconfig"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
 	"github.com/lbryio/lbry.go/v2/stream"
@@ -15,8 +17,9 @@ import (
 // PeerStore is a blob store that gets blobs from a peer.
 // It satisfies the BlobStore interface but cannot put or delete blobs.
 type PeerStore struct {
-	name string
-	opts PeerParams
+	name      string
+	opts      PeerParams
+	tlsConfig *tls.Config
 }
 
 // PeerParams allows to set options for a new PeerStore.
@@ -24,21 +27,27 @@ type PeerParams struct {
 	Name    string        `mapstructure:"name"`
 	Address string        `mapstructure:"address"`
 	Timeout time.Duration `mapstructure:"timeout"`
+	// TLS connects to the peer with TLS, verifying its certificate as configured. Plain TCP is used without it.
+	TLS *tlsconfig.ClientConfig `mapstructure:"tls"`
 }
 
 // NewPeerStore makes a new peer store.
 func NewPeerStore(params PeerParams) *PeerStore {
-	return &PeerStore{opts: params, name: params.Name}
+	return &PeerStore{opts: params, name: params.Name, tlsConfig: params.TLS.TLSConfig()}
 }
 
 const namePeer = "peer"
 
-func PeerStoreFactory(config *viper.Viper) (BlobStore, error) {
+func PeerStoreFactory(config *viper.Viper, _ NewStoreFunc) (BlobStore, error) {
 	var cfg PeerParams
 	err := config.Unmarshal(&cfg)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
+	err = cfg.TLS.Validate()
+	if err != nil {
+		return nil, err
+	}
 	return NewPeerStore(cfg), nil
 }
 
@@ -49,7 +58,7 @@ func init() {
 func (p *PeerStore) Name() string { return namePeer + "-" + p.name }
 
 func (p *PeerStore) getClient() (*PeerClient, error) {
-	c := &PeerClient{Timeout: p.opts.Timeout}
+	c := &PeerClient{Timeout: p.opts.Timeout, TLSConfig: p.tlsConfig}
 	err := c.Connect(p.opts.Address)
 	return c, errors.Prefix("connection error", err)
 }
@@ -3,6 +3,7 @@ package store
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"io"
 	"net"
@@ -15,14 +16,20 @@ import (
 
 // PeerClient is a client for peer blob store
 type PeerClient struct {
-	conn    net.Conn
-	Timeout time.Duration
+	conn      net.Conn
+	Timeout   time.Duration
+	TLSConfig *tls.Config // connect with TLS if set
 }
 
 // Connect connects to a peer
 func (c *PeerClient) Connect(address string) error {
 	var err error
-	c.conn, err = net.DialTimeout("tcp", address, c.Timeout)
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	if c.TLSConfig != nil {
+		c.conn, err = tls.DialWithDialer(dialer, "tcp", address, c.TLSConfig)
+		return err
+	}
+	c.conn, err = dialer.Dial("tcp", address)
 	return err
 }
 
@@ -1,7 +1,6 @@
 package store
 
 import (
-	"strings"
 	"time"
 
 	"github.com/lbryio/reflector.go/shared"
@@ -26,9 +25,16 @@ func (c *ProxiedS3Store) MissingBlobsForKnownStream(s string) ([]string, error)
 	return nil, errors.Err("writer does not implement neededBlobChecker")
 }
 
-func (c *ProxiedS3Store) Block(hash string) error {
+func (c *ProxiedS3Store) Block(hash string, info BlockInfo) error {
 	if bl, ok := c.writerStore.(Blocklister); ok {
-		return bl.Block(hash)
+		return bl.Block(hash, info)
+	}
+	return errors.Err("writer does not implement Blocklister")
+}
+
+func (c *ProxiedS3Store) Unblock(hash string, info BlockInfo) error {
+	if bl, ok := c.writerStore.(Blocklister); ok {
+		return bl.Unblock(hash, info)
 	}
 	return errors.Err("writer does not implement Blocklister")
 }
@@ -40,6 +46,13 @@ func (c *ProxiedS3Store) Wants(hash string) (bool, error) {
 	return true, errors.Err("writer does not implement Blocklister")
 }
 
+func (c *ProxiedS3Store) Blocked() ([]string, error) {
+	if bl, ok := c.writerStore.(BlockedLister); ok {
+		return bl.Blocked()
+	}
+	return nil, errors.Err("writer does not implement BlockedLister")
+}
+
 type ProxiedS3Params struct {
 	Reader BlobStore `mapstructure:"reader"`
 	Writer BlobStore `mapstructure:"writer"`
@@ -75,6 +88,11 @@ func (c *ProxiedS3Store) Has(hash string) (bool, error) {
 	return c.writerStore.Has(hash)
 }
 
+// HasBlobs checks which of the hashes are in the store.
+func (c *ProxiedS3Store) HasBlobs(hashes []string) (map[string]bool, error) {
+	return HasBlobs(c.writerStore, hashes)
+}
+
 // Get gets the blob from Cloudfront.
 func (c *ProxiedS3Store) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
 	start := time.Now()
@@ -82,6 +100,13 @@ func (c *ProxiedS3Store) Get(hash string) (stream.Blob, shared.BlobTrace, error)
 	return blob, trace.Stack(time.Since(start), c.Name()), err
 }
 
+// Peek reads the blob from the reader store without side effects
+func (c *ProxiedS3Store) Peek(hash string) (stream.Blob, shared.BlobTrace, error) {
+	start := time.Now()
+	blob, trace, err := Peek(c.readerStore, hash)
+	return blob, trace.Stack(time.Since(start), c.Name()), err
+}
+
 // Put stores the blob on S3
 func (c *ProxiedS3Store) Put(hash string, blob stream.Blob) error {
 	return c.writerStore.Put(hash, blob)
@@ -97,13 +122,18 @@ func (c *ProxiedS3Store) Delete(hash string) error {
 	return c.writerStore.Delete(hash)
 }
 
+// Underlying returns the reader and writer stores
+func (c *ProxiedS3Store) Underlying() []BlobStore {
+	return []BlobStore{c.readerStore, c.writerStore}
+}
+
 // Shutdown shuts down the store gracefully
 func (c *ProxiedS3Store) Shutdown() {
 	c.writerStore.Shutdown()
 	c.readerStore.Shutdown()
 }
 
-func ProxiedS3StoreFactory(config *viper.Viper) (BlobStore, error) {
+func ProxiedS3StoreFactory(config *viper.Viper, newStore NewStoreFunc) (BlobStore, error) {
 	var cfg ProxiedS3Config
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -113,25 +143,14 @@ func ProxiedS3StoreFactory(config *viper.Viper) (BlobStore, error) {
 	cfg.Reader = config.Sub("reader")
 	cfg.Writer = config.Sub("writer")
 
-	readerStoreType := strings.Split(cfg.Reader.AllKeys()[0], ".")[0]
-	readerStoreConfig := cfg.Reader.Sub(readerStoreType)
-	factory, ok := Factories[readerStoreType]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", readerStoreType)
-	}
-	readerStore, err := factory(readerStoreConfig)
+	readerStore, err := newStore(cfg.Reader)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
 
-	writerStoreType := strings.Split(cfg.Writer.AllKeys()[0], ".")[0]
-	writerStoreConfig := cfg.Writer.Sub(writerStoreType)
-	factory, ok = Factories[writerStoreType]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", writerStoreType)
-	}
-	writerStore, err := factory(writerStoreConfig)
+	writerStore, err := newStore(cfg.Writer)
 	if err != nil {
+		readerStore.Shutdown()
 		return nil, errors.Err(err)
 	}
 
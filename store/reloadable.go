@@ -0,0 +1,196 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/lbryio/reflector.go/shared"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+	"github.com/lbryio/lbry.go/v2/stream"
+)
+
+// ReloadableStore wraps a store that can be replaced while requests are being served. Servers hold on to the
+// ReloadableStore, and every request is routed to the store that was current when the request started.
+// Replaced stores are shut down once the requests they were serving are done.
+type ReloadableStore struct {
+	current *generation
+	mu      sync.RWMutex
+}
+
+// generation is one store tree along with the requests it is currently serving
+type generation struct {
+	store    BlobStore
+	inflight sync.WaitGroup
+}
+
+// NewReloadableStore returns an initialized ReloadableStore pointer serving from the given store.
+func NewReloadableStore(s BlobStore) *ReloadableStore {
+	return &ReloadableStore{current: &generation{store: s}}
+}
+
+// acquire returns the current generation and marks a request as in flight on it
+func (r *ReloadableStore) acquire() *generation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	g := r.current
+	g.inflight.Add(1)
+	return g
+}
+
+// Swap replaces the store. New requests go to the new store right away, and the old one is shut down in the
+// background once all the requests that were already using it are finished.
+func (r *ReloadableStore) Swap(s BlobStore) {
+	r.mu.Lock()
+	old := r.current
+	r.current = &generation{store: s}
+	r.mu.Unlock()
+
+	go func() {
+		old.inflight.Wait()
+		old.store.Shutdown()
+	}()
+}
+
+// Name is the name of the current store
+func (r *ReloadableStore) Name() string {
+	g := r.acquire()
+	defer g.inflight.Done()
+	return g.store.Name()
+}
+
+// Has checks the current store for the blob
+func (r *ReloadableStore) Has(hash string) (bool, error) {
+	g := r.acquire()
+	defer g.inflight.Done()
+	return g.store.Has(hash)
+}
+
+// HasBlobs checks the current store for the blobs
+func (r *ReloadableStore) HasBlobs(hashes []string) (map[string]bool, error) {
+	g := r.acquire()
+	defer g.inflight.Done()
+	return HasBlobs(g.store, hashes)
+}
+
+// Get gets the blob from the current store
+func (r *ReloadableStore) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
+	g := r.acquire()
+	defer g.inflight.Done()
+	return g.store.Get(hash)
+}
+
+// Put stores the blob in the current store
+func (r *ReloadableStore) Put(hash string, blob stream.Blob) error {
+	g := r.acquire()
+	defer g.inflight.Done()
+	return g.store.Put(hash, blob)
+}
+
+// PutSD stores the sd blob in the current store
+func (r *ReloadableStore) PutSD(hash string, blob stream.Blob) error {
+	g := r.acquire()
+	defer g.inflight.Done()
+	return g.store.PutSD(hash, blob)
+}
+
+// Delete deletes the blob from the current store
+func (r *ReloadableStore) Delete(hash string) error {
+	g := r.acquire()
+	defer g.inflight.Done()
+	return g.store.Delete(hash)
+}
+
+// Block forwards to the current store if it is a Blocklister
+func (r *ReloadableStore) Block(hash string, info BlockInfo) error {
+	g := r.acquire()
+	defer g.inflight.Done()
+	if bl, ok := g.store.(Blocklister); ok {
+		return bl.Block(hash, info)
+	}
+	return errors.Err(shared.ErrNotImplemented)
+}
+
+// Unblock forwards to the current store if it is a Blocklister
+func (r *ReloadableStore) Unblock(hash string, info BlockInfo) error {
+	g := r.acquire()
+	defer g.inflight.Done()
+	if bl, ok := g.store.(Blocklister); ok {
+		return bl.Unblock(hash, info)
+	}
+	return errors.Err(shared.ErrNotImplemented)
+}
+
+// Wants forwards to the current store if it is a Blocklister. Otherwise nothing is blocked, so it wants any blob it doesn't have.
+func (r *ReloadableStore) Wants(hash string) (bool, error) {
+	g := r.acquire()
+	defer g.inflight.Done()
+	if bl, ok := g.store.(Blocklister); ok {
+		return bl.Wants(hash)
+	}
+	has, err := g.store.Has(hash)
+	return !has, err
+}
+
+// Blocked forwards to the current store if it is a BlockedLister
+func (r *ReloadableStore) Blocked() ([]string, error) {
+	g := r.acquire()
+	defer g.inflight.Done()
+	if bl, ok := g.store.(BlockedLister); ok {
+		return bl.Blocked()
+	}
+	return nil, errors.Err(shared.ErrNotImplemented)
+}
+
+// MissingBlobsForKnownStream forwards to the current store if it is a NeededBlobChecker
+func (r *ReloadableStore) MissingBlobsForKnownStream(sdHash string) ([]string, error) {
+	g := r.acquire()
+	defer g.inflight.Done()
+	if bc, ok := g.store.(NeededBlobChecker); ok {
+		return bc.MissingBlobsForKnownStream(sdHash)
+	}
+	return nil, errors.Err(shared.ErrNotImplemented)
+}
+
+// Peek reads the blob from the current store without side effects
+func (r *ReloadableStore) Peek(hash string) (stream.Blob, shared.BlobTrace, error) {
+	g := r.acquire()
+	defer g.inflight.Done()
+	return Peek(g.store, hash)
+}
+
+// hold returns the current store, which is not shut down by a swap until release is called
+func (r *ReloadableStore) hold() (BlobStore, func()) {
+	g := r.acquire()
+	return g.store, g.inflight.Done
+}
+
+// Shutdown waits for in-flight requests and shuts down the current store. Requests made after it fail.
+func (r *ReloadableStore) Shutdown() {
+	r.mu.Lock()
+	g := r.current
+	// new requests must not be added to the generation while its requests are waited for
+	r.current = &generation{store: closedStore{name: g.store.Name()}}
+	r.mu.Unlock()
+	g.inflight.Wait()
+	g.store.Shutdown()
+}
+
+// ErrStoreShutDown is returned by a ReloadableStore that was shut down
+var ErrStoreShutDown = errors.Base("store is shut down")
+
+// closedStore replaces the store of a ReloadableStore that was shut down
+type closedStore struct {
+	name string
+}
+
+func (c closedStore) Name() string { return c.name }
+func (c closedStore) Has(string) (bool, error) {
+	return false, errors.Err(ErrStoreShutDown)
+}
+func (c closedStore) Get(string) (stream.Blob, shared.BlobTrace, error) {
+	return nil, shared.BlobTrace{}, errors.Err(ErrStoreShutDown)
+}
+func (c closedStore) Put(string, stream.Blob) error   { return errors.Err(ErrStoreShutDown) }
+func (c closedStore) PutSD(string, stream.Blob) error { return errors.Err(ErrStoreShutDown) }
+func (c closedStore) Delete(string) error             { return errors.Err(ErrStoreShutDown) }
+func (c closedStore) Shutdown()                       {}
@@ -31,6 +31,7 @@ type S3Store struct {
 	region       string
 	bucket       string
 	endpoint     string
+	profile      string
 	name         string
 	prefixLength int
 }
@@ -42,6 +43,7 @@ type S3Params struct {
 	Region       string `mapstructure:"region"`
 	Bucket       string `mapstructure:"bucket"`
 	Endpoint     string `mapstructure:"endpoint"`
+	Profile      string `mapstructure:"profile"`
 	ShardingSize int    `mapstructure:"sharding_size"`
 }
 
@@ -53,6 +55,7 @@ func NewS3Store(params S3Params) *S3Store {
 		region:       params.Region,
 		bucket:       params.Bucket,
 		endpoint:     params.Endpoint,
+		profile:      params.Profile,
 		name:         params.Name,
 		prefixLength: params.ShardingSize,
 	}
@@ -60,7 +63,7 @@ func NewS3Store(params S3Params) *S3Store {
 
 const nameS3 = "s3"
 
-func S3StoreFactory(config *viper.Viper) (BlobStore, error) {
+func S3StoreFactory(config *viper.Viper, _ NewStoreFunc) (BlobStore, error) {
 	var cfg S3Params
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -190,16 +193,22 @@ func (s *S3Store) initOnce() error {
 	}
 
 	ctx := context.Background()
-	cfg, err := awsconfig.LoadDefaultConfig(ctx,
-		awsconfig.WithRegion(s.region),
-		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(s.awsID, s.awsSecret, "")),
-	)
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(s.region)}
+	// without static credentials, the default AWS credential chain is used (env, shared config, web identity, instance role...)
+	if s.awsID != "" || s.awsSecret != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(s.awsID, s.awsSecret, "")))
+	} else if s.profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(s.profile))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
 		return errors.Err(err)
 	}
 
 	s.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(s.endpoint)
+		if s.endpoint != "" {
+			o.BaseEndpoint = aws.String(s.endpoint)
+		}
 		o.UsePathStyle = true
 		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
 	})
@@ -1,7 +1,6 @@
 package store
 
 import (
-	"strings"
 	"time"
 
 	"github.com/lbryio/reflector.go/internal/metrics"
@@ -33,7 +32,7 @@ type SingleFlightConfig struct {
 	Component string `mapstructure:"component"`
 }
 
-func SingleFlightStoreFactory(config *viper.Viper) (BlobStore, error) {
+func SingleFlightStoreFactory(config *viper.Viper, newStore NewStoreFunc) (BlobStore, error) {
 	var cfg SingleFlightConfig
 	err := config.Unmarshal(&cfg)
 	if err != nil {
@@ -42,13 +41,7 @@ func SingleFlightStoreFactory(config *viper.Viper) (BlobStore, error) {
 
 	cfg.Store = config.Sub("store")
 
-	storeType := strings.Split(cfg.Store.AllKeys()[0], ".")[0]
-	storeConfig := cfg.Store.Sub(storeType)
-	factory, ok := Factories[storeType]
-	if !ok {
-		return nil, errors.Err("unknown store type %s", storeType)
-	}
-	underlyingStore, err := factory(storeConfig)
+	underlyingStore, err := newStore(cfg.Store)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
@@ -64,6 +57,11 @@ func (s *singleflightStore) Name() string {
 	return "sf_" + s.BlobStore.Name()
 }
 
+// HasBlobs forwards to the origin, so batches are not split into single checks
+func (s *singleflightStore) HasBlobs(hashes []string) (map[string]bool, error) {
+	return HasBlobs(s.BlobStore, hashes)
+}
+
 type getterResponse struct {
 	blob  stream.Blob
 	stack shared.BlobTrace
@@ -154,6 +152,11 @@ func (s *singleflightStore) putter(hash string, blob stream.Blob) func() (interf
 	}
 }
 
+// unwrap returns the underlying store. Singleflight only deduplicates requests, so it is left out of the topology.
+func (s *singleflightStore) unwrap() BlobStore {
+	return s.BlobStore
+}
+
 // Shutdown shuts down the store gracefully
 func (s *singleflightStore) Shutdown() {
 	s.BlobStore.Shutdown()
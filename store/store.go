@@ -30,16 +30,36 @@ type BlobStore interface {
 // Blocklister is a store that supports blocking blobs to prevent their inclusion in the store.
 type Blocklister interface {
 	// Block deletes the blob and prevents it from being uploaded in the future
-	Block(hash string) error
+	Block(hash string, info BlockInfo) error
+	// Unblock allows the blob to be uploaded again
+	Unblock(hash string, info BlockInfo) error
 	// Wants returns false if the hash exists in store or is blocked, true otherwise
 	Wants(hash string) (bool, error)
 }
 
+// BlockInfo says why a hash is blocked or unblocked. It is kept in the block history.
+type BlockInfo struct {
+	Reason string
+	Source string // who did it, e.g. a blocklist source or an operator
+}
+
+// BlockedLister is a store that can list the hashes it blocks
+type BlockedLister interface {
+	// Blocked returns every blocked hash
+	Blocked() ([]string, error)
+}
+
 // NeededBlobChecker can check which blobs from a known stream are not uploaded yet
 type NeededBlobChecker interface {
 	MissingBlobsForKnownStream(string) ([]string, error)
 }
 
+// BatchChecker is a store that can check many blobs at once, e.g. with a single query or request
+type BatchChecker interface {
+	// HasBlobs returns whether the store has each of the hashes. Hashes it doesn't have may be left out of the map.
+	HasBlobs(hashes []string) (map[string]bool, error)
+}
+
 // lister is a store that can list cached blobs. This is helpful when an overlay
 // cache needs to track blob existence.
 type lister interface {
@@ -54,4 +74,8 @@ func RegisterStore(name string, factory Factory) {
 	Factories[name] = factory
 }
 
-type Factory func(config *viper.Viper) (BlobStore, error)
+// Factory creates a store from its config. Stores that wrap other stores create them with newStore.
+type Factory func(config *viper.Viper, newStore NewStoreFunc) (BlobStore, error)
+
+// NewStoreFunc creates the store defined by config, which must contain exactly one key: the store type
+type NewStoreFunc func(config *viper.Viper) (BlobStore, error)
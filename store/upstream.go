@@ -3,6 +3,7 @@ package store
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"io"
 	"net"
 	"net/http"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/lbryio/reflector.go/internal/metrics"
 	"github.com/lbryio/reflector.go/shared"
+	"github.com/lbryio/reflector.go/signing"
+	"github.com/lbryio/reflector.go/tlsconfig"
 
 	"github.com/lbryio/lbry.go/v2/extras/errors"
 	"github.com/lbryio/lbry.go/v2/stream"
@@ -21,35 +24,57 @@ import (
 
 // UpstreamStore is a store that works on top of the HTTP protocol
 type UpstreamStore struct {
-	upstream   string
-	httpClient *http.Client
-	edgeToken  string
-	name       string
+	upstream     string
+	httpClient   *http.Client
+	edgeToken    string
+	name         string
+	signingKey   signing.Key
+	signedURLTTL time.Duration
+	signedURLIP  string
 }
 
 type UpstreamParams struct {
 	Name      string `mapstructure:"name"`
 	Upstream  string `mapstructure:"upstream"`
 	EdgeToken string `mapstructure:"edge_token"`
+	// SigningKey signs the blob URLs so the upstream serves protected blobs. The URLs are valid for SignedURLTTL
+	// (default 1m) and, if SignedURLIP is set, only when requested from that ip (the egress ip of this node).
+	SigningKey   signing.Key   `mapstructure:"signing_key"`
+	SignedURLTTL time.Duration `mapstructure:"signed_url_ttl"`
+	SignedURLIP  string        `mapstructure:"signed_url_ip"`
+	// TLS verifies the certificate of an https upstream as configured, instead of with the system roots
+	TLS *tlsconfig.ClientConfig `mapstructure:"tls"`
 }
 
+const defaultSignedURLTTL = time.Minute
+
 func NewUpstreamStore(params UpstreamParams) *UpstreamStore {
+	if params.SignedURLTTL <= 0 {
+		params.SignedURLTTL = defaultSignedURLTTL
+	}
 	return &UpstreamStore{
-		upstream:   params.Upstream,
-		httpClient: getClient(),
-		edgeToken:  params.EdgeToken,
-		name:       params.Name,
+		upstream:     params.Upstream,
+		httpClient:   getClient(params.TLS.TLSConfig()),
+		edgeToken:    params.EdgeToken,
+		name:         params.Name,
+		signingKey:   params.SigningKey,
+		signedURLTTL: params.SignedURLTTL,
+		signedURLIP:  params.SignedURLIP,
 	}
 }
 
 const nameUpstream = "upstream"
 
-func UpstreamStoreFactory(config *viper.Viper) (BlobStore, error) {
+func UpstreamStoreFactory(config *viper.Viper, _ NewStoreFunc) (BlobStore, error) {
 	var cfg UpstreamParams
 	err := config.Unmarshal(&cfg)
 	if err != nil {
 		return nil, errors.Err(err)
 	}
+	err = cfg.TLS.Validate()
+	if err != nil {
+		return nil, err
+	}
 	return NewUpstreamStore(cfg), nil
 }
 
@@ -84,12 +109,25 @@ func (n *UpstreamStore) Has(hash string) (bool, error) {
 	return false, errors.Err("upstream error. Status code: %d (%s)", res.StatusCode, string(body))
 }
 
+// HasBlobs asks the upstream which of the hashes it has with a single request per batch, falling back to one
+// request per hash if the upstream doesn't support batches
+func (n *UpstreamStore) HasBlobs(hashes []string) (map[string]bool, error) {
+	found, err := postHas(n.httpClient, n.upstream, hashes)
+	if errors.Is(err, errBatchUnsupported) {
+		return hasEach(n.Has, hashes)
+	}
+	return found, err
+}
+
 func (n *UpstreamStore) Get(hash string) (stream.Blob, shared.BlobTrace, error) {
 	start := time.Now()
 	url := n.upstream + "/blob?hash=" + hash
 	if n.edgeToken != "" {
 		url += "&edge_token=" + n.edgeToken
 	}
+	if n.signingKey.Secret != "" {
+		url += "&" + signing.Sign(n.signingKey, hash, time.Now().Add(n.signedURLTTL), n.signedURLIP).Encode()
+	}
 
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
@@ -185,11 +223,13 @@ func dialContext(ctx context.Context, network, address string) (net.Conn, error)
 	return dialer.DialContext(ctx, network, address)
 }
 
-// getClient gets an http client that's customized to be more performant when dealing with blobs of 2MB in size (most of our blobs)
-func getClient() *http.Client {
+// getClient gets an http client that's customized to be more performant when dealing with blobs of 2MB in size (most of our blobs).
+// tlsConfig may be nil for the default TLS settings.
+func getClient(tlsConfig *tls.Config) *http.Client {
 	// Customize the Transport to have larger connection pool
 	defaultTransport := &http.Transport{
 		DialContext:           dialContext,
+		TLSClientConfig:       tlsConfig,
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
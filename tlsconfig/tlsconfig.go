@@ -0,0 +1,274 @@
+// Package tlsconfig builds the TLS configuration of the blob servers and of the stores connecting to them.
+// Certificates and CAs are read from files, which are loaded again when they change, so they can be
+// rotated without restarting.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lbryio/lbry.go/v2/extras/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkInterval is how often the files are checked for changes, at most
+var checkInterval = 10 * time.Second
+
+// ServerConfig is the TLS configuration of a blob server. TLS is disabled if no certificate is set.
+type ServerConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ClientCAFile are the CAs trusted to sign client certificates. Client certificates are not asked for without it.
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// RequireClientCert refuses clients without a valid certificate. Otherwise clients may connect without one.
+	RequireClientCert bool `mapstructure:"require_client_cert"`
+}
+
+// Enabled returns true if the server should use TLS
+func (c ServerConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Validate checks that the certificate and key can be loaded
+func (c ServerConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.Err("tls needs both a cert_file and a key_file")
+	}
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		return errors.Err("tls needs a client_ca_file to require client certificates")
+	}
+	_, err := loadKeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return err
+	}
+	if c.ClientCAFile != "" {
+		_, err = loadCertPool(c.ClientCAFile)
+	}
+	return err
+}
+
+// TLSConfig returns the TLS configuration of the server, or nil if TLS is disabled
+func (c ServerConfig) TLSConfig() (*tls.Config, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	cert := newWatched([]string{c.CertFile, c.KeyFile}, func() (*tls.Certificate, error) {
+		return loadKeyPair(c.CertFile, c.KeyFile)
+	})
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cert.get()
+		},
+	}
+	if c.ClientCAFile == "" {
+		return config, nil
+	}
+
+	// client certificates are verified here rather than by crypto/tls, so the CAs can be reloaded
+	config.ClientAuth = tls.RequestClientCert
+	if c.RequireClientCert {
+		config.ClientAuth = tls.RequireAnyClientCert
+	}
+	roots := newWatched([]string{c.ClientCAFile}, func() (*x509.CertPool, error) {
+		return loadCertPool(c.ClientCAFile)
+	})
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return nil // a missing certificate is refused by crypto/tls if it is required
+		}
+		return verify(cs.PeerCertificates, roots, x509.VerifyOptions{KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	}
+	return config, nil
+}
+
+// Identity returns the identity of the client of a connection: the common name of its certificate, which was
+// verified against the client CAs of the server. It returns an empty string if the client sent no certificate.
+func Identity(cs *tls.ConnectionState) string {
+	if cs == nil || len(cs.PeerCertificates) == 0 {
+		return ""
+	}
+	return cs.PeerCertificates[0].Subject.CommonName
+}
+
+// ClientConfig is how a store verifies the certificate of the server it connects to
+type ClientConfig struct {
+	// CAFile pins the CAs trusted to sign the server certificate. The system roots are used if it's empty.
+	CAFile string `mapstructure:"ca_file"`
+	// ServerName is the name verified in the server certificate, if it differs from the host connected to
+	ServerName string `mapstructure:"server_name"`
+	// Insecure skips the verification of the server certificate
+	Insecure bool `mapstructure:"insecure"`
+	// CertFile and KeyFile are the certificate the client presents to servers that verify clients
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// Validate checks that the files can be loaded. A nil config is valid.
+func (c *ClientConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.Err("tls needs both a cert_file and a key_file for a client certificate")
+	}
+	if c.CertFile != "" {
+		_, err := loadKeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return err
+		}
+	}
+	if c.CAFile != "" {
+		_, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TLSConfig returns the TLS configuration of the client, or nil for a nil config
+func (c *ClientConfig) TLSConfig() *tls.Config {
+	if c == nil {
+		return nil
+	}
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.Insecure,
+	}
+	if c.CertFile != "" {
+		cert := newWatched([]string{c.CertFile, c.KeyFile}, func() (*tls.Certificate, error) {
+			return loadKeyPair(c.CertFile, c.KeyFile)
+		})
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.get()
+		}
+	}
+	if c.CAFile == "" || c.Insecure {
+		return config
+	}
+
+	// the standard verification can't reload the CAs, so it is replaced by one that can
+	roots := newWatched([]string{c.CAFile}, func() (*x509.CertPool, error) {
+		return loadCertPool(c.CAFile)
+	})
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.Err("server sent no certificate")
+		}
+		serverName := c.ServerName
+		if serverName == "" {
+			serverName = cs.ServerName
+		}
+		return verify(cs.PeerCertificates, roots, x509.VerifyOptions{DNSName: serverName})
+	}
+	return config
+}
+
+// verify checks that the first certificate of the chain is signed by one of the roots
+func verify(chain []*x509.Certificate, roots *watched[*x509.CertPool], opts x509.VerifyOptions) error {
+	pool, err := roots.get()
+	if err != nil {
+		return err
+	}
+	opts.Roots = pool
+	opts.Intermediates = x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = chain[0].Verify(opts)
+	return err
+}
+
+func loadKeyPair(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Prefix("loading tls certificate", err)
+	}
+	return &cert, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Prefix("loading tls ca", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Err("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// watched is a value loaded from files, which is loaded again when any of them changes.
+// If loading the new files fails, the last good value is kept.
+type watched[T any] struct {
+	files []string
+	load  func() (T, error)
+
+	mu        sync.Mutex
+	value     T
+	loaded    bool
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+func newWatched[T any](files []string, load func() (T, error)) *watched[T] {
+	return &watched[T]{files: files, load: load}
+}
+
+func (w *watched[T]) get() (T, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.loaded && time.Since(w.checkedAt) < checkInterval {
+		return w.value, nil
+	}
+	w.checkedAt = time.Now()
+
+	modTimes := make([]time.Time, len(w.files))
+	changed := !w.loaded
+	for i, file := range w.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			if w.loaded {
+				log.Errorf("checking %s for changes: %s", file, err)
+				return w.value, nil
+			}
+			return w.value, errors.Err(err)
+		}
+		modTimes[i] = info.ModTime()
+		if w.loaded && !modTimes[i].Equal(w.modTimes[i]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return w.value, nil
+	}
+
+	value, err := w.load()
+	if err != nil {
+		if w.loaded {
+			log.Errorf("reloading %v, keeping the previous version: %s", w.files, errors.FullTrace(err))
+			return w.value, nil
+		}
+		return value, err
+	}
+	if w.loaded {
+		log.Infof("reloaded %v", w.files)
+	}
+	w.value, w.loaded, w.modTimes = value, true, modTimes
+	return value, nil
+}
@@ -0,0 +1,193 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a certificate for name signed by the CA, and its key, to certFile and keyFile
+func (ca testCA) issue(t *testing.T, name, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+// handshake connects a client to a server and returns the handshake error of the client
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) error {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		_ = conn.(*tls.Conn).Handshake()
+		_ = conn.Close()
+	}()
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", l.Addr().String(), clientConfig)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestPinnedCAAndReload(t *testing.T) {
+	checkInterval = 0
+	defer func() { checkInterval = 10 * time.Second }()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	caFile, otherCAFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "other-ca.pem")
+	ca, otherCA := newTestCA(t), newTestCA(t)
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+	require.NoError(t, os.WriteFile(otherCAFile, otherCA.pem, 0600))
+	ca.issue(t, "origin.test", certFile, keyFile)
+
+	server := ServerConfig{CertFile: certFile, KeyFile: keyFile}
+	require.NoError(t, server.Validate())
+	serverConfig, err := server.TLSConfig()
+	require.NoError(t, err)
+
+	pinned := &ClientConfig{CAFile: caFile, ServerName: "origin.test"}
+	require.NoError(t, pinned.Validate())
+	client := pinned.TLSConfig()
+	other := (&ClientConfig{CAFile: otherCAFile, ServerName: "origin.test"}).TLSConfig()
+	wrongName := (&ClientConfig{CAFile: caFile, ServerName: "other.test"}).TLSConfig()
+
+	assert.NoError(t, handshake(t, serverConfig, client))
+	assert.Error(t, handshake(t, serverConfig, other))
+	assert.Error(t, handshake(t, serverConfig, wrongName))
+
+	// the server picks up a certificate from the other CA once the files change
+	time.Sleep(10 * time.Millisecond) // make sure the modification time changes
+	otherCA.issue(t, "origin.test", certFile, keyFile)
+	assert.Error(t, handshake(t, serverConfig, client))
+	assert.NoError(t, handshake(t, serverConfig, other))
+
+	// a broken certificate is not loaded, the last good one is kept
+	require.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0600))
+	assert.NoError(t, handshake(t, serverConfig, other))
+
+	assert.Error(t, (&ClientConfig{CAFile: certFile}).Validate())
+	assert.Error(t, ServerConfig{CertFile: certFile}.Validate())
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca, otherCA := newTestCA(t), newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0600))
+	serverCert, serverKey := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+	ca.issue(t, "origin.test", serverCert, serverKey)
+	edgeCert, edgeKey := filepath.Join(dir, "edge.pem"), filepath.Join(dir, "edge-key.pem")
+	ca.issue(t, "edge-1", edgeCert, edgeKey)
+	strangerCert, strangerKey := filepath.Join(dir, "stranger.pem"), filepath.Join(dir, "stranger-key.pem")
+	otherCA.issue(t, "stranger", strangerCert, strangerKey)
+
+	assert.Error(t, ServerConfig{CertFile: serverCert, KeyFile: serverKey, RequireClientCert: true}.Validate())
+	assert.Error(t, (&ClientConfig{CertFile: edgeCert}).Validate())
+
+	edge := &ClientConfig{CAFile: caFile, ServerName: "origin.test", CertFile: edgeCert, KeyFile: edgeKey}
+	require.NoError(t, edge.Validate())
+	stranger := &ClientConfig{CAFile: caFile, ServerName: "origin.test", CertFile: strangerCert, KeyFile: strangerKey}
+	anonymous := &ClientConfig{CAFile: caFile, ServerName: "origin.test"}
+
+	tests := []struct {
+		name     string
+		require  bool
+		client   *ClientConfig
+		identity string
+		fails    bool
+	}{
+		{name: "edge", client: edge, identity: "edge-1"},
+		{name: "anonymous allowed", client: anonymous},
+		{name: "anonymous refused", require: true, client: anonymous, fails: true},
+		{name: "unknown CA", client: stranger, fails: true},
+	}
+	for _, test := range tests {
+		serverConfig, err := ServerConfig{CertFile: serverCert, KeyFile: serverKey, ClientCAFile: caFile, RequireClientCert: test.require}.TLSConfig()
+		require.NoError(t, err)
+		identity, err := serverHandshake(t, serverConfig, test.client.TLSConfig())
+		if test.fails {
+			assert.Error(t, err, test.name)
+			continue
+		}
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.identity, identity, test.name)
+	}
+}
+
+// serverHandshake connects a client to a server and returns the identity of the client seen by the server,
+// and the handshake error of the server
+func serverHandshake(t *testing.T, serverConfig, clientConfig *tls.Config) (string, error) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+	go func() {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", l.Addr().String(), clientConfig)
+		if err == nil {
+			_, _ = conn.Read(make([]byte, 1)) // wait for the server to be done
+			_ = conn.Close()
+		}
+	}()
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	tlsConn := conn.(*tls.Conn)
+	err = tlsConn.Handshake()
+	state := tlsConn.ConnectionState()
+	return Identity(&state), err
+}